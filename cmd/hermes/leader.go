@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/kagelui/notification/internal/pkg/leader"
+	"github.com/kagelui/notification/internal/pkg/loglib"
+	"github.com/kagelui/notification/internal/service/messages"
+)
+
+// newElector returns the Elector of the maintenance job, each job runs on one replica at a time
+func newElector(ctx context.Context, db *sqlx.DB, e envVar, job string) *leader.Elector {
+	lg := loglib.GetLogger(ctx)
+	return leader.NewElector(db.DB, "hermes-"+job, e.LeaderRenewInterval, func(isLeader bool) {
+		if isLeader {
+			lg.InfoF("leading %s", job)
+		} else {
+			lg.InfoF("stopped leading %s", job)
+		}
+	})
+}
+
+// lead runs the maintenance job unless another replica is running it, the context of the job is cancelled if the
+// leadership is lost
+func lead(ctx context.Context, db *sqlx.DB, e envVar, job string, run func(ctx context.Context) error) error {
+	lease, ok, err := newElector(ctx, db, e, job).TryLead(ctx)
+	if err != nil {
+		return fmt.Errorf("electing the leader of %s: %v", job, err)
+	}
+	if !ok {
+		loglib.GetLogger(ctx).InfoF("%s is run by another replica, skipping", job)
+		return nil
+	}
+	defer lease.Release()
+	return run(lease.Context())
+}
+
+// sweep marks failed the retried messages left pending by a stopped run, so that they are retried again
+func (r retrier) sweep(ctx context.Context) error {
+	n, err := messages.SweepStuckPending(ctx, r.db, r.e.StuckPendingAfter)
+	if err != nil {
+		return fmt.Errorf("sweeping stuck pending messages: %v", err)
+	}
+	if n > 0 {
+		loglib.GetLogger(ctx).WarnF("%d messages pending for over %v are retried again", n, r.e.StuckPendingAfter)
+	}
+	return nil
+}
+
+// sweepWhileLeading sweeps the stuck pending messages every SWEEP_INTERVAL while the replica leads the sweep, until
+// the context is done
+func (r retrier) sweepWhileLeading(ctx context.Context) {
+	newElector(ctx, r.db, r.e, "sweep").Run(ctx, func(ctx context.Context) {
+		ticker := time.NewTicker(r.e.SweepInterval)
+		defer ticker.Stop()
+		for {
+			if err := r.sweep(ctx); err != nil && ctx.Err() == nil {
+				loglib.GetLogger(ctx).ErrorF(err.Error())
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
@@ -2,22 +2,44 @@ package main
 
 import (
 	"context"
-	"github.com/kagelui/notification/internal/models/bmodels"
+	"flag"
 	"net/http"
 	"os"
-	"sync"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/cenkalti/backoff/v4"
 	"github.com/jmoiron/sqlx"
 	"github.com/kagelui/notification/internal/pkg/envvar"
 	"github.com/kagelui/notification/internal/pkg/loglib"
+	"github.com/kagelui/notification/internal/pkg/metrics"
+	jobqueue2 "github.com/kagelui/notification/internal/pkg/queue"
+	"github.com/kagelui/notification/internal/pkg/secret"
+	"github.com/kagelui/notification/internal/pkg/trace"
 	"github.com/kagelui/notification/internal/service/messages"
 	_ "github.com/lib/pq"
 )
 
 const goRoutineCap = 10
 
+const eventBufferSize = 1000
+
+// subcommands of hermes, e.g. hermes purge -dry-run
+var subcommands = map[string]func(ctx context.Context, db *sqlx.DB, e envVar, args []string) error{
+	"purge":      purge,
+	"partitions": partitions,
+}
+
+var (
+	configFile  = flag.String("config", os.Getenv("CONFIG_FILE"), "optional YAML or TOML config file, env vars take precedence")
+	printConfig = flag.Bool("print-config", false, "print the effective config with secrets redacted and exit")
+	watch       = flag.Bool("watch", false, "keep running, retrying the messages as they fall due")
+)
+
 func main() {
+	flag.Parse()
+
 	lg := loglib.DefaultLogger()
 	ctx := loglib.SetLogger(context.Background(), lg)
 
@@ -25,63 +47,178 @@ func main() {
 
 	var e envVar
 
-	if err := envvar.Read(&e); err != nil {
+	if err := envvar.Read(&e, envvar.WithFile(*configFile)); err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(1)
+	}
+
+	if *printConfig {
+		if err := envvar.Print(os.Stdout, &e); err != nil {
+			lg.ErrorF(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := loglib.Configure(e.Log); err != nil {
 		lg.ErrorF(err.Error())
 		os.Exit(1)
 	}
 
+	if e.RetryBatchSize <= 0 || e.RetryMaxPerRun <= 0 || e.RetryPollInterval <= 0 {
+		lg.ErrorF("RETRY_BATCH_SIZE, RETRY_MAX_PER_RUN and RETRY_POLL_INTERVAL must be positive")
+		os.Exit(1)
+	}
+	if e.LeaderRenewInterval <= 0 || e.SweepInterval <= 0 || e.StuckPendingAfter <= 0 {
+		lg.ErrorF("LEADER_RENEW_INTERVAL, SWEEP_INTERVAL and STUCK_PENDING_AFTER must be positive")
+		os.Exit(1)
+	}
+
 	db, err := sqlx.Connect("postgres", e.DBAddr)
 	if err != nil {
 		lg.ErrorF(err.Error())
 		os.Exit(2)
 	}
 
-	messageSlice, err := messages.RetrieveAllRetryMessages(ctx, db)
+	metrics.HashBusinessID = e.HashBusinessID
+	// metrics are only exposed by -watch, a single run is over before it is scraped
+	if e.MetricsAddr != "" && *watch {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		go func() {
+			if err := http.ListenAndServe(e.MetricsAddr, mux); err != nil {
+				lg.ErrorF("metrics server: %v", err.Error())
+			}
+		}()
+	}
+
+	// spans are only exported when an exporter is configured
+	if e.Trace.Exporter != "" {
+		exporter, err := trace.NewExporter(e.Trace.Exporter, "hermes", e.Trace.OTLPEndpoint, e.Trace.File)
+		if err != nil {
+			lg.ErrorF(err.Error())
+			os.Exit(6)
+		}
+		trace.SetExporter(exporter)
+		defer trace.Shutdown(context.Background())
+	}
+
+	// the maintenance subcommands run instead of retrying the failed messages, on one replica at a time
+	if cmd, ok := subcommands[flag.Arg(0)]; ok {
+		err := lead(ctx, db, e, flag.Arg(0), func(ctx context.Context) error {
+			return cmd(ctx, db, e, flag.Args()[1:])
+		})
+		if err != nil {
+			lg.ErrorF(err.Error())
+			os.Exit(9)
+		}
+		return
+	}
+
+	var events messages.EventSink = messages.NopEventSink{}
+	// delivery events are only published when a queue is configured
+	if e.EventsAMQPAddr != "" {
+		publisher, err := jobqueue2.NewPublisher(ctx, e.EventsQueue, e.EventsAMQPAddr, backoff.NewExponentialBackOff())
+		if err != nil {
+			lg.ErrorF(err.Error())
+			os.Exit(5)
+		}
+		sink := messages.NewQueueEventSink(ctx, publisher, eventBufferSize)
+		defer sink.Stop()
+		events = sink
+	}
+
+	// expiring certificates are reported before they break the deliveries
+	if expiries, err := messages.CertificateExpiries(ctx, db); err != nil {
+		lg.WarnF("error checking callback URL certificates: %v", err.Error())
+	} else {
+		now := time.Now()
+		for _, c := range expiries {
+			if c.Error != "" {
+				lg.WarnF("%s certificate %s of callback URL %d is unreadable: %s", c.Kind, c.Path, c.CallbackURLID, c.Error)
+			} else if c.ExpiresWithin(now, e.CertExpiryWarning) {
+				lg.WarnF("%s certificate %s of callback URL %d expires at %s", c.Kind, c.Path, c.CallbackURLID, c.NotAfter.Format(time.RFC3339))
+			}
+		}
+	}
+
+	secrets, err := secret.ParseKey(e.SecretsKey)
 	if err != nil {
 		lg.ErrorF(err.Error())
-		os.Exit(3)
+		os.Exit(7)
 	}
-	lg.InfoF("retrieved %v messages to retry", len(messageSlice))
 
-	if err = messages.MarkMessagesPending(ctx, db, messageSlice); err != nil {
+	keys, err := secret.LoadKeyring(e.KeyringFile)
+	if err != nil {
 		lg.ErrorF(err.Error())
-		os.Exit(4)
+		os.Exit(8)
 	}
 
-	messageChannel := make(chan *bmodels.Message, goRoutineCap)
-	var wg sync.WaitGroup
-	for i := 1; i <= goRoutineCap; i++ {
-		wg.Add(1)
-		go func(num int) {
-			defer wg.Done()
-			lg.InfoF("Starting runner %d", num)
+	r := retrier{
+		db:     db,
+		e:      e,
+		events: events,
+		auth:   messages.NewAuthenticators(keys, secrets, &http.Client{Timeout: e.ClientTimeout}),
+		keys:   keys,
+	}
 
-			httpClient := http.DefaultClient
-			httpClient.Timeout = e.ClientTimeout
-			client := messages.CallbackClient{
-				Client: httpClient,
-			}
+	if *watch {
+		stopped, stop := context.WithCancel(ctx)
+		osSignals := make(chan os.Signal, 1)
+		signal.Notify(osSignals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			s := <-osSignals
+			lg.InfoF("%v received, stopping retries", s)
+			stop()
+		}()
+		go r.sweepWhileLeading(stopped)
+		r.watch(ctx, stopped)
+		lg.InfoF("end retry callbacks")
+		return
+	}
 
-			for message := range messageChannel {
-				lg.InfoF("starting callback %v", message.ID)
-				if err := client.DoCallback(ctx, db, message); err != nil {
-					lg.ErrorF("error doing callback for %v: %v", message.ID, err.Error())
-				}
-				lg.InfoF("sent callback %v", message.ID)
-			}
-			lg.InfoF("End runner %d", num)
-		}(i)
+	if err := lead(ctx, db, e, "sweep", r.sweep); err != nil {
+		lg.ErrorF(err.Error())
 	}
-	for _, m := range messageSlice {
-		messageChannel <- m
+	retried, err := r.retryDue(ctx)
+	lg.InfoF("end retry callbacks, retried %v messages", retried)
+	if err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(3)
 	}
-	close(messageChannel)
-	wg.Wait()
-
-	lg.InfoF("end retry callbacks")
 }
 
 type envVar struct {
-	DBAddr        string        `env:"DATABASE_URL"`
-	ClientTimeout time.Duration `env:"CLIENT_TIMEOUT"`
+	DBAddr         string        `env:"DATABASE_URL,secret"`
+	ClientTimeout  time.Duration `env:"CLIENT_TIMEOUT,default=10s"`
+	HashBusinessID bool          `env:"METRICS_HASH_BUSINESS_ID,default=false"`
+	MetricsAddr    string        `env:"METRICS_ADDR,optional"`
+	EventsAMQPAddr string        `env:"EVENTS_AMQP_URL,optional,secret"`
+	EventsQueue    string        `env:"EVENTS_QUEUE,optional"`
+	// key file sealing the merchant tokens, the payloads and the auth settings of the callback URLs, tokens and
+	// payloads are stored in plaintext when not set
+	KeyringFile string `env:"KEYRING_FILE,optional"`
+	// base64 AES-256 key opening the auth settings sealed before the keyring, until rekey seals them again
+	SecretsKey string `env:"SECRETS_KEY,optional,secret"`
+	// due messages claimed per statement, and retried per run so that a backlog is worked off over several runs
+	RetryBatchSize int `env:"RETRY_BATCH_SIZE,default=500"`
+	RetryMaxPerRun int `env:"RETRY_MAX_PER_RUN,default=20000"`
+	// the due messages are looked for at least this often with -watch, on top of the notified due times
+	RetryPollInterval time.Duration `env:"RETRY_POLL_INTERVAL,default=1m"`
+	// the leader of a maintenance job checks it still holds its lock this often
+	LeaderRenewInterval time.Duration `env:"LEADER_RENEW_INTERVAL,default=10s"`
+	// retried messages pending for longer, e.g. claimed by a replica which stopped, are retried again. It must be
+	// beyond twice the longest client timeout, which a delivery with OAuth2 may take. The leader of the sweep looks for
+	// them this often with -watch
+	StuckPendingAfter time.Duration `env:"STUCK_PENDING_AFTER,default=15m"`
+	SweepInterval     time.Duration `env:"SWEEP_INTERVAL,default=5m"`
+	// delivered messages of the merchants without retention are purged after this many days, the partitions of
+	// messages are detached after the longest retention
+	RetentionDays int `env:"RETENTION_DAYS,default=90"`
+	// default directory of the archive of the purged messages, they are not archived when not set
+	ArchiveDir string `env:"ARCHIVE_DIR,optional"`
+	// callback URL certificates expiring within this window are logged
+	CertExpiryWarning time.Duration `env:"CERT_EXPIRY_WARNING,default=720h"`
+	Trace             trace.Config  `env:"TRACE_"`
+	Log               loglib.Config `env:"LOG_"`
 }
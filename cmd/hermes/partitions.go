@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/kagelui/notification/internal/pkg/loglib"
+	"github.com/kagelui/notification/internal/service/messages"
+)
+
+// partitions creates the monthly partitions of the coming months and detaches the partitions past the longest
+// retention, e.g. hermes partitions -drop
+func partitions(ctx context.Context, db *sqlx.DB, e envVar, args []string) error {
+	lg := loglib.GetLogger(ctx)
+
+	fs := flag.NewFlagSet("partitions", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "report the partitions to create and detach without changing them")
+	ahead := fs.Int("ahead", 3, "months whose partitions are created ahead of the current month")
+	detach := fs.Bool("detach", true, "detach the partitions past the longest retention")
+	drop := fs.Bool("drop", false, "drop the detached partitions instead of keeping them as standalone tables")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	opts := messages.PartitionOptions{Ahead: *ahead, Drop: *drop, DryRun: *dryRun}
+	if *detach {
+		opts.RetentionDays = e.RetentionDays
+	}
+	report, err := messages.MaintainPartitions(ctx, db, time.Now(), opts)
+	for _, p := range report.Created {
+		lg.InfoF("created partition %s from %s to %s, dry run: %v", p.Name, p.From.Format(time.RFC3339), p.To.Format(time.RFC3339), *dryRun)
+	}
+	for _, p := range report.Detached {
+		lg.InfoF("detached partition %s from %s to %s, dropped: %v, dry run: %v", p.Name, p.From.Format(time.RFC3339), p.To.Format(time.RFC3339), *drop, *dryRun)
+	}
+	return err
+}
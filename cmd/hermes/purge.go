@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/kagelui/notification/internal/pkg/loglib"
+	"github.com/kagelui/notification/internal/service/messages"
+)
+
+// purge deletes the delivered messages past the retention of their merchant, archiving them first when an archive
+// directory is set, e.g. hermes purge -archive-dir /var/archive
+func purge(ctx context.Context, db *sqlx.DB, e envVar, args []string) error {
+	lg := loglib.GetLogger(ctx)
+
+	fs := flag.NewFlagSet("purge", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "report the messages past their retention without deleting them")
+	batchSize := fs.Int("batch-size", 1000, "messages deleted per transaction")
+	archiveDir := fs.String("archive-dir", e.ArchiveDir, "directory of the gzip compressed NDJSON archive of the deleted messages")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	opts := messages.PurgeOptions{RetentionDays: e.RetentionDays, BatchSize: *batchSize, DryRun: *dryRun}
+	if *archiveDir != "" && !*dryRun {
+		archive, err := messages.CreateArchive(*archiveDir, now)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := archive.Close(); err != nil {
+				lg.ErrorF("closing archive %s: %v", archive.Path, err.Error())
+			}
+		}()
+		opts.Archive = archive
+		lg.InfoF("archiving purged messages to %s", archive.Path)
+	}
+
+	lg.InfoF("starting purge with a default retention of %d days, dry run: %v", e.RetentionDays, *dryRun)
+	report, err := messages.Purge(ctx, db, now, opts)
+	businessIDs := make([]string, 0, len(report.ByMerchant))
+	for businessID := range report.ByMerchant {
+		businessIDs = append(businessIDs, businessID)
+	}
+	sort.Strings(businessIDs)
+	for _, businessID := range businessIDs {
+		lg.InfoF("%d messages of merchant %s past their retention", report.ByMerchant[businessID], businessID)
+	}
+	if *dryRun {
+		lg.InfoF("%d messages would be purged", report.Messages)
+	} else {
+		lg.InfoF("purged %d messages", report.Messages)
+	}
+	return err
+}
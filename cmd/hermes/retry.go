@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/kagelui/notification/internal/models/bmodels"
+	"github.com/kagelui/notification/internal/pkg/loglib"
+	"github.com/kagelui/notification/internal/pkg/secret"
+	"github.com/kagelui/notification/internal/pkg/trace"
+	"github.com/kagelui/notification/internal/pkg/wakeup"
+	"github.com/kagelui/notification/internal/service/messages"
+)
+
+// retryBackoff delays the next run of the watch when a run retried nothing, e.g. as the due messages were claimed by
+// another replica meanwhile, so that it does not spin on the due times it cannot claim
+const retryBackoff = 5 * time.Second
+
+// retrier retries the due failed messages
+type retrier struct {
+	db     *sqlx.DB
+	e      envVar
+	events messages.EventSink
+	// shared by the runners so that OAuth2 tokens are requested once per process
+	auth *messages.Authenticators
+	keys *secret.Keyring
+}
+
+// retryDue retries the messages due now, at most RETRY_MAX_PER_RUN of them, and returns the number retried
+func (r retrier) retryDue(ctx context.Context) (int, error) {
+	lg := loglib.GetLogger(ctx)
+	backlog, err := messages.CountRetryMessages(ctx, r.db)
+	if err != nil {
+		return 0, err
+	}
+	messages.RetryBacklog.Set(float64(backlog))
+	if backlog == 0 {
+		return 0, nil
+	}
+	lg.InfoF("%v messages to retry, at most %v are retried by this run", backlog, r.e.RetryMaxPerRun)
+
+	messageChannel := make(chan *bmodels.Message, goRoutineCap)
+	var wg sync.WaitGroup
+	for i := 1; i <= goRoutineCap; i++ {
+		wg.Add(1)
+		go func(num int) {
+			defer wg.Done()
+			lg.DebugF("Starting runner %d", num)
+
+			client := messages.CallbackClient{
+				Client: &http.Client{Timeout: r.e.ClientTimeout},
+				Events: r.events,
+				Auth:   r.auth,
+				Keys:   r.keys,
+			}
+
+			for message := range messageChannel {
+				// logs the request ID and trace of the original request
+				mctx := messages.MessageContext(ctx, message)
+				mlg := loglib.GetLogger(mctx)
+				// the message may have waited for a runner past STUCK_PENDING_AFTER
+				if started, err := messages.StartRetry(mctx, r.db, message); err != nil {
+					mlg.ErrorF("error starting callback %v: %v", message.ID, err.Error())
+					continue
+				} else if !started {
+					mlg.WarnF("skipping callback %v, it was swept before a runner was free", message.ID)
+					continue
+				}
+				mlg.InfoF("starting callback %v", message.ID)
+				if err := client.DoCallback(mctx, r.db, message); err != nil {
+					mlg.ErrorF("error doing callback for %v: %v", message.ID, err.Error())
+				}
+				mlg.InfoF("sent callback %v", message.ID)
+			}
+			lg.DebugF("End runner %d", num)
+		}(i)
+	}
+	// the due messages are claimed batch by batch as the runners free up, so that memory stays flat
+	retried, claimErr := 0, error(nil)
+	cursor := messages.RetryCursor{}
+	for retried < r.e.RetryMaxPerRun {
+		limit := r.e.RetryBatchSize
+		if left := r.e.RetryMaxPerRun - retried; left < limit {
+			limit = left
+		}
+		spanCtx, span := trace.StartSpan(ctx, "retry.claim")
+		var batch []*bmodels.Message
+		batch, cursor, claimErr = messages.ClaimRetryBatch(spanCtx, r.db, cursor, limit)
+		span.SetAttribute("messages", len(batch))
+		span.RecordError(claimErr)
+		span.End()
+		if claimErr != nil {
+			lg.ErrorF("error claiming messages to retry: %v", claimErr.Error())
+			break
+		}
+		lg.InfoF("claimed %v messages to retry", len(batch))
+		for _, m := range batch {
+			messageChannel <- m
+		}
+		retried += len(batch)
+		if len(batch) < limit {
+			break
+		}
+	}
+	close(messageChannel)
+	wg.Wait()
+	return retried, claimErr
+}
+
+// watch retries the due messages until the context is done. It wakes up when the earliest due time known is
+// reached, the due times being notified by the database, and at least every RETRY_POLL_INTERVAL. The retries run
+// with ctx, so that the messages claimed are retried before it returns once stopped is done
+func (r retrier) watch(ctx, stopped context.Context) {
+	lg := loglib.GetLogger(ctx)
+	scheduler := wakeup.NewScheduler(r.e.RetryPollInterval)
+	go func() {
+		if err := messages.ListenRetries(stopped, r.e.DBAddr, scheduler); err != nil {
+			// the polling still retries the messages, only later
+			lg.ErrorF("error listening to retry notifications: %v", err.Error())
+		}
+	}()
+
+	for {
+		retried, err := r.retryDue(ctx)
+		if err != nil {
+			// the next wake-up tries again
+			lg.ErrorF("error retrying messages: %v", err.Error())
+		} else if retried > 0 {
+			lg.InfoF("retried %v messages", retried)
+		}
+		if retried >= r.e.RetryMaxPerRun {
+			// the backlog is worked off without waiting
+			scheduler.Schedule(time.Now())
+		} else if next, ok, err := messages.NextRetryTime(ctx, r.db); err != nil {
+			lg.ErrorF("error finding the next retry: %v", err.Error())
+		} else if ok {
+			if earliest := time.Now().Add(retryBackoff); retried == 0 && next.Before(earliest) {
+				next = earliest
+			}
+			scheduler.Schedule(next)
+		}
+		if err := scheduler.Wait(stopped); err != nil {
+			return
+		}
+	}
+}
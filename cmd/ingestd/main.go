@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/jmoiron/sqlx"
+	"github.com/kagelui/notification/cmd/serverd/handler"
+	"github.com/kagelui/notification/internal/pkg/envvar"
+	"github.com/kagelui/notification/internal/pkg/loglib"
+	jobqueue2 "github.com/kagelui/notification/internal/pkg/queue"
+	"github.com/kagelui/notification/internal/pkg/secret"
+	"github.com/kagelui/notification/internal/pkg/trace"
+	"github.com/kagelui/notification/internal/service/messages"
+	_ "github.com/lib/pq"
+)
+
+const eventBufferSize = 1000
+
+var (
+	configFile  = flag.String("config", os.Getenv("CONFIG_FILE"), "optional YAML or TOML config file, env vars take precedence")
+	printConfig = flag.Bool("print-config", false, "print the effective config with secrets redacted and exit")
+)
+
+func main() {
+	flag.Parse()
+
+	lg := loglib.DefaultLogger()
+	ctx := loglib.SetLogger(context.Background(), lg)
+
+	lg.InfoF("starting callback ingestion...")
+
+	var e envVar
+
+	if err := envvar.Read(&e, envvar.WithFile(*configFile)); err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(1)
+	}
+
+	if *printConfig {
+		if err := envvar.Print(os.Stdout, &e); err != nil {
+			lg.ErrorF(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := loglib.Configure(e.Log); err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(1)
+	}
+
+	// spans are only exported when an exporter is configured
+	if e.Trace.Exporter != "" {
+		exporter, err := trace.NewExporter(e.Trace.Exporter, "ingestd", e.Trace.OTLPEndpoint, e.Trace.File)
+		if err != nil {
+			lg.ErrorF(err.Error())
+			os.Exit(4)
+		}
+		trace.SetExporter(exporter)
+		defer trace.Shutdown(context.Background())
+	}
+
+	db, err := sqlx.Connect("postgres", e.DBAddr)
+	if err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(2)
+	}
+
+	rules, err := handler.LoadPayloadRules(e.AllowedProductTypes, e.PayloadSchemaDir)
+	if err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(5)
+	}
+
+	secrets, err := secret.ParseKey(e.SecretsKey)
+	if err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(6)
+	}
+
+	keys, err := secret.LoadKeyring(e.KeyringFile)
+	if err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(7)
+	}
+
+	modelStore := &messages.ModelStore{DB: db, Auth: messages.NewAuthenticators(keys, secrets, &http.Client{Timeout: e.ClientTimeout}), Keys: keys}
+
+	// delivery events are only published when a queue is configured
+	if e.EventsAMQPAddr != "" {
+		publisher, err := jobqueue2.NewPublisher(ctx, e.EventsQueue, e.EventsAMQPAddr, backoff.NewExponentialBackOff())
+		if err != nil {
+			lg.ErrorF(err.Error())
+			os.Exit(8)
+		}
+		sink := messages.NewQueueEventSink(ctx, publisher, eventBufferSize)
+		defer sink.Stop()
+		modelStore.Events = sink
+	}
+
+	// messages are acknowledged only after the worker func returns, i.e. after the message is committed, the
+	// messages which cannot be stored are kept in the dead-letter queue
+	stop, err := jobqueue2.NewWorker(ctx, e.QueueName, e.AMQPAddr, backoff.NewExponentialBackOff(), false,
+		handler.ConsumeCallback(modelStore, rules, e.ClientTimeout), jobqueue2.WithDeadLetter())
+	if err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(3)
+	}
+
+	osSignals := make(chan os.Signal, 1)
+	signal.Notify(osSignals, os.Interrupt, syscall.SIGTERM)
+	s := <-osSignals
+	lg.InfoF("%v received, stopping callback ingestion", s)
+
+	stop()
+	lg.InfoF("end callback ingestion")
+}
+
+type envVar struct {
+	DBAddr        string        `env:"DATABASE_URL,secret"`
+	AMQPAddr      string        `env:"AMQP_URL,secret"`
+	QueueName     string        `env:"INGEST_QUEUE"`
+	ClientTimeout time.Duration `env:"CLIENT_TIMEOUT,default=10s"`
+	// delivery outcomes are published to this queue when set
+	EventsAMQPAddr string `env:"EVENTS_AMQP_URL,optional,secret"`
+	EventsQueue    string `env:"EVENTS_QUEUE,optional"`
+	// product_id=type1|type2 pairs restricting the product types of the products
+	AllowedProductTypes map[string]string `env:"ALLOWED_PRODUCT_TYPES,optional"`
+	// key file sealing the merchant tokens, the payloads and the auth settings of the callback URLs, tokens and
+	// payloads are stored in plaintext when not set
+	KeyringFile string `env:"KEYRING_FILE,optional"`
+	// base64 AES-256 key opening the auth settings sealed before the keyring, until rekey seals them again
+	SecretsKey       string        `env:"SECRETS_KEY,optional,secret"`
+	PayloadSchemaDir string        `env:"PAYLOAD_SCHEMA_DIR,optional"`
+	Trace            trace.Config  `env:"TRACE_"`
+	Log              loglib.Config `env:"LOG_"`
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/kagelui/notification/internal/pkg/envvar"
+	"github.com/kagelui/notification/internal/pkg/loglib"
+	"github.com/kagelui/notification/internal/pkg/secret"
+	"github.com/kagelui/notification/internal/service/messages"
+	_ "github.com/lib/pq"
+)
+
+var (
+	configFile  = flag.String("config", os.Getenv("CONFIG_FILE"), "optional YAML or TOML config file, env vars take precedence")
+	printConfig = flag.Bool("print-config", false, "print the effective config with secrets redacted and exit")
+	batchSize   = flag.Int("batch-size", 500, "rows sealed per transaction")
+	dryRun      = flag.Bool("dry-run", false, "open the values without sealing them again")
+	decrypt     = flag.Bool("decrypt", false, "store the values in plaintext, e.g. before rolling the encryption back, the callback auth settings are sealed by SECRETS_KEY")
+)
+
+// rekey seals the merchant tokens, the payloads and the callback auth settings stored in plaintext, sealed by
+// SECRETS_KEY or sealed by a retired key with the primary key of the keyring, it is run once the keyring is configured
+// and after every key rotation
+func main() {
+	flag.Parse()
+
+	lg := loglib.DefaultLogger()
+	ctx := loglib.SetLogger(context.Background(), lg)
+
+	var e envVar
+
+	if err := envvar.Read(&e, envvar.WithFile(*configFile)); err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(1)
+	}
+
+	if *printConfig {
+		if err := envvar.Print(os.Stdout, &e); err != nil {
+			lg.ErrorF(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := loglib.Configure(e.Log); err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(1)
+	}
+
+	keys, err := secret.LoadKeyring(e.KeyringFile)
+	if err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(3)
+	}
+	secrets, err := secret.ParseKey(e.SecretsKey)
+	if err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(3)
+	}
+
+	db, err := sqlx.Connect("postgres", e.DBAddr)
+	if err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(2)
+	}
+	defer db.Close()
+
+	lg.InfoF("starting rekey with key %s, dry run: %v, decrypt: %v", keys.Primary(), *dryRun, *decrypt)
+	report, err := messages.Rekey(ctx, db, keys, messages.RekeyOptions{
+		BatchSize: *batchSize, DryRun: *dryRun, Decrypt: *decrypt, Secrets: secrets,
+	})
+	lg.InfoF("rekeyed %d merchants, %d merchant tokens, %d messages and %d callback URLs",
+		report.Merchants, report.MerchantTokens, report.Messages, report.CallbackURLs)
+	if err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(4)
+	}
+	lg.InfoF("end rekey")
+}
+
+type envVar struct {
+	DBAddr      string `env:"DATABASE_URL,secret"`
+	KeyringFile string `env:"KEYRING_FILE"`
+	// base64 AES-256 key opening the auth settings sealed before the keyring, and sealing them with -decrypt
+	SecretsKey string        `env:"SECRETS_KEY,optional,secret"`
+	Log        loglib.Config `env:"LOG_"`
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kagelui/notification/internal/pkg/web"
+	"github.com/kagelui/notification/internal/service/messages"
+)
+
+type callbackAuthStore interface {
+	SetCallbackAuth(ctx context.Context, callbackURLID int, authType string, cfg messages.AuthConfig) error
+}
+
+type callbackAuthRequest struct {
+	Type   string              `json:"type"`
+	Config messages.AuthConfig `json:"config"`
+}
+
+// SetCallbackAuth sets the auth strategy of the callback URL identified by the id route variable, its secrets are
+// stored sealed and never returned. An empty type removes the auth
+func SetCallbackAuth(store callbackAuthStore) web.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			return messages.ErrUnknownCallbackURL
+		}
+		req := callbackAuthRequest{}
+		if er := json.NewDecoder(r.Body).Decode(&req); er != nil {
+			return errParsingRequest
+		}
+
+		if err := store.SetCallbackAuth(r.Context(), id, req.Type, req.Config); err != nil {
+			var webErr *web.Error
+			if errors.As(err, &webErr) {
+				return webErr
+			}
+			return web.NewError(err, "error setting callback auth")
+		}
+		web.RespondJSON(r.Context(), w, "ok", nil)
+		return nil
+	}
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/kagelui/notification/internal/pkg/web"
+	"github.com/kagelui/notification/internal/service/messages"
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+type mockCallbackAuthStore struct {
+	T        *testing.T
+	ID       int
+	AuthType string
+	Config   messages.AuthConfig
+	Err      error
+}
+
+func (s mockCallbackAuthStore) SetCallbackAuth(_ context.Context, callbackURLID int, authType string, cfg messages.AuthConfig) error {
+	testutil.Equals(s.T, s.ID, callbackURLID)
+	testutil.Equals(s.T, s.AuthType, authType)
+	testutil.Equals(s.T, s.Config, cfg)
+	return s.Err
+}
+
+func TestSetCallbackAuth(t *testing.T) {
+	oauth2 := messages.AuthConfig{TokenURL: "https://bank/token", ClientID: "client", ClientSecret: "s3cret", Scopes: []string{"callbacks:write"}}
+	oauth2Body := `{"type":"oauth2","config":{"token_url":"https://bank/token","client_id":"client","client_secret":"s3cret","scopes":["callbacks:write"]}}`
+	tests := []struct {
+		name         string
+		id           string
+		body         string
+		store        mockCallbackAuthStore
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "invalid id",
+			id:           "abc",
+			body:         oauth2Body,
+			expectedCode: http.StatusNotFound,
+			expectedBody: `{"error":"unknown_callback_url","error_description":"no callback URL is registered with the ID"}`,
+		},
+		{
+			name:         "bad request",
+			id:           "7",
+			body:         "random string",
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":"400 Bad Request","error_description":"cannot parse request"}`,
+		},
+		{
+			name:         "invalid settings",
+			id:           "7",
+			body:         `{"type":"basic"}`,
+			store:        mockCallbackAuthStore{ID: 7, AuthType: messages.AuthTypeBasic, Err: web.NewValidationError([]web.FieldError{{Field: "config.username", Code: "required", Message: "username is required"}})},
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedBody: `{"error":"validation_failed","error_description":"request validation failed"}`,
+		},
+		{
+			name:         "naughty store",
+			id:           "7",
+			body:         oauth2Body,
+			store:        mockCallbackAuthStore{ID: 7, AuthType: messages.AuthTypeOAuth2, Config: oauth2, Err: fmt.Errorf("mock error")},
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "all good",
+			id:           "7",
+			body:         oauth2Body,
+			store:        mockCallbackAuthStore{ID: 7, AuthType: messages.AuthTypeOAuth2, Config: oauth2},
+			expectedCode: http.StatusOK,
+			expectedBody: `"ok"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.store.T = t
+			req := httptest.NewRequest(http.MethodPut, "/admin/callback-urls/"+tt.id+"/auth", bytes.NewBufferString(tt.body))
+			req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+			rr := httptest.NewRecorder()
+			WrapError(SetCallbackAuth(tt.store)).ServeHTTP(rr, req)
+
+			testutil.Equals(t, tt.expectedCode, rr.Code)
+			if tt.expectedBody != "" {
+				testutil.Equals(t, tt.expectedBody, string(bytes.TrimSpace(rr.Body.Bytes())))
+			}
+		})
+	}
+}
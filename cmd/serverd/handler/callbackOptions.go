@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kagelui/notification/internal/pkg/web"
+	"github.com/kagelui/notification/internal/service/messages"
+)
+
+type callbackOptionsStore interface {
+	SetCallbackOptions(ctx context.Context, callbackURLID int, opts messages.RequestOptions) error
+}
+
+type callbackOptionsRequest struct {
+	Headers     map[string]string `json:"headers"`
+	TokenHeader string            `json:"token_header"`
+	Method      string            `json:"method"`
+	// Timeout is a duration such as 5s, CLIENT_TIMEOUT applies when empty
+	Timeout string `json:"timeout"`
+	Gzip    bool   `json:"gzip"`
+}
+
+// SetCallbackOptions replaces the request options of the callback URL identified by the id route variable
+func SetCallbackOptions(store callbackOptionsStore) web.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			return messages.ErrUnknownCallbackURL
+		}
+		req := callbackOptionsRequest{}
+		if er := json.NewDecoder(r.Body).Decode(&req); er != nil {
+			return errParsingRequest
+		}
+		opts := messages.RequestOptions{Headers: req.Headers, TokenHeader: req.TokenHeader, Method: req.Method, Gzip: req.Gzip}
+		if req.Timeout != "" {
+			if opts.Timeout, err = time.ParseDuration(req.Timeout); err != nil {
+				return web.NewValidationError([]web.FieldError{{Field: "timeout", Code: "invalid_timeout", Message: "timeout must be a duration such as 5s"}})
+			}
+		}
+
+		if err := store.SetCallbackOptions(r.Context(), id, opts); err != nil {
+			var webErr *web.Error
+			if errors.As(err, &webErr) {
+				return webErr
+			}
+			return web.NewError(err, "error setting callback options")
+		}
+		web.RespondJSON(r.Context(), w, "ok", nil)
+		return nil
+	}
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kagelui/notification/internal/service/messages"
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+type mockCallbackOptionsStore struct {
+	T       *testing.T
+	ID      int
+	Options messages.RequestOptions
+	Err     error
+}
+
+func (s mockCallbackOptionsStore) SetCallbackOptions(_ context.Context, callbackURLID int, opts messages.RequestOptions) error {
+	testutil.Equals(s.T, s.ID, callbackURLID)
+	testutil.Equals(s.T, s.Options, opts)
+	return s.Err
+}
+
+func TestSetCallbackOptions(t *testing.T) {
+	opts := messages.RequestOptions{Headers: map[string]string{"X-Gateway-Key": "abc"}, TokenHeader: "X-Token", Method: http.MethodPut, Timeout: 5 * time.Second, Gzip: true}
+	body := `{"headers":{"X-Gateway-Key":"abc"},"token_header":"X-Token","method":"PUT","timeout":"5s","gzip":true}`
+	tests := []struct {
+		name         string
+		id           string
+		body         string
+		store        mockCallbackOptionsStore
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "invalid id",
+			id:           "abc",
+			body:         body,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "bad request",
+			id:           "7",
+			body:         "random string",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid timeout",
+			id:           "7",
+			body:         `{"timeout":"soon"}`,
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "naughty store",
+			id:           "7",
+			body:         body,
+			store:        mockCallbackOptionsStore{ID: 7, Options: opts, Err: fmt.Errorf("mock error")},
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "all good",
+			id:           "7",
+			body:         body,
+			store:        mockCallbackOptionsStore{ID: 7, Options: opts},
+			expectedCode: http.StatusOK,
+			expectedBody: `"ok"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.store.T = t
+			req := httptest.NewRequest(http.MethodPut, "/admin/callback-urls/"+tt.id+"/options", bytes.NewBufferString(tt.body))
+			req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+			rr := httptest.NewRecorder()
+			WrapError(SetCallbackOptions(tt.store)).ServeHTTP(rr, req)
+
+			testutil.Equals(t, tt.expectedCode, rr.Code)
+			if tt.expectedBody != "" {
+				testutil.Equals(t, tt.expectedBody, string(bytes.TrimSpace(rr.Body.Bytes())))
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/kagelui/notification/internal/pkg/web"
+	"github.com/kagelui/notification/internal/service/messages"
+)
+
+type certificateStore interface {
+	CertificateExpiries(ctx context.Context) ([]messages.CertificateExpiry, error)
+}
+
+type certificateStatus struct {
+	messages.CertificateExpiry
+	Expiring bool `json:"expiring"`
+}
+
+type certificatesResponse struct {
+	Certificates []certificateStatus `json:"certificates"`
+}
+
+// ListCertificates reports the certificates of the callback URLs, flagging the unreadable ones and those expiring
+// within warnWithin. The window is overridden by the within query parameter, e.g. ?within=168h, and
+// ?expiring=true only lists the flagged certificates
+func ListCertificates(store certificateStore, warnWithin time.Duration) web.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		query := r.URL.Query()
+		window := warnWithin
+		if within := query.Get("within"); within != "" {
+			d, err := time.ParseDuration(within)
+			if err != nil {
+				return errInvalidQuery
+			}
+			window = d
+		}
+		onlyExpiring := query.Get("expiring") == "true"
+
+		expiries, err := store.CertificateExpiries(r.Context())
+		if err != nil {
+			return web.NewError(err, "error listing certificates")
+		}
+		now := time.Now()
+		resp := certificatesResponse{Certificates: []certificateStatus{}}
+		for _, e := range expiries {
+			expiring := e.ExpiresWithin(now, window)
+			if onlyExpiring && !expiring {
+				continue
+			}
+			resp.Certificates = append(resp.Certificates, certificateStatus{CertificateExpiry: e, Expiring: expiring})
+		}
+		web.RespondJSON(r.Context(), w, resp, nil)
+		return nil
+	}
+}
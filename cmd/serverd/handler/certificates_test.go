@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kagelui/notification/internal/service/messages"
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+type mockCertificateStore struct {
+	expiries []messages.CertificateExpiry
+	err      error
+}
+
+func (s mockCertificateStore) CertificateExpiries(context.Context) ([]messages.CertificateExpiry, error) {
+	return s.expiries, s.err
+}
+
+func TestListCertificates(t *testing.T) {
+	now := time.Now()
+	expiries := []messages.CertificateExpiry{
+		{CallbackURLID: 1, Kind: messages.CertificateKindCA, Path: "/certs/missing.crt", Error: "no such file"},
+		{CallbackURLID: 2, Kind: messages.CertificateKindClient, Path: "/certs/soon.crt", NotAfter: now.Add(24 * time.Hour)},
+		{CallbackURLID: 3, Kind: messages.CertificateKindClient, Path: "/certs/later.crt", NotAfter: now.Add(60 * 24 * time.Hour)},
+	}
+	tests := []struct {
+		name         string
+		query        string
+		store        mockCertificateStore
+		expectedCode int
+		wantIDs      []int
+		wantExpiring []bool
+	}{
+		{
+			name:         "naughty store",
+			store:        mockCertificateStore{err: fmt.Errorf("mock error")},
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "invalid window",
+			query:        "?within=soon",
+			store:        mockCertificateStore{expiries: expiries},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "none",
+			store:        mockCertificateStore{},
+			expectedCode: http.StatusOK,
+			wantIDs:      []int{},
+			wantExpiring: []bool{},
+		},
+		{
+			name:         "default window",
+			store:        mockCertificateStore{expiries: expiries},
+			expectedCode: http.StatusOK,
+			wantIDs:      []int{1, 2, 3},
+			wantExpiring: []bool{true, true, false},
+		},
+		{
+			name:         "expiring within a longer window",
+			query:        "?within=2160h&expiring=true",
+			store:        mockCertificateStore{expiries: expiries},
+			expectedCode: http.StatusOK,
+			wantIDs:      []int{1, 2, 3},
+			wantExpiring: []bool{true, true, true},
+		},
+		{
+			name:         "expiring only",
+			query:        "?expiring=true",
+			store:        mockCertificateStore{expiries: expiries},
+			expectedCode: http.StatusOK,
+			wantIDs:      []int{1, 2},
+			wantExpiring: []bool{true, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/certificates"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			WrapError(ListCertificates(tt.store, 30*24*time.Hour)).ServeHTTP(rr, req)
+
+			testutil.Equals(t, tt.expectedCode, rr.Code)
+			if rr.Code != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Certificates []struct {
+					CallbackURLID int  `json:"callback_url_id"`
+					Expiring      bool `json:"expiring"`
+				} `json:"certificates"`
+			}
+			testutil.Ok(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			ids, expiring := []int{}, []bool{}
+			for _, c := range resp.Certificates {
+				ids = append(ids, c.CallbackURLID)
+				expiring = append(expiring, c.Expiring)
+			}
+			testutil.Equals(t, tt.wantIDs, ids)
+			testutil.Equals(t, tt.wantExpiring, expiring)
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/google/uuid"
+	"github.com/kagelui/notification/internal/pkg/loglib"
+	jobqueue2 "github.com/kagelui/notification/internal/pkg/queue"
+	"github.com/kagelui/notification/internal/pkg/trace"
+	"github.com/kagelui/notification/internal/service/messages"
+	"github.com/pkg/errors"
+)
+
+// storeMaxElapsedTime bounds how long a consumed message retries the store before being requeued
+const storeMaxElapsedTime = 30 * time.Second
+
+// ConsumeCallback returns a jobqueue2 worker func which stores the consumed callback request then performs the callback.
+// Malformed or invalid requests and unknown merchants are dead-lettered, other store errors requeue the message
+func ConsumeCallback(store messageStore, rules *PayloadRules, timeout time.Duration) func(ctx context.Context, b []byte) error {
+	return func(ctx context.Context, b []byte) error {
+		// every consumed request starts its own correlation
+		requestID := uuid.New().String()
+		ctx, span := trace.StartSpan(trace.WithRequestID(ctx, requestID), "ingest")
+		span.SetKind(trace.SpanKindServer)
+		defer span.End()
+		ctx = loglib.SetLogger(ctx, loglib.GetLogger(ctx).WithFields(map[string]interface{}{
+			"request_id": requestID,
+			"trace_id":   span.SpanContext().TraceID,
+		}))
+
+		req := callbackRequest{}
+		if err := json.Unmarshal(b, &req); err != nil {
+			return errors.Wrap(err, "dropping malformed callback request")
+		}
+		fieldErrors, err := rules.validateRequest(req)
+		if err != nil {
+			return errors.Wrap(err, "dropping callback request")
+		}
+		if len(fieldErrors) > 0 {
+			return errors.Errorf("dropping invalid callback request: %v", describeFieldErrors(fieldErrors))
+		}
+
+		bo := backoff.NewExponentialBackOff()
+		bo.MaxElapsedTime = storeMaxElapsedTime
+		err = backoff.Retry(func() error {
+			err := store.InsertCallbackThenDo(ctx, req.ProductID, req.ProductType, req.Payload, req.BusinessID, req.IdempotencyKey, timeout)
+			if errors.Is(err, messages.ErrUnknownMerchant) {
+				return backoff.Permanent(err)
+			}
+			return err
+		}, backoff.WithContext(bo, ctx))
+
+		switch {
+		case err == nil:
+			loglib.GetLogger(ctx).InfoF("stored callback request for %v %v", req.BusinessID, req.ProductID)
+			return nil
+		case errors.Is(err, messages.ErrUnknownMerchant):
+			return errors.Wrapf(err, "dropping callback request for unknown merchant %v", req.BusinessID)
+		default:
+			return jobqueue2.Requeue(errors.Wrap(err, "error storing callback request"))
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kagelui/notification/internal/service/messages"
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+func TestConsumeCallback(t *testing.T) {
+	validRequest, err := json.Marshal(callbackRequest{
+		ProductID:   "abc",
+		ProductType: "efg",
+		Payload:     "{}",
+		BusinessID:  "user00",
+	})
+	testutil.Ok(t, err)
+
+	tests := []struct {
+		name     string
+		body     []byte
+		storeErr error
+		wantErr  string
+	}{
+		{
+			name:    "malformed",
+			body:    []byte("random string"),
+			wantErr: "dropping malformed callback request",
+		},
+		{
+			name:    "invalid",
+			body:    []byte(`{"product_type":"efg","payload":"{}","business_id":"user00"}`),
+			wantErr: "dropping invalid callback request: product_id: product_id is required",
+		},
+		{
+			name:     "unknown merchant",
+			body:     validRequest,
+			storeErr: messages.ErrUnknownMerchant,
+			wantErr:  "dropping callback request for unknown merchant user00",
+		},
+		{
+			name:     "naughty store",
+			body:     validRequest,
+			storeErr: fmt.Errorf("mock error"),
+			wantErr:  "error storing callback request",
+		},
+		{
+			name: "all good",
+			body: validRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := mockMessageStore{
+				T: t,
+				Ms: messageIOSuite{
+					ProductID:   "abc",
+					ProductType: "efg",
+					Payload:     "{}",
+					BusinessID:  "user00",
+					Timeout:     time.Minute,
+					Err:         tt.storeErr,
+				},
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			testutil.CompareError(t, tt.wantErr, ConsumeCallback(store, nil, time.Minute)(ctx, tt.body))
+		})
+	}
+}
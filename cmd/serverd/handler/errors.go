@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/kagelui/notification/internal/pkg/web"
@@ -8,8 +9,25 @@ import (
 
 var (
 	errParsingRequest = &web.Error{
+		Status:      http.StatusBadRequest,
+		Code:        "400 Bad Request",
+		Desc:        "cannot parse request",
+		Title:       "Malformed request body",
+		ProblemCode: web.CodeBadRequest,
+	}
+	errInvalidQuery = &web.Error{
 		Status: http.StatusBadRequest,
-		Code:   "400 Bad Request",
-		Desc:   "cannot parse request",
+		Code:   web.CodeBadRequest,
+		Desc:   "invalid query parameter",
+		Title:  "Invalid query parameter",
 	}
 )
+
+// storeError keeps the catalogued errors of the store
+func storeError(err error, message string) error {
+	var webErr *web.Error
+	if errors.As(err, &webErr) {
+		return webErr
+	}
+	return web.NewError(err, message)
+}
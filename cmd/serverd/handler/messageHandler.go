@@ -3,34 +3,70 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
+	"github.com/kagelui/notification/internal/pkg/trace"
 	"github.com/kagelui/notification/internal/pkg/web"
+	"github.com/kagelui/notification/internal/service/messages"
 )
 
+// idempotencyKeyHeader lets producers retry a request without the callback being stored twice
+const idempotencyKeyHeader = "Idempotency-Key"
+
 type messageStore interface {
-	InsertCallbackThenDo(ctx context.Context, productID, productType, payload, businessID string, timeout time.Duration) error
+	InsertCallbackThenDo(ctx context.Context, productID, productType, payload, businessID, idempotencyKey string, timeout time.Duration) error
 }
 
 type callbackRequest struct {
-	ProductID   string `json:"product_id"`
-	ProductType string `json:"product_type"`
-	Payload     string `json:"payload"`
-	BusinessID  string `json:"business_id"`
+	ProductID      string `json:"product_id" validate:"required,max=64"`
+	ProductType    string `json:"product_type" validate:"required,max=64"`
+	Payload        string `json:"payload" validate:"maxbytes=65536"`
+	BusinessID     string `json:"business_id" validate:"required,max=128"`
+	IdempotencyKey string `json:"idempotency_key,omitempty" validate:"max=255"`
 }
 
-// StoreCallbackThenSend stores the callback and perform the call back
-func StoreCallbackThenSend(store messageStore, timeout time.Duration) web.HandlerFunc {
+// StoreCallbackThenSend validates the callback against the rules, stores it and perform the call back
+func StoreCallbackThenSend(store messageStore, rules *PayloadRules, timeout time.Duration) web.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) error {
+		// the request is traced by the span of the Correlate middleware
+		ctx, span := r.Context(), trace.SpanFromContext(r.Context())
+
 		req := callbackRequest{}
 		if er := json.NewDecoder(r.Body).Decode(&req); er != nil {
+			span.RecordError(er)
+			if web.IsBodyTooLarge(er) {
+				return web.ErrBodyTooLarge
+			}
 			return errParsingRequest
 		}
-		if err := store.InsertCallbackThenDo(r.Context(), req.ProductID, req.ProductType, req.Payload, req.BusinessID, timeout); err != nil {
+		if key := r.Header.Get(idempotencyKeyHeader); key != "" {
+			req.IdempotencyKey = key
+		}
+		span.SetAttribute("business_id", req.BusinessID)
+		span.SetAttribute("product_id", req.ProductID)
+		span.SetAttribute("product_type", req.ProductType)
+
+		fieldErrors, err := rules.validateRequest(req)
+		if err != nil {
+			span.RecordError(err)
+			return web.NewError(err, "error validating request")
+		}
+		if len(fieldErrors) > 0 {
+			validationErr := web.NewValidationError(fieldErrors)
+			span.RecordError(validationErr)
+			return validationErr
+		}
+
+		if err = store.InsertCallbackThenDo(ctx, req.ProductID, req.ProductType, req.Payload, req.BusinessID, req.IdempotencyKey, timeout); err != nil {
+			span.RecordError(err)
+			if errors.Is(err, messages.ErrUnknownMerchant) {
+				return messages.ErrUnknownMerchant
+			}
 			return web.NewError(err, "error performing callback")
 		}
-		web.RespondJSON(r.Context(), w, "ok", nil)
+		web.RespondJSON(ctx, w, "ok", nil)
 		return nil
 	}
 }
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/kagelui/notification/internal/pkg/web"
+	"github.com/kagelui/notification/internal/service/messages"
 	"github.com/kagelui/notification/internal/testutil"
 )
 
@@ -22,14 +23,15 @@ func TestStoreCallbackThenSend(t *testing.T) {
 		name         string
 		args         args
 		request      interface{}
+		headers      map[string]string
 		expectedCode int
 		expectedBody string
 	}{
 		{
-			name:         "bad request",
-			args:         args{
+			name: "bad request",
+			args: args{
 				store: mockMessageStore{
-					T:  t,
+					T: t,
 					Ms: messageIOSuite{
 						ProductID:   "abc",
 						ProductType: "efg",
@@ -46,10 +48,39 @@ func TestStoreCallbackThenSend(t *testing.T) {
 			expectedBody: `{"error":"400 Bad Request","error_description":"cannot parse request"}`,
 		},
 		{
-			name:         "naughty store",
-			args:         args{
+			name: "invalid request",
+			args: args{
+				store:   mockMessageStore{T: t},
+				timeout: time.Minute,
+			},
+			request: callbackRequest{
+				ProductType: "efg",
+				Payload:     "{}",
+				BusinessID:  "user00",
+			},
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedBody: `{"error":"validation_failed","error_description":"request validation failed"}`,
+		},
+		{
+			name: "invalid request problem",
+			args: args{
+				store:   mockMessageStore{T: t},
+				timeout: time.Minute,
+			},
+			request: callbackRequest{
+				ProductType: "efg",
+				Payload:     "{}",
+				BusinessID:  "user00",
+			},
+			headers:      map[string]string{"Accept": web.ProblemContentType},
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedBody: `{"type":"/problems/validation_failed","title":"Validation failed","status":422,"detail":"request validation failed","instance":"/","code":"validation_failed","errors":[{"field":"product_id","code":"required","message":"product_id is required"}]}`,
+		},
+		{
+			name: "naughty store",
+			args: args{
 				store: mockMessageStore{
-					T:  t,
+					T: t,
 					Ms: messageIOSuite{
 						ProductID:   "abc",
 						ProductType: "efg",
@@ -61,7 +92,7 @@ func TestStoreCallbackThenSend(t *testing.T) {
 				},
 				timeout: time.Minute,
 			},
-			request:      callbackRequest{
+			request: callbackRequest{
 				ProductID:   "abc",
 				ProductType: "efg",
 				Payload:     "{}",
@@ -71,10 +102,36 @@ func TestStoreCallbackThenSend(t *testing.T) {
 			expectedBody: `{"error":"internal_error","error_description":"Sorry, there was a problem. Please try again later."}`,
 		},
 		{
-			name:         "all good",
-			args:         args{
+			name: "unknown merchant",
+			args: args{
 				store: mockMessageStore{
-					T:  t,
+					T: t,
+					Ms: messageIOSuite{
+						ProductID:   "abc",
+						ProductType: "efg",
+						Payload:     "{}",
+						BusinessID:  "user00",
+						Timeout:     time.Minute,
+						Err:         messages.ErrUnknownMerchant,
+					},
+				},
+				timeout: time.Minute,
+			},
+			request: callbackRequest{
+				ProductID:   "abc",
+				ProductType: "efg",
+				Payload:     "{}",
+				BusinessID:  "user00",
+			},
+			headers:      map[string]string{"Accept": web.ProblemContentType},
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedBody: `{"type":"/problems/unknown_merchant","title":"Unknown merchant","status":422,"detail":"no merchant is registered with the business ID","instance":"/","code":"unknown_merchant"}`,
+		},
+		{
+			name: "all good",
+			args: args{
+				store: mockMessageStore{
+					T: t,
 					Ms: messageIOSuite{
 						ProductID:   "abc",
 						ProductType: "efg",
@@ -86,7 +143,7 @@ func TestStoreCallbackThenSend(t *testing.T) {
 				},
 				timeout: time.Minute,
 			},
-			request:      callbackRequest{
+			request: callbackRequest{
 				ProductID:   "abc",
 				ProductType: "efg",
 				Payload:     "{}",
@@ -95,14 +152,45 @@ func TestStoreCallbackThenSend(t *testing.T) {
 			expectedCode: http.StatusOK,
 			expectedBody: `"ok"`,
 		},
+		{
+			name: "idempotency key header",
+			args: args{
+				store: mockMessageStore{
+					T: t,
+					Ms: messageIOSuite{
+						ProductID:      "abc",
+						ProductType:    "efg",
+						Payload:        "{}",
+						BusinessID:     "user00",
+						IdempotencyKey: "from header",
+						Timeout:        time.Minute,
+						Err:            nil,
+					},
+				},
+				timeout: time.Minute,
+			},
+			request: callbackRequest{
+				ProductID:      "abc",
+				ProductType:    "efg",
+				Payload:        "{}",
+				BusinessID:     "user00",
+				IdempotencyKey: "from body",
+			},
+			headers:      map[string]string{idempotencyKeyHeader: "from header"},
+			expectedCode: http.StatusOK,
+			expectedBody: `"ok"`,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			requestBody, err := json.Marshal(tt.request)
 			testutil.Ok(t, err)
 			req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBuffer(requestBody))
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
 			rr := httptest.NewRecorder()
-			web.Handler{H: StoreCallbackThenSend(tt.args.store, tt.args.timeout)}.ServeHTTP(rr, req)
+			web.Handler{H: StoreCallbackThenSend(tt.args.store, nil, tt.args.timeout)}.ServeHTTP(rr, req)
 			testutil.Equals(t, tt.expectedCode, rr.Code)
 			testutil.Equals(t, tt.expectedBody, rr.Body.String())
 		})
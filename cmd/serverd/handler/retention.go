@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/kagelui/notification/internal/pkg/web"
+)
+
+type retentionStore interface {
+	SetRetention(ctx context.Context, businessID string, days int) error
+}
+
+type retentionRequest struct {
+	// RetentionDays is the days the delivered messages are kept, 0 applies the default retention of hermes purge
+	RetentionDays int `json:"retention_days"`
+}
+
+// SetRetention sets the retention of the delivered messages of the merchant identified by the business_id route variable
+func SetRetention(store retentionStore) web.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		req := retentionRequest{}
+		if er := json.NewDecoder(r.Body).Decode(&req); er != nil {
+			return errParsingRequest
+		}
+
+		if err := store.SetRetention(r.Context(), mux.Vars(r)["business_id"], req.RetentionDays); err != nil {
+			return storeError(err, "error setting retention")
+		}
+		web.RespondJSON(r.Context(), w, "ok", nil)
+		return nil
+	}
+}
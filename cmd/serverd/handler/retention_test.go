@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/kagelui/notification/internal/service/messages"
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+type mockRetentionStore struct {
+	T    *testing.T
+	Days int
+	Err  error
+}
+
+func (s mockRetentionStore) SetRetention(_ context.Context, businessID string, days int) error {
+	testutil.Equals(s.T, "merchant0", businessID)
+	testutil.Equals(s.T, s.Days, days)
+	return s.Err
+}
+
+func TestSetRetention(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		store        mockRetentionStore
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "bad request",
+			body:         `{"retention_days":"forever"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "unknown merchant",
+			body:         `{"retention_days":30}`,
+			store:        mockRetentionStore{Days: 30, Err: messages.ErrUnknownMerchant},
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "naughty store",
+			body:         `{"retention_days":30}`,
+			store:        mockRetentionStore{Days: 30, Err: fmt.Errorf("mock error")},
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "all good",
+			body:         `{"retention_days":30}`,
+			store:        mockRetentionStore{Days: 30},
+			expectedCode: http.StatusOK,
+			expectedBody: `"ok"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.store.T = t
+			req := httptest.NewRequest(http.MethodPut, "/admin/merchants/merchant0/retention", bytes.NewBufferString(tt.body))
+			req = mux.SetURLVars(req, map[string]string{"business_id": "merchant0"})
+			rr := httptest.NewRecorder()
+			WrapError(SetRetention(tt.store)).ServeHTTP(rr, req)
+
+			testutil.Equals(t, tt.expectedCode, rr.Code)
+			if tt.expectedBody != "" {
+				testutil.Equals(t, tt.expectedBody, string(bytes.TrimSpace(rr.Body.Bytes())))
+			}
+		})
+	}
+}
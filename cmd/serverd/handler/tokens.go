@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kagelui/notification/internal/pkg/web"
+	"github.com/kagelui/notification/internal/service/messages"
+)
+
+type tokenStore interface {
+	RotateToken(ctx context.Context, businessID string, rotation messages.TokenRotation) (messages.MerchantToken, error)
+	FinishTokenRotation(ctx context.Context, businessID string) (messages.MerchantToken, error)
+	MerchantTokens(ctx context.Context, businessID string) ([]messages.MerchantToken, error)
+}
+
+type rotateTokenRequest struct {
+	// Token is generated when empty
+	Token string `json:"token"`
+	// ValidFrom is an RFC 3339 time, now when empty
+	ValidFrom string `json:"valid_from"`
+	// Overlap is a duration such as 168h, the previous tokens stay valid until the rotation is finished when empty
+	Overlap string `json:"overlap"`
+}
+
+type tokenResponse struct {
+	ID         int        `json:"id"`
+	Token      string     `json:"token,omitempty"`
+	Hint       string     `json:"hint"`
+	ValidFrom  time.Time  `json:"valid_from"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+	Active     bool       `json:"active"`
+}
+
+type tokensResponse struct {
+	Tokens []tokenResponse `json:"tokens"`
+}
+
+// noStore keeps the responses carrying tokens out of caches
+var noStore = map[string]string{"Cache-Control": "no-store"}
+
+func newTokenResponse(t messages.MerchantToken, now time.Time) tokenResponse {
+	return tokenResponse{ID: t.ID, Hint: t.Hint(), ValidFrom: t.ValidFrom, ValidUntil: t.ValidUntil, Active: t.Active(now)}
+}
+
+// ListTokens lists the active and upcoming tokens of the merchant identified by the business_id route variable,
+// the tokens themselves are only hinted
+func ListTokens(store tokenStore) web.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		tokens, err := store.MerchantTokens(r.Context(), mux.Vars(r)["business_id"])
+		if err != nil {
+			return storeError(err, "error listing tokens")
+		}
+		now := time.Now()
+		resp := tokensResponse{Tokens: []tokenResponse{}}
+		for _, t := range tokens {
+			resp.Tokens = append(resp.Tokens, newTokenResponse(t, now))
+		}
+		web.RespondJSON(r.Context(), w, resp, nil)
+		return nil
+	}
+}
+
+// RotateToken starts the rotation of the token of the merchant identified by the business_id route variable.
+// The new token is only ever returned by this response
+func RotateToken(store tokenStore) web.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		req := rotateTokenRequest{}
+		if er := json.NewDecoder(r.Body).Decode(&req); er != nil {
+			return errParsingRequest
+		}
+		rotation := messages.TokenRotation{Token: req.Token}
+		var fieldErrors []web.FieldError
+		if req.ValidFrom != "" {
+			var err error
+			if rotation.ValidFrom, err = time.Parse(time.RFC3339, req.ValidFrom); err != nil {
+				fieldErrors = append(fieldErrors, web.FieldError{Field: "valid_from", Code: "invalid_time", Message: "valid_from must be an RFC 3339 time"})
+			}
+		}
+		if req.Overlap != "" {
+			var err error
+			if rotation.Overlap, err = time.ParseDuration(req.Overlap); err != nil || rotation.Overlap <= 0 {
+				fieldErrors = append(fieldErrors, web.FieldError{Field: "overlap", Code: "invalid_duration", Message: "overlap must be a positive duration such as 168h"})
+			}
+		}
+		if len(req.Token) > 0 && len(req.Token) < 16 {
+			fieldErrors = append(fieldErrors, web.FieldError{Field: "token", Code: "too_short", Message: "token must be at least 16 characters"})
+		}
+		if len(fieldErrors) > 0 {
+			return web.NewValidationError(fieldErrors)
+		}
+
+		token, err := store.RotateToken(r.Context(), mux.Vars(r)["business_id"], rotation)
+		if err != nil {
+			return storeError(err, "error rotating token")
+		}
+		resp := newTokenResponse(token, time.Now())
+		resp.Token = token.Token
+		web.RespondJSON(r.Context(), w, resp, noStore)
+		return nil
+	}
+}
+
+// FinishTokenRotation expires the previous tokens of the merchant identified by the business_id route variable
+func FinishTokenRotation(store tokenStore) web.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		token, err := store.FinishTokenRotation(r.Context(), mux.Vars(r)["business_id"])
+		if err != nil {
+			return storeError(err, "error finishing token rotation")
+		}
+		web.RespondJSON(r.Context(), w, newTokenResponse(token, time.Now()), nil)
+		return nil
+	}
+}
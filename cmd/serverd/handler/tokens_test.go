@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kagelui/notification/internal/service/messages"
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+type mockTokenStore struct {
+	T        *testing.T
+	Rotation messages.TokenRotation
+	Token    messages.MerchantToken
+	Tokens   []messages.MerchantToken
+	Err      error
+}
+
+func (s mockTokenStore) RotateToken(_ context.Context, businessID string, rotation messages.TokenRotation) (messages.MerchantToken, error) {
+	testutil.Equals(s.T, "merchant0", businessID)
+	testutil.Equals(s.T, s.Rotation, rotation)
+	return s.Token, s.Err
+}
+
+func (s mockTokenStore) FinishTokenRotation(_ context.Context, businessID string) (messages.MerchantToken, error) {
+	testutil.Equals(s.T, "merchant0", businessID)
+	return s.Token, s.Err
+}
+
+func (s mockTokenStore) MerchantTokens(_ context.Context, businessID string) ([]messages.MerchantToken, error) {
+	testutil.Equals(s.T, "merchant0", businessID)
+	return s.Tokens, s.Err
+}
+
+func TestRotateToken(t *testing.T) {
+	validFrom := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	rotation := messages.TokenRotation{Token: "0123456789abcdef", ValidFrom: validFrom, Overlap: 168 * time.Hour}
+	body := `{"token":"0123456789abcdef","valid_from":"2021-05-01T00:00:00Z","overlap":"168h"}`
+	tests := []struct {
+		name         string
+		body         string
+		store        mockTokenStore
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "bad request",
+			body:         "random string",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid rotation",
+			body:         `{"token":"short","valid_from":"tomorrow","overlap":"-1h"}`,
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "unknown merchant",
+			body:         body,
+			store:        mockTokenStore{Rotation: rotation, Err: messages.ErrUnknownMerchant},
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "naughty store",
+			body:         body,
+			store:        mockTokenStore{Rotation: rotation, Err: fmt.Errorf("mock error")},
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "all good",
+			body:         body,
+			store:        mockTokenStore{Rotation: rotation, Token: messages.MerchantToken{ID: 3, Token: "0123456789abcdef", ValidFrom: validFrom}},
+			expectedCode: http.StatusOK,
+			expectedBody: `{"id":3,"token":"0123456789abcdef","hint":"...cdef","valid_from":"2021-05-01T00:00:00Z","active":true}`,
+		},
+		{
+			name:         "generated token",
+			body:         `{}`,
+			store:        mockTokenStore{Token: messages.MerchantToken{ID: 3, Token: "generated0", ValidFrom: validFrom}},
+			expectedCode: http.StatusOK,
+			expectedBody: `{"id":3,"token":"generated0","hint":"...ted0","valid_from":"2021-05-01T00:00:00Z","active":true}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.store.T = t
+			req := httptest.NewRequest(http.MethodPost, "/admin/merchants/merchant0/tokens", bytes.NewBufferString(tt.body))
+			req = mux.SetURLVars(req, map[string]string{"business_id": "merchant0"})
+			rr := httptest.NewRecorder()
+			WrapError(RotateToken(tt.store)).ServeHTTP(rr, req)
+
+			testutil.Equals(t, tt.expectedCode, rr.Code)
+			if tt.expectedBody != "" {
+				testutil.Equals(t, tt.expectedBody, string(bytes.TrimSpace(rr.Body.Bytes())))
+				testutil.Equals(t, "no-store", rr.Header().Get("Cache-Control"))
+			}
+		})
+	}
+}
+
+func TestListTokens(t *testing.T) {
+	validFrom := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	validUntil := validFrom.Add(time.Hour)
+	tests := []struct {
+		name         string
+		store        mockTokenStore
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "unknown merchant",
+			store:        mockTokenStore{Err: messages.ErrUnknownMerchant},
+			expectedCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "no tokens",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"tokens":[]}`,
+		},
+		{
+			name: "all good",
+			store: mockTokenStore{Tokens: []messages.MerchantToken{
+				{ID: 4, Token: "new token", ValidFrom: validFrom.AddDate(100, 0, 0)},
+				{ID: 3, Token: "old token", ValidFrom: validFrom, ValidUntil: &validUntil},
+			}},
+			expectedCode: http.StatusOK,
+			expectedBody: `{"tokens":[{"id":4,"hint":"...oken","valid_from":"2121-05-01T00:00:00Z","active":false},` +
+				`{"id":3,"hint":"...oken","valid_from":"2021-05-01T00:00:00Z","valid_until":"2021-05-01T01:00:00Z","active":false}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.store.T = t
+			req := httptest.NewRequest(http.MethodGet, "/admin/merchants/merchant0/tokens", nil)
+			req = mux.SetURLVars(req, map[string]string{"business_id": "merchant0"})
+			rr := httptest.NewRecorder()
+			WrapError(ListTokens(tt.store)).ServeHTTP(rr, req)
+
+			testutil.Equals(t, tt.expectedCode, rr.Code)
+			if tt.expectedBody != "" {
+				testutil.Equals(t, tt.expectedBody, string(bytes.TrimSpace(rr.Body.Bytes())))
+			}
+		})
+	}
+}
+
+func TestFinishTokenRotation(t *testing.T) {
+	validFrom := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		store        mockTokenStore
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "no active token",
+			store:        mockTokenStore{Err: messages.ErrNoActiveToken},
+			expectedCode: http.StatusConflict,
+		},
+		{
+			name:         "naughty store",
+			store:        mockTokenStore{Err: fmt.Errorf("mock error")},
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "all good",
+			store:        mockTokenStore{Token: messages.MerchantToken{ID: 3, Token: "new token", ValidFrom: validFrom}},
+			expectedCode: http.StatusOK,
+			expectedBody: `{"id":3,"hint":"...oken","valid_from":"2021-05-01T00:00:00Z","active":true}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.store.T = t
+			req := httptest.NewRequest(http.MethodPost, "/admin/merchants/merchant0/tokens/finish", nil)
+			req = mux.SetURLVars(req, map[string]string{"business_id": "merchant0"})
+			rr := httptest.NewRecorder()
+			WrapError(FinishTokenRotation(tt.store)).ServeHTTP(rr, req)
+
+			testutil.Equals(t, tt.expectedCode, rr.Code)
+			if tt.expectedBody != "" {
+				testutil.Equals(t, tt.expectedBody, string(bytes.TrimSpace(rr.Body.Bytes())))
+			}
+		})
+	}
+}
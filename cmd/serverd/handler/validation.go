@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kagelui/notification/internal/pkg/validate"
+	"github.com/kagelui/notification/internal/pkg/web"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// Error codes of the field errors raised by PayloadRules
+const (
+	codeProductTypeNotAllowed = "product_type_not_allowed"
+	codeInvalidJSON           = "invalid_json"
+	codeSchemaViolation       = "schema_violation"
+)
+
+// schemaExt is the extension of the JSON schema files loaded by LoadPayloadRules
+const schemaExt = ".json"
+
+// PayloadRules restricts the product types of each product and validates the payloads against the JSON schema
+// registered for their product type. Products without allowed product types and product types without schema
+// are not restricted, a nil *PayloadRules only checks the request fields
+type PayloadRules struct {
+	productTypes map[string]map[string]bool
+	schemas      map[string]*jsonschema.Schema
+}
+
+// NewPayloadRules returns PayloadRules without restriction
+func NewPayloadRules() *PayloadRules {
+	return &PayloadRules{
+		productTypes: make(map[string]map[string]bool),
+		schemas:      make(map[string]*jsonschema.Schema),
+	}
+}
+
+// LoadPayloadRules returns the PayloadRules allowing the product types of each product, separated by "|", e.g.
+// {"va": "fixed|open"}, with the JSON schemas <product_type>.json found in schemaDir, if any
+func LoadPayloadRules(productTypes map[string]string, schemaDir string) (*PayloadRules, error) {
+	rules := NewPayloadRules()
+	for productID, types := range productTypes {
+		rules.AllowProductTypes(productID, strings.Split(types, "|")...)
+	}
+	if schemaDir == "" {
+		return rules, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(schemaDir, "*"+schemaExt))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		err = rules.AddSchema(strings.TrimSuffix(filepath.Base(path), schemaExt), f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// AllowProductTypes restricts the product types of the product to the given ones
+func (p *PayloadRules) AllowProductTypes(productID string, productTypes ...string) {
+	allowed, ok := p.productTypes[productID]
+	if !ok {
+		allowed = make(map[string]bool)
+		p.productTypes[productID] = allowed
+	}
+	for _, t := range productTypes {
+		if t = strings.TrimSpace(t); t != "" {
+			allowed[t] = true
+		}
+	}
+}
+
+// AddSchema registers the JSON schema the payloads of the product type must conform to
+func (p *PayloadRules) AddSchema(productType string, schema io.Reader) error {
+	data, err := ioutil.ReadAll(schema)
+	if err != nil {
+		return err
+	}
+	url := productType + schemaExt
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(url, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("schema of product type %s: %v", productType, err)
+	}
+	compiled, err := compiler.Compile(url)
+	if err != nil {
+		return fmt.Errorf("schema of product type %s: %v", productType, err)
+	}
+	p.schemas[productType] = compiled
+	return nil
+}
+
+// validateRequest returns the invalid fields of the request, the error is only set for invalid validation rules
+func (p *PayloadRules) validateRequest(req callbackRequest) ([]web.FieldError, error) {
+	fieldErrors, err := validate.Struct(req)
+	if err != nil || len(fieldErrors) > 0 || p == nil {
+		return fieldErrors, err
+	}
+
+	if allowed, ok := p.productTypes[req.ProductID]; ok && !allowed[req.ProductType] {
+		fieldErrors = append(fieldErrors, web.FieldError{
+			Field:   "product_type",
+			Code:    codeProductTypeNotAllowed,
+			Message: fmt.Sprintf("product type %s is not allowed for product %s", req.ProductType, req.ProductID),
+		})
+	}
+
+	schema, ok := p.schemas[req.ProductType]
+	if !ok {
+		return fieldErrors, nil
+	}
+	decoder := json.NewDecoder(strings.NewReader(req.Payload))
+	decoder.UseNumber()
+	var payload interface{}
+	if err := decoder.Decode(&payload); err != nil {
+		return append(fieldErrors, web.FieldError{Field: "payload", Code: codeInvalidJSON, Message: "payload is not valid JSON"}), nil
+	}
+	if err := schema.Validate(payload); err != nil {
+		verr, ok := err.(*jsonschema.ValidationError)
+		if !ok {
+			return nil, err
+		}
+		schemaErrors := appendSchemaErrors(nil, verr)
+		// the causes are not ordered, keep the response stable
+		sort.SliceStable(schemaErrors, func(i, j int) bool { return schemaErrors[i].Field < schemaErrors[j].Field })
+		fieldErrors = append(fieldErrors, schemaErrors...)
+	}
+	return fieldErrors, nil
+}
+
+// appendSchemaErrors appends the leaf causes of the schema violation, located by their JSON pointer in the payload
+func appendSchemaErrors(fieldErrors []web.FieldError, verr *jsonschema.ValidationError) []web.FieldError {
+	if len(verr.Causes) == 0 {
+		return append(fieldErrors, web.FieldError{
+			Field:   "payload" + verr.InstanceLocation,
+			Code:    codeSchemaViolation,
+			Message: verr.Message,
+		})
+	}
+	for _, cause := range verr.Causes {
+		fieldErrors = appendSchemaErrors(fieldErrors, cause)
+	}
+	return fieldErrors
+}
+
+// describeFieldErrors joins the messages of the field errors for logging
+func describeFieldErrors(fieldErrors []web.FieldError) string {
+	messages := make([]string, len(fieldErrors))
+	for i, fe := range fieldErrors {
+		messages[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(messages, "; ")
+}
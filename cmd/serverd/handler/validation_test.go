@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kagelui/notification/internal/pkg/web"
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+const vaSchema = `{
+	"type": "object",
+	"required": ["amount"],
+	"properties": {
+		"amount": {"type": "number", "minimum": 0},
+		"currency": {"type": "string"}
+	}
+}`
+
+func TestLoadPayloadRules(t *testing.T) {
+	dir := t.TempDir()
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, "fixed.json"), []byte(vaSchema), 0600))
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("not a schema"), 0600))
+
+	rules, err := LoadPayloadRules(map[string]string{"va": "fixed| open"}, dir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[string]map[string]bool{"va": {"fixed": true, "open": true}}, rules.productTypes)
+	_, ok := rules.schemas["fixed"]
+	testutil.Asserts(t, ok && len(rules.schemas) == 1, "only fixed.json should be loaded, got %v", rules.schemas)
+
+	testutil.Ok(t, ioutil.WriteFile(filepath.Join(dir, "broken.json"), []byte(`{"type": 1}`), 0600))
+	_, err = LoadPayloadRules(nil, dir)
+	testutil.CompareError(t, "schema of product type broken", err)
+}
+
+func TestPayloadRules_validateRequest(t *testing.T) {
+	rules := NewPayloadRules()
+	rules.AllowProductTypes("va", "fixed", "open")
+	testutil.Ok(t, rules.AddSchema("fixed", strings.NewReader(vaSchema)))
+
+	valid := callbackRequest{ProductID: "va", ProductType: "fixed", Payload: `{"amount": 10}`, BusinessID: "user00"}
+	tests := []struct {
+		name  string
+		rules *PayloadRules
+		req   callbackRequest
+		want  []web.FieldError
+	}{
+		{
+			name:  "nil rules",
+			rules: nil,
+			req:   callbackRequest{ProductID: "va", ProductType: "anything", Payload: "not json", BusinessID: "user00"},
+			want:  nil,
+		},
+		{
+			name:  "missing fields",
+			rules: rules,
+			req:   callbackRequest{ProductID: "va", Payload: `{"amount": 10}`},
+			want: []web.FieldError{
+				{Field: "product_type", Code: "required", Message: "product_type is required"},
+				{Field: "business_id", Code: "required", Message: "business_id is required"},
+			},
+		},
+		{
+			name:  "payload too large",
+			rules: rules,
+			req:   callbackRequest{ProductID: "va", ProductType: "open", Payload: strings.Repeat("a", 65537), BusinessID: "user00"},
+			want:  []web.FieldError{{Field: "payload", Code: "max_bytes", Message: "payload must be at most 65536 bytes"}},
+		},
+		{
+			name:  "valid",
+			rules: rules,
+			req:   valid,
+			want:  nil,
+		},
+		{
+			name:  "product type not allowed",
+			rules: rules,
+			req:   callbackRequest{ProductID: "va", ProductType: "closed", Payload: "anything", BusinessID: "user00"},
+			want: []web.FieldError{
+				{Field: "product_type", Code: codeProductTypeNotAllowed, Message: "product type closed is not allowed for product va"},
+			},
+		},
+		{
+			name:  "unrestricted product",
+			rules: rules,
+			req:   callbackRequest{ProductID: "disbursement", ProductType: "instant", Payload: "anything", BusinessID: "user00"},
+			want:  nil,
+		},
+		{
+			name:  "payload not json",
+			rules: rules,
+			req:   callbackRequest{ProductID: "va", ProductType: "fixed", Payload: "amount=10", BusinessID: "user00"},
+			want:  []web.FieldError{{Field: "payload", Code: codeInvalidJSON, Message: "payload is not valid JSON"}},
+		},
+		{
+			name:  "schema violation",
+			rules: rules,
+			req:   callbackRequest{ProductID: "va", ProductType: "fixed", Payload: `{"amount": -1, "currency": 1}`, BusinessID: "user00"},
+			want: []web.FieldError{
+				{Field: "payload/amount", Code: codeSchemaViolation, Message: "must be >= 0 but found -1"},
+				{Field: "payload/currency", Code: codeSchemaViolation, Message: "expected string, but got number"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.rules.validateRequest(tt.req)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tt.want, got)
+		})
+	}
+}
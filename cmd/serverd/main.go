@@ -1,45 +1,213 @@
 package main
 
 import (
-	"log"
+	"context"
+	"flag"
+	"fmt"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"time"
 
+	"github.com/cenkalti/backoff/v4"
 	"github.com/gorilla/mux"
 	"github.com/jmoiron/sqlx"
 	"github.com/kagelui/notification/cmd/serverd/handler"
 	"github.com/kagelui/notification/internal/pkg/envvar"
+	"github.com/kagelui/notification/internal/pkg/loglib"
+	"github.com/kagelui/notification/internal/pkg/metrics"
+	jobqueue2 "github.com/kagelui/notification/internal/pkg/queue"
+	"github.com/kagelui/notification/internal/pkg/secret"
 	"github.com/kagelui/notification/internal/pkg/server"
+	"github.com/kagelui/notification/internal/pkg/trace"
+	"github.com/kagelui/notification/internal/pkg/web"
 	"github.com/kagelui/notification/internal/service/messages"
 	_ "github.com/lib/pq"
 )
 
+const eventBufferSize = 1000
+
+// maxDeliveriesInFlight is the number of concurrent callbacks above which serverd reports not ready
+const maxDeliveriesInFlight = 500
+
+var (
+	configFile  = flag.String("config", os.Getenv("CONFIG_FILE"), "optional YAML or TOML config file, env vars take precedence")
+	printConfig = flag.Bool("print-config", false, "print the effective config with secrets redacted and exit")
+)
+
 func main() {
-	log.Println("server started")
+	flag.Parse()
+
+	lg := loglib.DefaultLogger()
+	lg.InfoF("server started")
 
 	var e envVar
 
-	if err := envvar.Read(&e); err != nil {
-		log.Println(err.Error())
+	if err := envvar.Read(&e, envvar.WithFile(*configFile)); err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(1)
+	}
+
+	if *printConfig {
+		if err := envvar.Print(os.Stdout, &e); err != nil {
+			lg.ErrorF(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := loglib.Configure(e.Log); err != nil {
+		lg.ErrorF(err.Error())
 		os.Exit(1)
 	}
 
 	db, err := sqlx.Connect("postgres", e.DBAddr)
 	if err != nil {
-		log.Println(err.Error())
+		lg.ErrorF(err.Error())
 		os.Exit(132)
 	}
 
-	modelStore := &messages.ModelStore{DB: db}
+	metrics.HashBusinessID = e.HashBusinessID
+
+	// spans are only exported when an exporter is configured
+	if e.Trace.Exporter != "" {
+		exporter, err := trace.NewExporter(e.Trace.Exporter, "serverd", e.Trace.OTLPEndpoint, e.Trace.File)
+		if err != nil {
+			lg.ErrorF(err.Error())
+			os.Exit(134)
+		}
+		trace.SetExporter(exporter)
+		defer trace.Shutdown(context.Background())
+	}
+
+	rules, err := handler.LoadPayloadRules(e.AllowedProductTypes, e.PayloadSchemaDir)
+	if err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(135)
+	}
+
+	secrets, err := secret.ParseKey(e.SecretsKey)
+	if err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(137)
+	}
+
+	keys, err := secret.LoadKeyring(e.KeyringFile)
+	if err != nil {
+		lg.ErrorF(err.Error())
+		os.Exit(138)
+	}
+
+	modelStore := &messages.ModelStore{
+		DB:     db,
+		Events: messages.NopEventSink{},
+		Auth:   messages.NewAuthenticators(keys, secrets, &http.Client{Timeout: e.ClientTimeout}),
+		Keys:   keys,
+	}
+
+	readiness := server.NewReadiness()
+	readiness.Add("postgres", db.PingContext)
+	readiness.Add("deliveries", func(context.Context) error {
+		if n := messages.DeliveriesInFlight(); n >= maxDeliveriesInFlight {
+			return fmt.Errorf("%d deliveries in flight", n)
+		}
+		return nil
+	})
+
+	// delivery events are only published when a queue is configured
+	if e.EventsAMQPAddr != "" {
+		publisher, err := jobqueue2.NewPublisher(context.Background(), e.EventsQueue, e.EventsAMQPAddr, backoff.NewExponentialBackOff())
+		if err != nil {
+			lg.ErrorF(err.Error())
+			os.Exit(133)
+		}
+		if c, ok := publisher.(jobqueue2.Checker); ok {
+			readiness.Add("amqp", c.Check)
+		}
+		sink := messages.NewQueueEventSink(context.Background(), publisher, eventBufferSize)
+		defer sink.Stop()
+		modelStore.Events = sink
+	}
 
 	r := mux.NewRouter()
-	r.Handle("/callback", handler.WrapError(handler.StoreCallbackThenSend(modelStore, e.ClientTimeout))).Methods(http.MethodPost)
+	r.Use(web.Correlate, web.Recover)
+	// probes and scrapes are too frequent to be access logged, Recover is repeated so that panics are
+	// access logged with their 500 status
+	r.Handle("/callback", web.Chain(handler.WrapError(handler.StoreCallbackThenSend(modelStore, rules, e.ClientTimeout)),
+		web.AccessLog, web.Recover, web.LimitBody(e.MaxBodyBytes), web.Timeout(e.RequestTimeout))).Methods(http.MethodPost)
+	r.HandleFunc("/healthz", server.Liveness).Methods(http.MethodGet)
+	r.Handle("/readyz", readiness).Methods(http.MethodGet)
 
-	server.New(":8080", r).Start()
+	app := server.New(e.Addr, r)
+	app.SetTimeouts(e.Server)
+	app.SetReadiness(readiness)
+	if e.TLS.Enabled() {
+		if err := app.SetTLS(e.TLS); err != nil {
+			lg.ErrorF(err.Error())
+			os.Exit(136)
+		}
+	}
+	// metrics stay on the public port unless an admin listener is configured, pprof is only served by the latter
+	if e.Admin.Addr != "" {
+		if err := app.SetAdmin(e.Admin, adminRouter(readiness, modelStore, e.CertExpiryWarning)); err != nil {
+			lg.ErrorF(err.Error())
+			os.Exit(136)
+		}
+	} else {
+		r.Handle("/metrics", metrics.Handler()).Methods(http.MethodGet)
+	}
+	app.Start()
+}
+
+// adminRouter serves the admin API, metrics, pprof and the probes on the admin listener
+func adminRouter(readiness *server.Readiness, store *messages.ModelStore, certExpiryWarning time.Duration) http.Handler {
+	r := mux.NewRouter()
+	// certificates of the callback URLs, flagging those expiring within certExpiryWarning
+	r.Handle("/admin/certificates", handler.WrapError(handler.ListCertificates(store, certExpiryWarning))).Methods(http.MethodGet)
+	// auth settings and request options of the callback URLs
+	r.Handle("/admin/callback-urls/{id}/auth", handler.WrapError(handler.SetCallbackAuth(store))).Methods(http.MethodPut)
+	r.Handle("/admin/callback-urls/{id}/options", handler.WrapError(handler.SetCallbackOptions(store))).Methods(http.MethodPut)
+	// token rotation of the merchants
+	r.Handle("/admin/merchants/{business_id}/tokens", handler.WrapError(handler.ListTokens(store))).Methods(http.MethodGet)
+	r.Handle("/admin/merchants/{business_id}/tokens", handler.WrapError(handler.RotateToken(store))).Methods(http.MethodPost)
+	r.Handle("/admin/merchants/{business_id}/tokens/finish", handler.WrapError(handler.FinishTokenRotation(store))).Methods(http.MethodPost)
+	// message retention of the merchants
+	r.Handle("/admin/merchants/{business_id}/retention", handler.WrapError(handler.SetRetention(store))).Methods(http.MethodPut)
+	r.Handle("/metrics", metrics.Handler()).Methods(http.MethodGet)
+	// the probes are also served here as the public port may require client certificates
+	r.HandleFunc("/healthz", server.Liveness).Methods(http.MethodGet)
+	r.Handle("/readyz", readiness).Methods(http.MethodGet)
+	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	r.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+	return r
 }
 
 type envVar struct {
-	DBAddr        string        `env:"DATABASE_URL"`
-	ClientTimeout time.Duration `env:"CLIENT_TIMEOUT"`
+	DBAddr         string        `env:"DATABASE_URL,secret"`
+	ClientTimeout  time.Duration `env:"CLIENT_TIMEOUT,default=10s"`
+	HashBusinessID bool          `env:"METRICS_HASH_BUSINESS_ID,default=false"`
+	EventsAMQPAddr string        `env:"EVENTS_AMQP_URL,optional,secret"`
+	EventsQueue    string        `env:"EVENTS_QUEUE,optional"`
+	// product_id=type1|type2 pairs restricting the product types of the products
+	AllowedProductTypes map[string]string `env:"ALLOWED_PRODUCT_TYPES,optional"`
+	// key file sealing the merchant tokens, the payloads and the auth settings of the callback URLs, tokens and
+	// payloads are stored in plaintext when not set
+	KeyringFile string `env:"KEYRING_FILE,optional"`
+	// base64 AES-256 key opening the auth settings sealed before the keyring, until rekey seals them again
+	SecretsKey       string        `env:"SECRETS_KEY,optional,secret"`
+	PayloadSchemaDir string        `env:"PAYLOAD_SCHEMA_DIR,optional"`
+	MaxBodyBytes     int64         `env:"MAX_BODY_BYTES,default=1048576"`
+	RequestTimeout   time.Duration `env:"REQUEST_TIMEOUT,default=10s"`
+	Addr             string        `env:"SERVER_ADDR,default=:8080"`
+	// callback URL certificates expiring within this window are flagged by the admin API
+	CertExpiryWarning time.Duration    `env:"CERT_EXPIRY_WARNING,default=720h"`
+	TLS               server.TLSConfig `env:"SERVER_TLS_"`
+	Server            server.Timeouts  `env:"SERVER_"`
+	// admin API, metrics, pprof and probes listener, it is off and metrics are served on Addr when ADMIN_ADDR is empty
+	Admin server.AdminConfig `env:"ADMIN_"`
+	Trace trace.Config       `env:"TRACE_"`
+	Log   loglib.Config      `env:"LOG_"`
 }
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS public.messages_merchant_id_idempotency_key_index;
+ALTER TABLE "public"."messages"
+    DROP COLUMN IF EXISTS idempotency_key;
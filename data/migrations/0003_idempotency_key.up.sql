@@ -0,0 +1,3 @@
+ALTER TABLE "public"."messages"
+    ADD COLUMN idempotency_key TEXT NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX messages_merchant_id_idempotency_key_index ON public.messages (merchant_id, idempotency_key) WHERE idempotency_key <> '';
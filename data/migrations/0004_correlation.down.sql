@@ -0,0 +1,3 @@
+ALTER TABLE "public"."messages"
+    DROP COLUMN IF EXISTS request_id,
+    DROP COLUMN IF EXISTS traceparent;
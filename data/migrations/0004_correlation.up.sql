@@ -0,0 +1,3 @@
+ALTER TABLE "public"."messages"
+    ADD COLUMN request_id  TEXT NOT NULL DEFAULT '',
+    ADD COLUMN traceparent TEXT NOT NULL DEFAULT '';
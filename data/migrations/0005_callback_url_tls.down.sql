@@ -0,0 +1,4 @@
+ALTER TABLE "public"."callback_urls"
+    DROP COLUMN IF EXISTS tls_client_cert,
+    DROP COLUMN IF EXISTS tls_client_key,
+    DROP COLUMN IF EXISTS tls_ca_bundle;
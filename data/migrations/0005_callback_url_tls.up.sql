@@ -0,0 +1,7 @@
+ALTER TABLE "public"."callback_urls"
+    ADD COLUMN tls_client_cert TEXT NOT NULL DEFAULT '',
+    ADD COLUMN tls_client_key  TEXT NOT NULL DEFAULT '',
+    ADD COLUMN tls_ca_bundle   TEXT NOT NULL DEFAULT '';
+COMMENT ON COLUMN "public"."callback_urls".tls_client_cert IS 'path of the PEM client certificate presented to the callback URL';
+COMMENT ON COLUMN "public"."callback_urls".tls_client_key IS 'path of the PEM private key of the client certificate';
+COMMENT ON COLUMN "public"."callback_urls".tls_ca_bundle IS 'path of the PEM CA bundle trusted for the callback URL instead of the system roots';
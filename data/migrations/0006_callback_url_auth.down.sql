@@ -0,0 +1,3 @@
+ALTER TABLE "public"."callback_urls"
+    DROP COLUMN IF EXISTS auth_type,
+    DROP COLUMN IF EXISTS auth_config;
@@ -0,0 +1,5 @@
+ALTER TABLE "public"."callback_urls"
+    ADD COLUMN auth_type   TEXT NOT NULL DEFAULT '' CHECK (auth_type IN ('', 'static', 'basic', 'oauth2')),
+    ADD COLUMN auth_config TEXT NOT NULL DEFAULT '';
+COMMENT ON COLUMN "public"."callback_urls".auth_type IS 'authentication of the callbacks besides the merchant token, none when empty';
+COMMENT ON COLUMN "public"."callback_urls".auth_config IS 'sealed JSON settings of the authentication, including its secrets';
@@ -0,0 +1,6 @@
+ALTER TABLE "public"."callback_urls"
+    DROP COLUMN IF EXISTS headers,
+    DROP COLUMN IF EXISTS token_header,
+    DROP COLUMN IF EXISTS method,
+    DROP COLUMN IF EXISTS timeout_ms,
+    DROP COLUMN IF EXISTS gzip;
@@ -0,0 +1,9 @@
+ALTER TABLE "public"."callback_urls"
+    ADD COLUMN headers      JSONB   NOT NULL DEFAULT '{}'::JSONB,
+    ADD COLUMN token_header TEXT    NOT NULL DEFAULT '',
+    ADD COLUMN method       TEXT    NOT NULL DEFAULT 'POST' CHECK (method IN ('POST', 'PUT')),
+    ADD COLUMN timeout_ms   INTEGER NOT NULL DEFAULT 0 CHECK (timeout_ms >= 0),
+    ADD COLUMN gzip         BOOLEAN NOT NULL DEFAULT FALSE;
+COMMENT ON COLUMN "public"."callback_urls".headers IS 'extra headers of the callbacks, overriding the default ones';
+COMMENT ON COLUMN "public"."callback_urls".token_header IS 'header carrying the merchant token, x-callback-token when empty';
+COMMENT ON COLUMN "public"."callback_urls".timeout_ms IS 'timeout of the callbacks, CLIENT_TIMEOUT when 0';
@@ -0,0 +1,15 @@
+CREATE TABLE "public"."merchant_tokens"
+(
+    id          SERIAL PRIMARY KEY,
+    merchant_id INTEGER                  NOT NULL REFERENCES public.merchants (id),
+    token       TEXT                     NOT NULL CHECK (token::TEXT <> ''::TEXT),
+    valid_from  TIMESTAMP WITH TIME ZONE NOT NULL,
+    valid_until TIMESTAMP WITH TIME ZONE CHECK (valid_until IS NULL OR valid_until > valid_from),
+    created_at  TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+CREATE INDEX merchant_tokens_merchant_id_index ON public.merchant_tokens (merchant_id);
+
+-- the current tokens are valid until rotated
+INSERT INTO public.merchant_tokens (merchant_id, token, valid_from)
+SELECT id, token, created_at
+FROM public.merchants;
@@ -0,0 +1,7 @@
+-- sealed values are unreadable without their key IDs, run rekey -decrypt first
+ALTER TABLE "public"."messages"
+    DROP COLUMN IF EXISTS payload_key_id;
+ALTER TABLE "public"."merchant_tokens"
+    DROP COLUMN IF EXISTS key_id;
+ALTER TABLE "public"."merchants"
+    DROP COLUMN IF EXISTS token_key_id;
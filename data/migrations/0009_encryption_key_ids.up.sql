@@ -0,0 +1,7 @@
+-- the ID of the keyring key sealing the value, empty for plaintext values
+ALTER TABLE "public"."merchants"
+    ADD COLUMN token_key_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE "public"."merchant_tokens"
+    ADD COLUMN key_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE "public"."messages"
+    ADD COLUMN payload_key_id TEXT NOT NULL DEFAULT '';
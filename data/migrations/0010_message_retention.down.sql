@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS public.messages_delivered_created_at_index;
+ALTER TABLE "public"."merchants"
+    DROP COLUMN IF EXISTS retention_days;
@@ -0,0 +1,4 @@
+-- days the delivered messages of the merchant are kept, the default retention of hermes purge applies when 0
+ALTER TABLE "public"."merchants"
+    ADD COLUMN retention_days INTEGER NOT NULL DEFAULT 0 CHECK (retention_days >= 0);
+CREATE INDEX messages_delivered_created_at_index ON public.messages (created_at) WHERE status = 'SUCCESS';
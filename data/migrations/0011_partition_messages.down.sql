@@ -0,0 +1,25 @@
+-- the messages of the detached partitions are not restored
+DROP TRIGGER IF EXISTS messages_release_idempotency_key ON public.messages;
+DROP TRIGGER IF EXISTS messages_claim_idempotency_key ON public.messages;
+DROP FUNCTION IF EXISTS public.messages_release_idempotency_key();
+DROP FUNCTION IF EXISTS public.messages_claim_idempotency_key();
+DROP TABLE IF EXISTS public.message_idempotency_keys;
+
+ALTER TABLE "public"."messages"
+    RENAME TO messages_partitioned;
+
+CREATE TABLE "public"."messages"
+(
+    LIKE public.messages_partitioned INCLUDING DEFAULTS INCLUDING CONSTRAINTS
+);
+INSERT INTO public.messages
+SELECT *
+FROM public.messages_partitioned;
+DROP TABLE public.messages_partitioned;
+
+ALTER TABLE "public"."messages"
+    ADD PRIMARY KEY (id),
+    ADD FOREIGN KEY (merchant_id) REFERENCES public.merchants (id);
+CREATE INDEX messages_merchant_id_index ON public.messages (merchant_id);
+CREATE UNIQUE INDEX messages_merchant_id_idempotency_key_index ON public.messages (merchant_id, idempotency_key) WHERE idempotency_key <> '';
+CREATE INDEX messages_delivered_created_at_index ON public.messages (created_at) WHERE status = 'SUCCESS';
@@ -0,0 +1,95 @@
+-- messages are partitioned by month of created_at, in UTC, so that old months are detached instead of deleted.
+-- The partitions from the oldest message to 3 months ahead are created, hermes partitions keeps creating them
+ALTER TABLE "public"."messages"
+    RENAME TO messages_unpartitioned;
+
+CREATE TABLE "public"."messages"
+(
+    LIKE public.messages_unpartitioned INCLUDING DEFAULTS INCLUDING CONSTRAINTS
+) PARTITION BY RANGE (created_at);
+
+-- catches the messages outside of the monthly partitions, it stays empty while the partitions are created ahead
+CREATE TABLE public.messages_default PARTITION OF public.messages DEFAULT;
+
+DO
+$$
+    DECLARE
+        -- converted to UTC before it is truncated, so that the months start as in MaintainPartitions whatever the
+        -- time zone of the session
+        first_created_at TIMESTAMP := COALESCE((SELECT min(created_at) FROM public.messages_unpartitioned), now()) AT TIME ZONE 'UTC';
+        partition_month  DATE      := date_trunc('month', first_created_at);
+    BEGIN
+        WHILE partition_month < date_trunc('month', now() AT TIME ZONE 'UTC') + INTERVAL '4 months'
+            LOOP
+                EXECUTE format('CREATE TABLE public.%I PARTITION OF public.messages FOR VALUES FROM (%L) TO (%L)',
+                               'messages_' || to_char(partition_month, 'YYYY_MM'),
+                               partition_month::TIMESTAMP AT TIME ZONE 'UTC',
+                               (partition_month + INTERVAL '1 month')::TIMESTAMP AT TIME ZONE 'UTC');
+                partition_month := partition_month + INTERVAL '1 month';
+            END LOOP;
+    END
+$$;
+
+INSERT INTO public.messages
+SELECT *
+FROM public.messages_unpartitioned;
+DROP TABLE public.messages_unpartitioned;
+
+-- unique constraints of partitioned tables include the partition key
+ALTER TABLE "public"."messages"
+    ADD PRIMARY KEY (id, created_at),
+    ADD FOREIGN KEY (merchant_id) REFERENCES public.merchants (id);
+CREATE INDEX messages_merchant_id_index ON public.messages (merchant_id);
+CREATE INDEX messages_merchant_id_idempotency_key_index ON public.messages (merchant_id, idempotency_key) WHERE idempotency_key <> '';
+CREATE INDEX messages_delivered_created_at_index ON public.messages (created_at) WHERE status = 'SUCCESS';
+
+-- the idempotency keys are unique across the partitions, a duplicate key fails the insert of the message with a
+-- unique violation as the unique index did
+CREATE TABLE "public"."message_idempotency_keys"
+(
+    merchant_id     INTEGER                  NOT NULL,
+    idempotency_key TEXT                     NOT NULL,
+    message_id      UUID                     NOT NULL,
+    created_at      TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (merchant_id, idempotency_key)
+);
+CREATE INDEX message_idempotency_keys_created_at_index ON public.message_idempotency_keys (created_at);
+INSERT INTO public.message_idempotency_keys (merchant_id, idempotency_key, message_id, created_at)
+SELECT merchant_id, idempotency_key, id, created_at
+FROM public.messages
+WHERE idempotency_key <> '';
+
+CREATE FUNCTION public.messages_claim_idempotency_key() RETURNS TRIGGER AS
+$$
+BEGIN
+    INSERT INTO public.message_idempotency_keys (merchant_id, idempotency_key, message_id, created_at)
+    VALUES (NEW.merchant_id, NEW.idempotency_key, NEW.id, NEW.created_at);
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION public.messages_release_idempotency_key() RETURNS TRIGGER AS
+$$
+BEGIN
+    DELETE
+    FROM public.message_idempotency_keys
+    WHERE merchant_id = OLD.merchant_id
+      AND idempotency_key = OLD.idempotency_key
+      AND message_id = OLD.id;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER messages_claim_idempotency_key
+    AFTER INSERT
+    ON public.messages
+    FOR EACH ROW
+    WHEN (NEW.idempotency_key <> '')
+EXECUTE FUNCTION public.messages_claim_idempotency_key();
+
+CREATE TRIGGER messages_release_idempotency_key
+    AFTER DELETE
+    ON public.messages
+    FOR EACH ROW
+    WHEN (OLD.idempotency_key <> '')
+EXECUTE FUNCTION public.messages_release_idempotency_key();
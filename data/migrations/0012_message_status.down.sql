@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS public.messages_due_retry_index;
+ALTER TABLE "public"."messages"
+    DROP CONSTRAINT IF EXISTS messages_status_check;
@@ -0,0 +1,24 @@
+-- the status column was checked with the condition of product_type, the duplicated check is replaced by a check of
+-- the statuses set by the services
+DO
+$$
+    DECLARE
+        c RECORD;
+    BEGIN
+        FOR c IN SELECT conname
+                 FROM pg_constraint
+                 WHERE conrelid = 'public.messages'::REGCLASS
+                   AND contype = 'c'
+                   AND pg_get_constraintdef(oid) LIKE '%product_type%'
+            LOOP
+                EXECUTE format('ALTER TABLE public.messages DROP CONSTRAINT %I', c.conname);
+            END LOOP;
+    END
+$$;
+
+ALTER TABLE "public"."messages"
+    ADD CONSTRAINT messages_product_type_check CHECK (product_type::TEXT <> ''::TEXT),
+    ADD CONSTRAINT messages_status_check CHECK (status IN ('PENDING', 'FAILED', 'SUCCESS'));
+
+-- supports the retry scan of hermes, the retry count bound is maxRetry of the messages service
+CREATE INDEX messages_due_retry_index ON public.messages (next_delivery_time) WHERE status = 'FAILED' AND retry_count < 6;
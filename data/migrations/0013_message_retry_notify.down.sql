@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS messages_notify_retry ON public.messages;
+DROP FUNCTION IF EXISTS public.messages_notify_retry();
@@ -0,0 +1,18 @@
+-- wakes the retry workers listening on message_retry when a failed message is due at a new time, the notification
+-- is sent on commit
+CREATE FUNCTION public.messages_notify_retry() RETURNS TRIGGER AS
+$$
+BEGIN
+    PERFORM pg_notify('message_retry',
+                      json_build_object('id', NEW.id, 'next_delivery_time', NEW.next_delivery_time)::TEXT);
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+-- the retry count bound is maxRetry of the messages service
+CREATE TRIGGER messages_notify_retry
+    AFTER INSERT OR UPDATE OF status, next_delivery_time
+    ON public.messages
+    FOR EACH ROW
+    WHEN (NEW.status = 'FAILED' AND NEW.retry_count < 6)
+EXECUTE FUNCTION public.messages_notify_retry();
@@ -0,0 +1,3 @@
+-- the auth settings sealed by the keyring are unreadable without their key IDs, run rekey -decrypt first
+ALTER TABLE "public"."callback_urls"
+    DROP COLUMN IF EXISTS auth_config_key_id;
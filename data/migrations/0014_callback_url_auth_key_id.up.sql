@@ -0,0 +1,4 @@
+-- the ID of the keyring key sealing the auth settings, empty for the settings sealed by SECRETS_KEY before the
+-- keyring, which rekey seals again with the keyring
+ALTER TABLE "public"."callback_urls"
+    ADD COLUMN auth_config_key_id TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS public.messages_stuck_pending_index;
@@ -0,0 +1,3 @@
+-- supports the sweep of hermes, which marks failed the retried messages left pending by a stopped run, whatever
+-- their age
+CREATE INDEX messages_stuck_pending_index ON public.messages (updated_at) WHERE status = 'PENDING' AND retry_count > 0;
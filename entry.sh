@@ -1,4 +1,7 @@
 #!/bin/sh
 
+# retry the failed callbacks as they fall due, the crontab runs a single retry every 10 minutes should the watch stop
+/root/hermes -watch >> /var/log/script.log 2>&1 &
+
 # start cron
 /usr/sbin/crond -f -l 8
@@ -18,36 +18,70 @@ import (
 	"github.com/volatiletech/sqlboiler/v4/queries"
 	"github.com/volatiletech/sqlboiler/v4/queries/qm"
 	"github.com/volatiletech/sqlboiler/v4/queries/qmhelper"
+	"github.com/volatiletech/sqlboiler/v4/types"
 	"github.com/volatiletech/strmangle"
 )
 
 // CallbackURL is an object representing the database table.
 type CallbackURL struct {
-	ID          int       `boil:"id" json:"id" toml:"id" yaml:"id"`
-	BusinessID  string    `boil:"business_id" json:"business_id" toml:"business_id" yaml:"business_id"`
-	ProductID   string    `boil:"product_id" json:"product_id" toml:"product_id" yaml:"product_id"`
-	CallbackURL string    `boil:"callback_url" json:"callback_url" toml:"callback_url" yaml:"callback_url"`
-	CreatedAt   time.Time `boil:"created_at" json:"created_at" toml:"created_at" yaml:"created_at"`
-	UpdatedAt   time.Time `boil:"updated_at" json:"updated_at" toml:"updated_at" yaml:"updated_at"`
+	ID              int        `boil:"id" json:"id" toml:"id" yaml:"id"`
+	BusinessID      string     `boil:"business_id" json:"business_id" toml:"business_id" yaml:"business_id"`
+	ProductID       string     `boil:"product_id" json:"product_id" toml:"product_id" yaml:"product_id"`
+	CallbackURL     string     `boil:"callback_url" json:"callback_url" toml:"callback_url" yaml:"callback_url"`
+	CreatedAt       time.Time  `boil:"created_at" json:"created_at" toml:"created_at" yaml:"created_at"`
+	UpdatedAt       time.Time  `boil:"updated_at" json:"updated_at" toml:"updated_at" yaml:"updated_at"`
+	TLSClientCert   string     `boil:"tls_client_cert" json:"tls_client_cert" toml:"tls_client_cert" yaml:"tls_client_cert"`
+	TLSClientKey    string     `boil:"tls_client_key" json:"tls_client_key" toml:"tls_client_key" yaml:"tls_client_key"`
+	TLSCABundle     string     `boil:"tls_ca_bundle" json:"tls_ca_bundle" toml:"tls_ca_bundle" yaml:"tls_ca_bundle"`
+	AuthType        string     `boil:"auth_type" json:"auth_type" toml:"auth_type" yaml:"auth_type"`
+	AuthConfig      string     `boil:"auth_config" json:"auth_config" toml:"auth_config" yaml:"auth_config"`
+	Headers         types.JSON `boil:"headers" json:"headers" toml:"headers" yaml:"headers"`
+	TokenHeader     string     `boil:"token_header" json:"token_header" toml:"token_header" yaml:"token_header"`
+	Method          string     `boil:"method" json:"method" toml:"method" yaml:"method"`
+	TimeoutMS       int        `boil:"timeout_ms" json:"timeout_ms" toml:"timeout_ms" yaml:"timeout_ms"`
+	Gzip            bool       `boil:"gzip" json:"gzip" toml:"gzip" yaml:"gzip"`
+	AuthConfigKeyID string     `boil:"auth_config_key_id" json:"auth_config_key_id" toml:"auth_config_key_id" yaml:"auth_config_key_id"`
 
 	R *callbackURLR `boil:"-" json:"-" toml:"-" yaml:"-"`
 	L callbackURLL  `boil:"-" json:"-" toml:"-" yaml:"-"`
 }
 
 var CallbackURLColumns = struct {
-	ID          string
-	BusinessID  string
-	ProductID   string
-	CallbackURL string
-	CreatedAt   string
-	UpdatedAt   string
+	ID              string
+	BusinessID      string
+	ProductID       string
+	CallbackURL     string
+	CreatedAt       string
+	UpdatedAt       string
+	TLSClientCert   string
+	TLSClientKey    string
+	TLSCABundle     string
+	AuthType        string
+	AuthConfig      string
+	Headers         string
+	TokenHeader     string
+	Method          string
+	TimeoutMS       string
+	Gzip            string
+	AuthConfigKeyID string
 }{
-	ID:          "id",
-	BusinessID:  "business_id",
-	ProductID:   "product_id",
-	CallbackURL: "callback_url",
-	CreatedAt:   "created_at",
-	UpdatedAt:   "updated_at",
+	ID:              "id",
+	BusinessID:      "business_id",
+	ProductID:       "product_id",
+	CallbackURL:     "callback_url",
+	CreatedAt:       "created_at",
+	UpdatedAt:       "updated_at",
+	TLSClientCert:   "tls_client_cert",
+	TLSClientKey:    "tls_client_key",
+	TLSCABundle:     "tls_ca_bundle",
+	AuthType:        "auth_type",
+	AuthConfig:      "auth_config",
+	Headers:         "headers",
+	TokenHeader:     "token_header",
+	Method:          "method",
+	TimeoutMS:       "timeout_ms",
+	Gzip:            "gzip",
+	AuthConfigKeyID: "auth_config_key_id",
 }
 
 // Generated where
@@ -119,20 +153,51 @@ func (w whereHelpertime_Time) GTE(x time.Time) qm.QueryMod {
 	return qmhelper.Where(w.field, qmhelper.GTE, x)
 }
 
+type whereHelperbool struct{ field string }
+
+func (w whereHelperbool) EQ(x bool) qm.QueryMod  { return qmhelper.Where(w.field, qmhelper.EQ, x) }
+func (w whereHelperbool) NEQ(x bool) qm.QueryMod { return qmhelper.Where(w.field, qmhelper.NEQ, x) }
+func (w whereHelperbool) LT(x bool) qm.QueryMod  { return qmhelper.Where(w.field, qmhelper.LT, x) }
+func (w whereHelperbool) LTE(x bool) qm.QueryMod { return qmhelper.Where(w.field, qmhelper.LTE, x) }
+func (w whereHelperbool) GT(x bool) qm.QueryMod  { return qmhelper.Where(w.field, qmhelper.GT, x) }
+func (w whereHelperbool) GTE(x bool) qm.QueryMod { return qmhelper.Where(w.field, qmhelper.GTE, x) }
+
 var CallbackURLWhere = struct {
-	ID          whereHelperint
-	BusinessID  whereHelperstring
-	ProductID   whereHelperstring
-	CallbackURL whereHelperstring
-	CreatedAt   whereHelpertime_Time
-	UpdatedAt   whereHelpertime_Time
+	ID              whereHelperint
+	BusinessID      whereHelperstring
+	ProductID       whereHelperstring
+	CallbackURL     whereHelperstring
+	CreatedAt       whereHelpertime_Time
+	UpdatedAt       whereHelpertime_Time
+	TLSClientCert   whereHelperstring
+	TLSClientKey    whereHelperstring
+	TLSCABundle     whereHelperstring
+	AuthType        whereHelperstring
+	AuthConfig      whereHelperstring
+	Headers         whereHelpertypes_JSON
+	TokenHeader     whereHelperstring
+	Method          whereHelperstring
+	TimeoutMS       whereHelperint
+	Gzip            whereHelperbool
+	AuthConfigKeyID whereHelperstring
 }{
-	ID:          whereHelperint{field: "\"callback_urls\".\"id\""},
-	BusinessID:  whereHelperstring{field: "\"callback_urls\".\"business_id\""},
-	ProductID:   whereHelperstring{field: "\"callback_urls\".\"product_id\""},
-	CallbackURL: whereHelperstring{field: "\"callback_urls\".\"callback_url\""},
-	CreatedAt:   whereHelpertime_Time{field: "\"callback_urls\".\"created_at\""},
-	UpdatedAt:   whereHelpertime_Time{field: "\"callback_urls\".\"updated_at\""},
+	ID:              whereHelperint{field: "\"callback_urls\".\"id\""},
+	BusinessID:      whereHelperstring{field: "\"callback_urls\".\"business_id\""},
+	ProductID:       whereHelperstring{field: "\"callback_urls\".\"product_id\""},
+	CallbackURL:     whereHelperstring{field: "\"callback_urls\".\"callback_url\""},
+	CreatedAt:       whereHelpertime_Time{field: "\"callback_urls\".\"created_at\""},
+	UpdatedAt:       whereHelpertime_Time{field: "\"callback_urls\".\"updated_at\""},
+	TLSClientCert:   whereHelperstring{field: "\"callback_urls\".\"tls_client_cert\""},
+	TLSClientKey:    whereHelperstring{field: "\"callback_urls\".\"tls_client_key\""},
+	TLSCABundle:     whereHelperstring{field: "\"callback_urls\".\"tls_ca_bundle\""},
+	AuthType:        whereHelperstring{field: "\"callback_urls\".\"auth_type\""},
+	AuthConfig:      whereHelperstring{field: "\"callback_urls\".\"auth_config\""},
+	Headers:         whereHelpertypes_JSON{field: "\"callback_urls\".\"headers\""},
+	TokenHeader:     whereHelperstring{field: "\"callback_urls\".\"token_header\""},
+	Method:          whereHelperstring{field: "\"callback_urls\".\"method\""},
+	TimeoutMS:       whereHelperint{field: "\"callback_urls\".\"timeout_ms\""},
+	Gzip:            whereHelperbool{field: "\"callback_urls\".\"gzip\""},
+	AuthConfigKeyID: whereHelperstring{field: "\"callback_urls\".\"auth_config_key_id\""},
 }
 
 // CallbackURLRels is where relationship names are stored.
@@ -152,9 +217,9 @@ func (*callbackURLR) NewStruct() *callbackURLR {
 type callbackURLL struct{}
 
 var (
-	callbackURLAllColumns            = []string{"id", "business_id", "product_id", "callback_url", "created_at", "updated_at"}
+	callbackURLAllColumns            = []string{"id", "business_id", "product_id", "callback_url", "created_at", "updated_at", "tls_client_cert", "tls_client_key", "tls_ca_bundle", "auth_type", "auth_config", "headers", "token_header", "method", "timeout_ms", "gzip", "auth_config_key_id"}
 	callbackURLColumnsWithoutDefault = []string{"business_id", "product_id", "callback_url", "created_at", "updated_at"}
-	callbackURLColumnsWithDefault    = []string{"id"}
+	callbackURLColumnsWithDefault    = []string{"id", "tls_client_cert", "tls_client_key", "tls_ca_bundle", "auth_type", "auth_config", "headers", "token_header", "method", "timeout_ms", "gzip", "auth_config_key_id"}
 	callbackURLPrimaryKeyColumns     = []string{"id"}
 )
 
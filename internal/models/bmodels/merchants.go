@@ -23,44 +23,54 @@ import (
 
 // Merchant is an object representing the database table.
 type Merchant struct {
-	ID         int       `boil:"id" json:"id" toml:"id" yaml:"id"`
-	BusinessID string    `boil:"business_id" json:"business_id" toml:"business_id" yaml:"business_id"`
-	Token      string    `boil:"token" json:"token" toml:"token" yaml:"token"`
-	CreatedAt  time.Time `boil:"created_at" json:"created_at" toml:"created_at" yaml:"created_at"`
-	UpdatedAt  time.Time `boil:"updated_at" json:"updated_at" toml:"updated_at" yaml:"updated_at"`
+	ID            int       `boil:"id" json:"id" toml:"id" yaml:"id"`
+	BusinessID    string    `boil:"business_id" json:"business_id" toml:"business_id" yaml:"business_id"`
+	Token         string    `boil:"token" json:"token" toml:"token" yaml:"token"`
+	CreatedAt     time.Time `boil:"created_at" json:"created_at" toml:"created_at" yaml:"created_at"`
+	UpdatedAt     time.Time `boil:"updated_at" json:"updated_at" toml:"updated_at" yaml:"updated_at"`
+	TokenKeyID    string    `boil:"token_key_id" json:"token_key_id" toml:"token_key_id" yaml:"token_key_id"`
+	RetentionDays int       `boil:"retention_days" json:"retention_days" toml:"retention_days" yaml:"retention_days"`
 
 	R *merchantR `boil:"-" json:"-" toml:"-" yaml:"-"`
 	L merchantL  `boil:"-" json:"-" toml:"-" yaml:"-"`
 }
 
 var MerchantColumns = struct {
-	ID         string
-	BusinessID string
-	Token      string
-	CreatedAt  string
-	UpdatedAt  string
+	ID            string
+	BusinessID    string
+	Token         string
+	CreatedAt     string
+	UpdatedAt     string
+	TokenKeyID    string
+	RetentionDays string
 }{
-	ID:         "id",
-	BusinessID: "business_id",
-	Token:      "token",
-	CreatedAt:  "created_at",
-	UpdatedAt:  "updated_at",
+	ID:            "id",
+	BusinessID:    "business_id",
+	Token:         "token",
+	CreatedAt:     "created_at",
+	UpdatedAt:     "updated_at",
+	TokenKeyID:    "token_key_id",
+	RetentionDays: "retention_days",
 }
 
 // Generated where
 
 var MerchantWhere = struct {
-	ID         whereHelperint
-	BusinessID whereHelperstring
-	Token      whereHelperstring
-	CreatedAt  whereHelpertime_Time
-	UpdatedAt  whereHelpertime_Time
+	ID            whereHelperint
+	BusinessID    whereHelperstring
+	Token         whereHelperstring
+	CreatedAt     whereHelpertime_Time
+	UpdatedAt     whereHelpertime_Time
+	TokenKeyID    whereHelperstring
+	RetentionDays whereHelperint
 }{
-	ID:         whereHelperint{field: "\"merchants\".\"id\""},
-	BusinessID: whereHelperstring{field: "\"merchants\".\"business_id\""},
-	Token:      whereHelperstring{field: "\"merchants\".\"token\""},
-	CreatedAt:  whereHelpertime_Time{field: "\"merchants\".\"created_at\""},
-	UpdatedAt:  whereHelpertime_Time{field: "\"merchants\".\"updated_at\""},
+	ID:            whereHelperint{field: "\"merchants\".\"id\""},
+	BusinessID:    whereHelperstring{field: "\"merchants\".\"business_id\""},
+	Token:         whereHelperstring{field: "\"merchants\".\"token\""},
+	CreatedAt:     whereHelpertime_Time{field: "\"merchants\".\"created_at\""},
+	UpdatedAt:     whereHelpertime_Time{field: "\"merchants\".\"updated_at\""},
+	TokenKeyID:    whereHelperstring{field: "\"merchants\".\"token_key_id\""},
+	RetentionDays: whereHelperint{field: "\"merchants\".\"retention_days\""},
 }
 
 // MerchantRels is where relationship names are stored.
@@ -84,9 +94,9 @@ func (*merchantR) NewStruct() *merchantR {
 type merchantL struct{}
 
 var (
-	merchantAllColumns            = []string{"id", "business_id", "token", "created_at", "updated_at"}
+	merchantAllColumns            = []string{"id", "business_id", "token", "created_at", "updated_at", "token_key_id", "retention_days"}
 	merchantColumnsWithoutDefault = []string{"business_id", "token", "created_at", "updated_at"}
-	merchantColumnsWithDefault    = []string{"id"}
+	merchantColumnsWithDefault    = []string{"id", "token_key_id", "retention_days"}
 	merchantPrimaryKeyColumns     = []string{"id"}
 )
 
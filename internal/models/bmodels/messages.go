@@ -34,6 +34,10 @@ type Message struct {
 	Status           string     `boil:"status" json:"status" toml:"status" yaml:"status"`
 	CreatedAt        time.Time  `boil:"created_at" json:"created_at" toml:"created_at" yaml:"created_at"`
 	UpdatedAt        time.Time  `boil:"updated_at" json:"updated_at" toml:"updated_at" yaml:"updated_at"`
+	IdempotencyKey   string     `boil:"idempotency_key" json:"idempotency_key" toml:"idempotency_key" yaml:"idempotency_key"`
+	RequestID        string     `boil:"request_id" json:"request_id" toml:"request_id" yaml:"request_id"`
+	Traceparent      string     `boil:"traceparent" json:"traceparent" toml:"traceparent" yaml:"traceparent"`
+	PayloadKeyID     string     `boil:"payload_key_id" json:"payload_key_id" toml:"payload_key_id" yaml:"payload_key_id"`
 
 	R *messageR `boil:"-" json:"-" toml:"-" yaml:"-"`
 	L messageL  `boil:"-" json:"-" toml:"-" yaml:"-"`
@@ -50,6 +54,10 @@ var MessageColumns = struct {
 	Status           string
 	CreatedAt        string
 	UpdatedAt        string
+	IdempotencyKey   string
+	RequestID        string
+	Traceparent      string
+	PayloadKeyID     string
 }{
 	ID:               "id",
 	ProductID:        "product_id",
@@ -61,6 +69,10 @@ var MessageColumns = struct {
 	Status:           "status",
 	CreatedAt:        "created_at",
 	UpdatedAt:        "updated_at",
+	IdempotencyKey:   "idempotency_key",
+	RequestID:        "request_id",
+	Traceparent:      "traceparent",
+	PayloadKeyID:     "payload_key_id",
 }
 
 // Generated where
@@ -97,6 +109,10 @@ var MessageWhere = struct {
 	Status           whereHelperstring
 	CreatedAt        whereHelpertime_Time
 	UpdatedAt        whereHelpertime_Time
+	IdempotencyKey   whereHelperstring
+	RequestID        whereHelperstring
+	Traceparent      whereHelperstring
+	PayloadKeyID     whereHelperstring
 }{
 	ID:               whereHelperstring{field: "\"messages\".\"id\""},
 	ProductID:        whereHelperstring{field: "\"messages\".\"product_id\""},
@@ -108,6 +124,10 @@ var MessageWhere = struct {
 	Status:           whereHelperstring{field: "\"messages\".\"status\""},
 	CreatedAt:        whereHelpertime_Time{field: "\"messages\".\"created_at\""},
 	UpdatedAt:        whereHelpertime_Time{field: "\"messages\".\"updated_at\""},
+	IdempotencyKey:   whereHelperstring{field: "\"messages\".\"idempotency_key\""},
+	RequestID:        whereHelperstring{field: "\"messages\".\"request_id\""},
+	Traceparent:      whereHelperstring{field: "\"messages\".\"traceparent\""},
+	PayloadKeyID:     whereHelperstring{field: "\"messages\".\"payload_key_id\""},
 }
 
 // MessageRels is where relationship names are stored.
@@ -131,9 +151,9 @@ func (*messageR) NewStruct() *messageR {
 type messageL struct{}
 
 var (
-	messageAllColumns            = []string{"id", "product_id", "product_type", "payload", "merchant_id", "retry_count", "next_delivery_time", "status", "created_at", "updated_at"}
+	messageAllColumns            = []string{"id", "product_id", "product_type", "payload", "merchant_id", "retry_count", "next_delivery_time", "status", "created_at", "updated_at", "idempotency_key", "request_id", "traceparent", "payload_key_id"}
 	messageColumnsWithoutDefault = []string{"id", "product_id", "product_type", "payload", "merchant_id", "retry_count", "next_delivery_time", "status", "created_at", "updated_at"}
-	messageColumnsWithDefault    = []string{}
+	messageColumnsWithDefault    = []string{"idempotency_key", "request_id", "traceparent", "payload_key_id"}
 	messagePrimaryKeyColumns     = []string{"id"}
 )
 
@@ -0,0 +1,57 @@
+package envvar
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// LoadFile reads the YAML (.yaml, .yml) or TOML (.toml) config file into env var keys.
+// Keys are upper-cased and nested tables are joined with "_", so `trace: {exporter: otlp}` is read as TRACE_EXPORTER.
+// Lists are joined with commas
+func LoadFile(path string) (map[string]string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".toml":
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported format", path)
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("config file %s: %v", path, err)
+	}
+
+	// nested keys are joined with "."
+	config := make(map[string]string)
+	for _, k := range v.AllKeys() {
+		key := strings.ToUpper(strings.ReplaceAll(k, ".", "_"))
+		value, err := flatten(key, v.Get(k))
+		if err != nil {
+			return nil, fmt.Errorf("config file %s: %v", path, err)
+		}
+		config[key] = value
+	}
+	return config, nil
+}
+
+func flatten(key string, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			switch item.(type) {
+			case map[string]interface{}, map[interface{}]interface{}, []interface{}:
+				return "", fmt.Errorf("%s: lists may only contain values", key)
+			}
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ","), nil
+	case nil:
+		return "", nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
@@ -0,0 +1,94 @@
+package envvar
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Redacted replaces the value of secret fields in the output of Print
+const Redacted = "[REDACTED]"
+
+// Print writes the config read into target as KEY=value lines, in field order.
+// Values of fields with the `secret` option are redacted, as are URL passwords
+func Print(w io.Writer, target interface{}) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("invalid type %v passed", reflect.TypeOf(target))
+	}
+	if err := checkTags(rv.Type()); err != nil {
+		return err
+	}
+	return printFields(w, rv, "")
+}
+
+func printFields(w io.Writer, v reflect.Value, prefix string) error {
+	refType := v.Type()
+	for i := 0; i < refType.NumField(); i++ {
+		refTypeField := refType.Field(i)
+		tag := refTypeField.Tag.Get(tagName)
+		if tag == "-" {
+			continue
+		}
+		if isNested(refTypeField.Type) {
+			if err := printFields(w, v.Field(i), prefix+tag); err != nil {
+				return err
+			}
+			continue
+		}
+
+		f, _ := parseTag(tag)
+		value := formatValue(v.Field(i))
+		if f.secret && value != "" {
+			value = Redacted
+		}
+		if _, err := fmt.Fprintf(w, "%s=%s\n", prefix+f.key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatValue formats the field the way Read parses it
+func formatValue(fieldValue reflect.Value) string {
+	switch fieldValue.Type() {
+	case durationType:
+		return time.Duration(fieldValue.Int()).String()
+	case urlType:
+		u := fieldValue.Interface().(url.URL)
+		return u.Redacted()
+	case reflect.PtrTo(urlType):
+		if fieldValue.IsNil() {
+			return ""
+		}
+		return fieldValue.Interface().(*url.URL).Redacted()
+	}
+
+	switch fieldValue.Kind() {
+	case reflect.Slice:
+		items := make([]string, fieldValue.Len())
+		for i := range items {
+			items[i] = fieldValue.Index(i).String()
+		}
+		return strings.Join(items, ",")
+	case reflect.Map:
+		pairs := make([]string, 0, fieldValue.Len())
+		iter := fieldValue.MapRange()
+		for iter.Next() {
+			pairs = append(pairs, iter.Key().String()+"="+iter.Value().String())
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	}
+	if !fieldValue.CanInterface() {
+		return ""
+	}
+	return fmt.Sprint(fieldValue.Interface())
+}
@@ -2,6 +2,8 @@ package envvar
 
 import (
 	"fmt"
+	"io/ioutil"
+	"net/url"
 	"os"
 	"reflect"
 	"strconv"
@@ -11,8 +13,89 @@ import (
 
 const tagName = "env"
 
-// Read fills the target with the env var
-func Read(target interface{}) error {
+// fileSuffix marks the variable holding the path of a file containing the value, e.g. Docker and Kubernetes secrets
+const fileSuffix = "_FILE"
+
+// tag options, default must come last as its value may contain commas
+const (
+	optionOptional = "optional"
+	optionRequired = "required"
+	optionSecret   = "secret"
+	optionDefault  = "default="
+)
+
+var (
+	durationType = reflect.TypeOf(time.Nanosecond)
+	urlType      = reflect.TypeOf(url.URL{})
+)
+
+// Errors lists every invalid environment variable found by Read
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// field is a tagged struct field
+type field struct {
+	key          string
+	optional     bool
+	secret       bool
+	defaultValue *string
+}
+
+// Option configures Read
+type Option func(*reader)
+
+// WithFile layers the YAML or TOML config file under the env vars, see LoadFile. No file is read when path is empty
+func WithFile(path string) Option {
+	return func(r *reader) {
+		r.path = path
+	}
+}
+
+// reader looks up the env var, then the file named by the env var with the _FILE suffix, then the config file
+type reader struct {
+	path   string
+	config map[string]string
+}
+
+func (r reader) lookup(key string) (string, bool, error) {
+	value, ok := os.LookupEnv(key)
+	if path, fileOK := os.LookupEnv(key + fileSuffix); fileOK {
+		if ok {
+			return "", false, fmt.Errorf("both %s and %s%s are set", key, key, fileSuffix)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("%s%s: %v", key, fileSuffix, err)
+		}
+		return string(data), true, nil
+	}
+	if ok {
+		return value, true, nil
+	}
+	value, ok = r.config[key]
+	return value, ok, nil
+}
+
+// Read fills the target with the env var.
+//
+// The value of a variable can also be read from the file named by the variable with the _FILE suffix, e.g.
+// DATABASE_URL_FILE=/run/secrets/database_url, or from the config file given with WithFile.
+//
+// Every field must be tagged, e.g. `env:"CLIENT_TIMEOUT"`, or skipped with `env:"-"`. Variables are required unless
+// the tag has the `optional` option or a default value, e.g. `env:"CLIENT_TIMEOUT,default=10s"`. A struct field is
+// read recursively with its tag as the prefix of the nested keys, e.g. `env:"TRACE_"`. Fields with the `secret`
+// option are redacted by Print.
+//
+// Supported types are string, bool, ints, uints, floats, time.Duration, url.URL, []string (comma separated)
+// and map[string]string (comma separated key=value pairs). All invalid variables are reported at once as Errors
+func Read(target interface{}, opts ...Option) error {
 	rv := reflect.ValueOf(target)
 	if rv.Kind() != reflect.Ptr || rv.IsNil() {
 		return fmt.Errorf("invalid type %v passed", reflect.TypeOf(target))
@@ -23,72 +106,226 @@ func Read(target interface{}) error {
 		return fmt.Errorf("not a struct pointer")
 	}
 
-	refType := v.Type()
+	if err := checkTags(v.Type()); err != nil {
+		return err
+	}
+
+	var r reader
+	for _, opt := range opts {
+		opt(&r)
+	}
+	if r.path != "" {
+		config, err := LoadFile(r.path)
+		if err != nil {
+			return err
+		}
+		r.config = config
+	}
 
-	envVarKeys := make([]string, refType.NumField())
+	var errs Errors
+	r.read(v, "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
 
+// checkTags validates the tags of the struct and its nested structs
+func checkTags(refType reflect.Type) error {
 	for i := 0; i < refType.NumField(); i++ {
 		refTypeField := refType.Field(i)
-		envVarKey, ok := refTypeField.Tag.Lookup(tagName)
+		tag, ok := refTypeField.Tag.Lookup(tagName)
 		if !ok {
 			return fmt.Errorf("env tag not set for field %s", refTypeField.Name)
 		}
-		envVarKeys[i] = envVarKey
+		if tag == "-" {
+			continue
+		}
+		if isNested(refTypeField.Type) {
+			if err := checkTags(refTypeField.Type); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := parseTag(tag); err != nil {
+			return fmt.Errorf("field %s: %v", refTypeField.Name, err)
+		}
 	}
+	return nil
+}
 
-	for i, key := range envVarKeys {
-		if key == "-" {
-			continue
+func parseTag(tag string) (field, error) {
+	parts := strings.Split(tag, ",")
+	f := field{key: parts[0]}
+	if f.key == "" {
+		return f, fmt.Errorf("empty env var name")
+	}
+
+	var required bool
+	for i, option := range parts[1:] {
+		switch {
+		case option == optionOptional:
+			f.optional = true
+		case option == optionRequired:
+			required = true
+		case option == optionSecret:
+			f.secret = true
+		case strings.HasPrefix(option, optionDefault):
+			value := strings.Join(parts[i+1:], ",")[len(optionDefault):]
+			f.defaultValue = &value
+		default:
+			return f, fmt.Errorf("unknown option %q", option)
 		}
+		if f.defaultValue != nil {
+			break
+		}
+	}
+	if required && (f.optional || f.defaultValue != nil) {
+		return f, fmt.Errorf("required %s cannot be optional or have a default", f.key)
+	}
+	return f, nil
+}
 
-		value, ok := os.LookupEnv(key)
-		if !ok {
-			return fmt.Errorf("%s not present", key)
+// read fills the struct value with the env var prefixed by prefix, appending every invalid variable to errs
+func (r reader) read(v reflect.Value, prefix string, errs *Errors) {
+	refType := v.Type()
+	for i := 0; i < refType.NumField(); i++ {
+		refTypeField := refType.Field(i)
+		tag := refTypeField.Tag.Get(tagName)
+		if tag == "-" {
+			continue
 		}
-		value = strings.TrimSpace(value)
 
 		fieldValue := v.Field(i)
 		if !fieldValue.IsValid() || !fieldValue.CanSet() {
-			return fmt.Errorf("field %s is not valid or cannot be set", refType.Field(i).Name)
+			*errs = append(*errs, fmt.Errorf("field %s is not valid or cannot be set", refTypeField.Name))
+			continue
 		}
 
-		// try parsing the "type" first
-		fieldType := refType.Field(i)
-		switch fieldType.Type {
-		case reflect.TypeOf(time.Nanosecond):
-			t, err := time.ParseDuration(value)
-			if err != nil {
-				return err
-			}
-			fieldValue.Set(reflect.ValueOf(t))
+		if isNested(refTypeField.Type) {
+			r.read(fieldValue, prefix+tag, errs)
 			continue
 		}
 
-		// then try the built-in "kinds"
-		switch fieldValue.Kind() {
-		case reflect.String:
-			fieldValue.SetString(value)
-		case reflect.Int:
-			num, err := strconv.Atoi(value)
-			if err != nil {
-				return err
-			}
-			if fieldValue.OverflowInt(int64(num)) {
-				return fmt.Errorf("int %d overflows for field %s", num, refType.Field(i).Name)
-			}
-			fieldValue.SetInt(int64(num))
-		case reflect.Float64:
-			f, err := strconv.ParseFloat(value, 64)
-			if err != nil {
-				return err
-			}
-			if fieldValue.OverflowFloat(f) {
-				return fmt.Errorf("float64 %v overflows for field %s", f, refType.Field(i).Name)
-			}
-			fieldValue.SetFloat(f)
+		// tags are validated by checkTags
+		f, _ := parseTag(tag)
+		key := prefix + f.key
+
+		value, ok, err := r.lookup(key)
+		if err != nil {
+			*errs = append(*errs, err)
+			continue
+		}
+		switch {
+		case ok:
+		case f.defaultValue != nil:
+			value = *f.defaultValue
+		case f.optional:
+			continue
 		default:
-			return fmt.Errorf("unsupported type %s", fieldValue.Type().Name())
+			*errs = append(*errs, fmt.Errorf("%s not present", key))
+			continue
+		}
+
+		if err := setValue(fieldValue, strings.TrimSpace(value)); err != nil {
+			*errs = append(*errs, fmt.Errorf("%s: %v", key, err))
 		}
 	}
+}
+
+// isNested tells if the field is a struct read recursively rather than parsed from one variable
+func isNested(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != urlType
+}
+
+func setValue(fieldValue reflect.Value, value string) error {
+	// try parsing the "type" first
+	switch fieldValue.Type() {
+	case durationType:
+		t, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		fieldValue.Set(reflect.ValueOf(t))
+		return nil
+	case urlType, reflect.PtrTo(urlType):
+		u, err := url.Parse(value)
+		if err != nil {
+			return err
+		}
+		if fieldValue.Kind() == reflect.Ptr {
+			fieldValue.Set(reflect.ValueOf(u))
+		} else {
+			fieldValue.Set(reflect.ValueOf(*u))
+		}
+		return nil
+	}
+
+	// then try the built-in "kinds"
+	switch fieldValue.Kind() {
+	case reflect.String:
+		fieldValue.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		fieldValue.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		num, err := strconv.ParseInt(value, 10, fieldValue.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fieldValue.SetInt(num)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		num, err := strconv.ParseUint(value, 10, fieldValue.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fieldValue.SetUint(num)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, fieldValue.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fieldValue.SetFloat(f)
+	case reflect.Slice:
+		if fieldValue.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", fieldValue.Type().String())
+		}
+		items := splitList(value)
+		slice := reflect.MakeSlice(fieldValue.Type(), len(items), len(items))
+		for i, item := range items {
+			slice.Index(i).SetString(item)
+		}
+		fieldValue.Set(slice)
+	case reflect.Map:
+		if fieldValue.Type().Key().Kind() != reflect.String || fieldValue.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", fieldValue.Type().String())
+		}
+		m := reflect.MakeMap(fieldValue.Type())
+		for _, pair := range splitList(value) {
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("invalid key=value pair %q", pair)
+			}
+			m.SetMapIndex(reflect.ValueOf(strings.TrimSpace(kv[0])).Convert(fieldValue.Type().Key()),
+				reflect.ValueOf(strings.TrimSpace(kv[1])).Convert(fieldValue.Type().Elem()))
+		}
+		fieldValue.Set(m)
+	default:
+		return fmt.Errorf("unsupported type %s", fieldValue.Type().String())
+	}
 	return nil
 }
+
+// splitList splits a comma separated value, ignoring empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -1,6 +1,7 @@
 package envvar
 
 import (
+	"net/url"
 	"os"
 	"testing"
 	"time"
@@ -158,6 +159,134 @@ func TestRead(t *testing.T) {
 			}{One: "hey", Two: "", Three: 319826, Four: "", Five: 861.8362, Six: time.Second * 5},
 			wantErr: "",
 		},
+		{
+			name: "report every invalid variable",
+			target: &struct {
+				One   string        `env:"one"`
+				Three int           `env:"three"`
+				Five  time.Duration `env:"five"`
+			}{},
+			envVar:  map[string]string{"three": "abc", "five": "10seconds"},
+			want:    nil,
+			wantErr: `one not present; three: strconv.ParseInt: parsing "abc": invalid syntax; five: time: unknown unit "seconds" in duration "10seconds"`,
+		},
+		{
+			name: "unknown tag option",
+			target: &struct {
+				One string `env:"one,sometimes"`
+			}{},
+			envVar:  map[string]string{"one": "hey"},
+			want:    nil,
+			wantErr: `field One: unknown option "sometimes"`,
+		},
+		{
+			name: "required with default",
+			target: &struct {
+				One string `env:"one,required,default=hey"`
+			}{},
+			envVar:  nil,
+			want:    nil,
+			wantErr: "required one cannot be optional or have a default",
+		},
+		{
+			name: "env tag not set for nested field",
+			target: &struct {
+				Nested struct {
+					One string
+				} `env:"NESTED_"`
+			}{},
+			envVar:  nil,
+			want:    nil,
+			wantErr: "env tag not set for field One",
+		},
+		{
+			name: "invalid key value pair",
+			target: &struct {
+				One map[string]string `env:"one"`
+			}{},
+			envVar:  map[string]string{"one": "a=1,b"},
+			want:    nil,
+			wantErr: `one: invalid key=value pair "b"`,
+		},
+		{
+			name: "uint overflow",
+			target: &struct {
+				One uint8 `env:"one"`
+			}{},
+			envVar:  map[string]string{"one": "256"},
+			want:    nil,
+			wantErr: `parsing "256": value out of range`,
+		},
+		{
+			name: "defaults and optional",
+			target: &struct {
+				One   string        `env:"one,optional"`
+				Two   string        `env:"two,default=yes"`
+				Three time.Duration `env:"three,default=10s"`
+				Four  []string      `env:"four,default=a,b"`
+				Five  int           `env:"five,required"`
+				Six   string        `env:"six,default=fallback"`
+			}{},
+			envVar: map[string]string{"five": "5", "six": "set"},
+			want: &struct {
+				One   string        `env:"one,optional"`
+				Two   string        `env:"two,default=yes"`
+				Three time.Duration `env:"three,default=10s"`
+				Four  []string      `env:"four,default=a,b"`
+				Five  int           `env:"five,required"`
+				Six   string        `env:"six,default=fallback"`
+			}{Two: "yes", Three: time.Second * 10, Four: []string{"a", "b"}, Five: 5, Six: "set"},
+			wantErr: "",
+		},
+		{
+			name: "more types",
+			target: &struct {
+				One   bool              `env:"one"`
+				Two   int64             `env:"two"`
+				Three uint              `env:"three"`
+				Four  []string          `env:"four"`
+				Five  map[string]string `env:"five"`
+				Six   url.URL           `env:"six"`
+				Seven *url.URL          `env:"seven"`
+			}{},
+			envVar: map[string]string{"one": "true", "two": "-9007199254740993", "three": "42", "four": "a, b,,c",
+				"five": "a=1, b=x=y", "six": "http://localhost:8080/callback", "seven": "amqp://localhost:5672/"},
+			want: &struct {
+				One   bool              `env:"one"`
+				Two   int64             `env:"two"`
+				Three uint              `env:"three"`
+				Four  []string          `env:"four"`
+				Five  map[string]string `env:"five"`
+				Six   url.URL           `env:"six"`
+				Seven *url.URL          `env:"seven"`
+			}{One: true, Two: -9007199254740993, Three: 42, Four: []string{"a", "b", "c"},
+				Five:  map[string]string{"a": "1", "b": "x=y"},
+				Six:   url.URL{Scheme: "http", Host: "localhost:8080", Path: "/callback"},
+				Seven: &url.URL{Scheme: "amqp", Host: "localhost:5672", Path: "/"}},
+			wantErr: "",
+		},
+		{
+			name: "nested prefixed struct",
+			target: &struct {
+				One   string `env:"one"`
+				Trace struct {
+					Exporter string `env:"EXPORTER"`
+					File     string `env:"FILE,optional"`
+				} `env:"TRACE_"`
+			}{},
+			envVar: map[string]string{"one": "hey", "TRACE_EXPORTER": "stdout"},
+			want: &struct {
+				One   string `env:"one"`
+				Trace struct {
+					Exporter string `env:"EXPORTER"`
+					File     string `env:"FILE,optional"`
+				} `env:"TRACE_"`
+			}{One: "hey", Trace: struct {
+				Exporter string `env:"EXPORTER"`
+				File     string `env:"FILE,optional"`
+			}{Exporter: "stdout"}},
+			wantErr: "",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,160 @@
+// Package leader elects a single leader among the replicas sharing a Postgres database, so that the singleton jobs
+// run on one of them. The leader holds a session advisory lock on a connection dedicated to the lease
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	tryLockQuery = `SELECT pg_try_advisory_lock($1)`
+	// bigint advisory locks split the key in classid and objid, with objsubid 1
+	holdsLockQuery = `SELECT EXISTS (SELECT 1 FROM pg_locks
+WHERE locktype = 'advisory' AND pid = pg_backend_pid() AND granted AND objsubid = 1
+AND ((classid::bigint << 32) | objid::bigint) = $1)`
+)
+
+// Key returns the advisory lock key of the election with the name
+func Key(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	// a positive key reads the same from the halves of pg_locks
+	return int64(h.Sum64() & math.MaxInt64)
+}
+
+// Elector campaigns for the leadership of an election, the replicas electing with the same name and database
+// compete for the same lock
+type Elector struct {
+	db       *sql.DB
+	name     string
+	key      int64
+	renew    time.Duration
+	onChange func(leader bool)
+
+	mu     sync.Mutex
+	leader bool
+}
+
+// NewElector returns an Elector of the election with the name, renewing its lease every renew interval. onChange
+// is called when the leadership is gained or lost, it may be nil
+func NewElector(db *sql.DB, name string, renew time.Duration, onChange func(leader bool)) *Elector {
+	return &Elector{db: db, name: name, key: Key(name), renew: renew, onChange: onChange}
+}
+
+// Name returns the name of the election
+func (e *Elector) Name() string {
+	return e.name
+}
+
+// IsLeader tells if the Elector holds the leadership
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+func (e *Elector) setLeader(leader bool) {
+	e.mu.Lock()
+	changed := e.leader != leader
+	e.leader = leader
+	e.mu.Unlock()
+	if changed && e.onChange != nil {
+		e.onChange(leader)
+	}
+}
+
+// TryLead makes one attempt at the leadership, ok is false when another replica holds it. The lease is renewed until
+// it is released, the leadership is lost, e.g. when the connection breaks, or the context is done
+func (e *Elector) TryLead(ctx context.Context) (lease *Lease, ok bool, err error) {
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := conn.QueryRowContext(ctx, tryLockQuery, e.key).Scan(&ok); err != nil || !ok {
+		conn.Close()
+		return nil, false, err
+	}
+
+	leaseCtx, cancel := context.WithCancel(ctx)
+	lease = &Lease{ctx: leaseCtx, cancel: cancel, conn: conn, done: make(chan struct{})}
+	e.setLeader(true)
+	go func() {
+		e.renewLease(lease)
+		lease.discard()
+		e.setLeader(false)
+		close(lease.done)
+	}()
+	return lease, true, nil
+}
+
+// renewLease checks that the lock is still held every renew interval, until the lease context is done
+func (e *Elector) renewLease(lease *Lease) {
+	ticker := time.NewTicker(e.renew)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lease.ctx.Done():
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(lease.ctx, e.renew)
+			var held bool
+			err := lease.conn.QueryRowContext(ctx, holdsLockQuery, e.key).Scan(&held)
+			cancel()
+			if err != nil || !held {
+				lease.cancel()
+				return
+			}
+		}
+	}
+}
+
+// Run campaigns for the leadership until the context is done, calling lead with a context cancelled when the
+// leadership is lost. The lease is released when lead returns, and the Elector campaigns again
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	ticker := time.NewTicker(e.renew)
+	defer ticker.Stop()
+	for {
+		lease, ok, err := e.TryLead(ctx)
+		if err == nil && ok {
+			lead(lease.Context())
+			lease.Release()
+		}
+		// errors are retried, the database may be restarting
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Lease is the leadership held by an Elector
+type Lease struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	conn   *sql.Conn
+	done   chan struct{}
+}
+
+// Context returns a context cancelled when the leadership is lost or released
+func (l *Lease) Context() context.Context {
+	return l.ctx
+}
+
+// Release gives up the leadership, it returns once another replica may lead
+func (l *Lease) Release() {
+	l.cancel()
+	<-l.done
+}
+
+// discard closes the connection of the lease, which releases the lock along with the session. The connection is
+// not returned to the pool as it may still hold the lock
+func (l *Lease) discard() {
+	l.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+}
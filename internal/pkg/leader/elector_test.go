@@ -0,0 +1,98 @@
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kagelui/notification/internal/testutil"
+	_ "github.com/lib/pq"
+)
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		election string
+		other    string
+	}{
+		{name: "maintenance", election: "hermes-maintenance", other: "hermes-purge"},
+		{name: "empty", election: "", other: " "},
+		{name: "case", election: "hermes", other: "Hermes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := Key(tt.election)
+			testutil.Asserts(t, key >= 0, "negative key %d", key)
+			testutil.Equals(t, key, Key(tt.election))
+			testutil.Asserts(t, key != Key(tt.other), "%q and %q share key %d", tt.election, tt.other, key)
+		})
+	}
+}
+
+func TestElector_setLeader(t *testing.T) {
+	var changes []bool
+	e := NewElector(nil, "hermes", time.Second, func(leader bool) { changes = append(changes, leader) })
+
+	e.setLeader(false)
+	e.setLeader(true)
+	e.setLeader(true)
+	testutil.Equals(t, true, e.IsLeader())
+	e.setLeader(false)
+	testutil.Equals(t, false, e.IsLeader())
+	testutil.Equals(t, []bool{true, false}, changes)
+
+	// no callback
+	NewElector(nil, "hermes", time.Second, nil).setLeader(true)
+}
+
+func TestElector_TryLead(t *testing.T) {
+	dsn, ok := os.LookupEnv("DATABASE_URL")
+	if !ok {
+		t.Skip("DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	testutil.Ok(t, err)
+	defer db.Close()
+	ctx := context.TODO()
+
+	name := "leader-test-" + time.Now().Format(time.RFC3339Nano)
+	first := NewElector(db, name, 50*time.Millisecond, nil)
+	second := NewElector(db, name, 50*time.Millisecond, nil)
+
+	lease, ok, err := first.TryLead(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, true, ok)
+	testutil.Equals(t, true, first.IsLeader())
+
+	_, ok, err = second.TryLead(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, false, ok)
+	testutil.Equals(t, false, second.IsLeader())
+
+	// the lease is renewed while the lock is held
+	time.Sleep(200 * time.Millisecond)
+	testutil.Ok(t, lease.Context().Err())
+
+	lease.Release()
+	testutil.Equals(t, context.Canceled, lease.Context().Err())
+	testutil.Equals(t, false, first.IsLeader())
+
+	lease, ok, err = second.TryLead(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, true, ok)
+
+	// the leadership is lost with the session
+	var pid int
+	testutil.Ok(t, lease.conn.QueryRowContext(ctx, `SELECT pg_backend_pid()`).Scan(&pid))
+	_, err = db.ExecContext(ctx, `SELECT pg_terminate_backend($1)`, pid)
+	testutil.Ok(t, err)
+	select {
+	case <-lease.Context().Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("leadership not lost")
+	}
+	lease.Release()
+	testutil.Equals(t, false, second.IsLeader())
+}
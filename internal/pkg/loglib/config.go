@@ -0,0 +1,63 @@
+package loglib
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Log formats accepted by Configure
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Config configures the default logger, it is read from the environment with the LOG_ prefix
+type Config struct {
+	Level        string   `env:"LEVEL,default=info"`
+	Format       string   `env:"FORMAT,default=text"`
+	RedactFields []string `env:"REDACT_FIELDS,optional"`
+	// info and debug logs are not sampled when SampleInitial is 0
+	SampleInitial    int           `env:"SAMPLE_INITIAL,default=0"`
+	SampleThereafter int           `env:"SAMPLE_THEREAFTER,default=100"`
+	SampleTick       time.Duration `env:"SAMPLE_TICK,default=1s"`
+}
+
+// sampler holds the *Sampler applied to the info and debug logs
+var sampler atomic.Value
+
+// Configure applies the config to the logrus standard logger used by DefaultLogger
+func Configure(cfg Config) error {
+	level, err := logrus.ParseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+
+	var formatter logrus.Formatter
+	switch cfg.Format {
+	case FormatText:
+		formatter = &logrus.TextFormatter{}
+	case FormatJSON:
+		formatter = &logrus.JSONFormatter{}
+	default:
+		return fmt.Errorf("unknown log format %s", cfg.Format)
+	}
+
+	logger := logrus.StandardLogger()
+	logger.SetLevel(level)
+	logger.SetFormatter(formatter)
+	hooks := make(logrus.LevelHooks)
+	hooks.Add(NewRedactHook(cfg.RedactFields...))
+	logger.ReplaceHooks(hooks)
+
+	sampler.Store(NewSampler(cfg.SampleInitial, cfg.SampleThereafter, cfg.SampleTick))
+	return nil
+}
+
+// sampled tells if the info or debug log with the message template should be written
+func sampled(message string) bool {
+	s, _ := sampler.Load().(*Sampler)
+	return s.Allow(message)
+}
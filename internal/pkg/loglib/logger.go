@@ -31,13 +31,21 @@ func (v *Logger) WithFields(fields map[string]interface{}) *Logger {
 	return &Logger{LogEntry: v.LogEntry.WithFields(fields)}
 }
 
-// DebugF logs the message using debug level
+// DebugF logs the message using debug level, subject to sampling.
+// Disabled debug logs are not counted by the sampler
 func (v *Logger) DebugF(message string, args ...interface{}) {
+	if !v.LogEntry.Logger.IsLevelEnabled(logrus.DebugLevel) || !sampled(message) {
+		return
+	}
 	v.LogEntry.Debugf(message, args...)
 }
 
-// InfoF logs the message using info level
+// InfoF logs the message using info level, subject to sampling.
+// Disabled info logs are not counted by the sampler
 func (v *Logger) InfoF(message string, args ...interface{}) {
+	if !v.LogEntry.Logger.IsLevelEnabled(logrus.InfoLevel) || !sampled(message) {
+		return
+	}
 	v.LogEntry.Infof(message, args...)
 }
 
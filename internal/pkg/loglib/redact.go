@@ -0,0 +1,75 @@
+package loglib
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Redacted replaces the masked values in the log output
+const Redacted = "[REDACTED]"
+
+// DefaultRedactFields are the field names always masked by RedactHook
+var DefaultRedactFields = []string{"x-callback-token", "token", "password", "secret", "authorization", "api_key", "client_secret", "access_token"}
+
+var (
+	// bearerPattern matches bearer tokens, e.g. in an Authorization header
+	bearerPattern = regexp.MustCompile(`(?i)(bearer\s+)[a-z0-9\-._~+/]+=*`)
+	// urlPasswordPattern matches the password of URLs such as DATABASE_URL
+	urlPasswordPattern = regexp.MustCompile(`(://[^:/@\s]+:)[^@/\s]+@`)
+)
+
+// RedactHook masks the values of the fields with the given names, and token-like strings in the message and the
+// string fields, e.g. `x-callback-token: abc`, `"password":"abc"` or `Bearer abc`
+type RedactHook struct {
+	fields  map[string]struct{}
+	pattern *regexp.Regexp
+}
+
+// NewRedactHook returns a RedactHook masking DefaultRedactFields and the given field names, matched case-insensitively
+func NewRedactHook(fields ...string) *RedactHook {
+	h := &RedactHook{fields: make(map[string]struct{})}
+	names := make([]string, 0, len(DefaultRedactFields)+len(fields))
+	for _, f := range append(append([]string{}, DefaultRedactFields...), fields...) {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if _, ok := h.fields[f]; f == "" || ok {
+			continue
+		}
+		h.fields[f] = struct{}{}
+		names = append(names, regexp.QuoteMeta(f))
+	}
+	// key: value, key=value and "key":"value" pairs, keeping the scheme of authorization values
+	h.pattern = regexp.MustCompile(`(?i)((?:` + strings.Join(names, "|") + `)["']?\s*[:=]\s*["']?(?:(?:basic|bearer)\s+)?)[^\s"',&}]+`)
+	return h
+}
+
+// Levels implements logrus.Hook
+func (h *RedactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook, the entry is a copy so it can be modified in place
+func (h *RedactHook) Fire(entry *logrus.Entry) error {
+	entry.Message = h.Redact(entry.Message)
+	for k, v := range entry.Data {
+		if _, ok := h.fields[strings.ToLower(k)]; ok {
+			entry.Data[k] = Redacted
+			continue
+		}
+		switch value := v.(type) {
+		case string:
+			entry.Data[k] = h.Redact(value)
+		case error:
+			entry.Data[k] = h.Redact(value.Error())
+		}
+	}
+	return nil
+}
+
+// Redact masks the token-like strings in s
+func (h *RedactHook) Redact(s string) string {
+	s = h.pattern.ReplaceAllString(s, "${1}"+Redacted)
+	s = bearerPattern.ReplaceAllString(s, "${1}"+Redacted)
+	return urlPasswordPattern.ReplaceAllString(s, "${1}"+Redacted+"@")
+}
@@ -0,0 +1,59 @@
+package loglib
+
+import (
+	"sync"
+	"time"
+)
+
+// Sampler limits the number of info and debug logs per message template: within every tick, the first Initial logs
+// are written, then one in every Thereafter
+type Sampler struct {
+	Initial    int
+	Thereafter int
+	Tick       time.Duration
+
+	mu       sync.Mutex
+	counters map[string]*sampleCounter
+	now      func() time.Time
+}
+
+type sampleCounter struct {
+	resetAt time.Time
+	n       int
+}
+
+// NewSampler returns a Sampler, it returns nil, which samples nothing, when initial is not positive
+func NewSampler(initial, thereafter int, tick time.Duration) *Sampler {
+	if initial <= 0 {
+		return nil
+	}
+	return &Sampler{
+		Initial:    initial,
+		Thereafter: thereafter,
+		Tick:       tick,
+		counters:   make(map[string]*sampleCounter),
+		now:        time.Now,
+	}
+}
+
+// Allow tells if the log with the message template should be written
+func (s *Sampler) Allow(message string) bool {
+	if s == nil {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	c, ok := s.counters[message]
+	if !ok || !now.Before(c.resetAt) {
+		c = &sampleCounter{resetAt: now.Add(s.Tick)}
+		s.counters[message] = c
+	}
+	c.n++
+	if c.n <= s.Initial {
+		return true
+	}
+	return s.Thereafter > 0 && (c.n-s.Initial)%s.Thereafter == 0
+}
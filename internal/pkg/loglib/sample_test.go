@@ -0,0 +1,99 @@
+package loglib
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kagelui/notification/internal/testutil"
+	"github.com/sirupsen/logrus"
+)
+
+func TestSampler_Allow(t *testing.T) {
+	tests := []struct {
+		name       string
+		sampler    *Sampler
+		messages   []string
+		advance    map[int]time.Duration
+		wantAllows []bool
+	}{
+		{
+			name:       "nil samples nothing",
+			sampler:    NewSampler(0, 10, time.Second),
+			messages:   []string{"a", "a", "a"},
+			wantAllows: []bool{true, true, true},
+		},
+		{
+			name:       "initial then every thereafter",
+			sampler:    NewSampler(2, 3, time.Second),
+			messages:   []string{"a", "a", "a", "a", "a", "a"},
+			wantAllows: []bool{true, true, false, false, true, false},
+		},
+		{
+			name:       "per message template",
+			sampler:    NewSampler(1, 0, time.Second),
+			messages:   []string{"a", "b", "a", "b"},
+			wantAllows: []bool{true, true, false, false},
+		},
+		{
+			name:       "reset every tick",
+			sampler:    NewSampler(1, 0, time.Second),
+			messages:   []string{"a", "a", "a", "a"},
+			advance:    map[int]time.Duration{2: time.Second},
+			wantAllows: []bool{true, false, true, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+			if tt.sampler != nil {
+				tt.sampler.now = func() time.Time { return now }
+			}
+
+			got := make([]bool, len(tt.messages))
+			for i, m := range tt.messages {
+				now = now.Add(tt.advance[i])
+				got[i] = tt.sampler.Allow(m)
+			}
+			testutil.Equals(t, tt.wantAllows, got)
+		})
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{name: "invalid level", cfg: Config{Level: "loud", Format: FormatText}, wantErr: `not a valid logrus Level: "loud"`},
+		{name: "invalid format", cfg: Config{Level: "info", Format: "xml"}, wantErr: "unknown log format xml"},
+		{name: "json", cfg: Config{Level: "debug", Format: FormatJSON, RedactFields: []string{"email"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.CompareError(t, tt.wantErr, Configure(tt.cfg))
+		})
+	}
+	testutil.Ok(t, Configure(Config{Level: "info", Format: FormatText}))
+}
+
+func TestLogger_sampledAfterLevel(t *testing.T) {
+	previous, _ := sampler.Load().(*Sampler)
+	defer sampler.Store(previous)
+	sampler.Store(NewSampler(1, 0, time.Minute))
+
+	var buf bytes.Buffer
+	l := logrus.New()
+	l.SetOutput(&buf)
+	l.SetLevel(logrus.InfoLevel)
+	logger := NewLogger(logrus.NewEntry(l))
+
+	// the disabled debug log must not use up the budget of the message
+	logger.DebugF("delivered %v", "msg0")
+	logger.InfoF("delivered %v", "msg0")
+	logger.InfoF("delivered %v", "msg1")
+	testutil.Equals(t, 1, strings.Count(buf.String(), "delivered"))
+	testutil.Asserts(t, strings.Contains(buf.String(), "msg0"), "first info log should be written")
+}
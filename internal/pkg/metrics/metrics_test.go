@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	counter := NewCounterVec("test_deliveries_total", "Deliveries by outcome.", "business_id", "outcome")
+	counter.Inc("user00", "success")
+	counter.Inc("user00", "success")
+	counter.Add(3, `us"er\01`, "failed")
+
+	gauge := NewGaugeVec("test_in_flight", "In flight deliveries.")
+	gauge.Add(2)
+	gauge.Add(-1)
+
+	histogram := NewHistogramVec("test_duration_seconds", "Callback duration.", []float64{1, 0.5}, "outcome")
+	histogram.Observe(0.2, "success")
+	histogram.Observe(0.7, "success")
+	histogram.Observe(3, "success")
+
+	r := NewRegistry()
+	testutil.Ok(t, r.Register(counter, gauge, histogram))
+	testutil.CompareError(t, "metric test_in_flight already registered", r.Register(NewGaugeVec("test_in_flight", "")))
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	testutil.Equals(t, http.StatusOK, rr.Code)
+	testutil.Equals(t, contentType, rr.Header().Get("Content-Type"))
+	testutil.Equals(t, `# HELP test_deliveries_total Deliveries by outcome.
+# TYPE test_deliveries_total counter
+test_deliveries_total{business_id="us\"er\\01",outcome="failed"} 3
+test_deliveries_total{business_id="user00",outcome="success"} 2
+# HELP test_duration_seconds Callback duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{outcome="success",le="0.5"} 1
+test_duration_seconds_bucket{outcome="success",le="1"} 2
+test_duration_seconds_bucket{outcome="success",le="+Inf"} 3
+test_duration_seconds_sum{outcome="success"} 3.9
+test_duration_seconds_count{outcome="success"} 3
+# HELP test_in_flight In flight deliveries.
+# TYPE test_in_flight gauge
+test_in_flight 1
+`, rr.Body.String())
+}
+
+func TestBusinessIDLabel(t *testing.T) {
+	defer func() { HashBusinessID = false }()
+
+	testutil.Equals(t, "user00", BusinessIDLabel("user00"))
+
+	HashBusinessID = true
+	hashed := BusinessIDLabel("user00")
+	testutil.Asserts(t, hashed != "user00", "business_id should be hashed")
+	testutil.Equals(t, 16, len(hashed))
+	testutil.Equals(t, hashed, BusinessIDLabel("user00"))
+}
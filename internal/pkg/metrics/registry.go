@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// contentType is the Prometheus text exposition format
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultRegistry is the registry served by Handler
+var DefaultRegistry = NewRegistry()
+
+// Registry holds the collectors exposed on one endpoint
+type Registry struct {
+	mu         sync.RWMutex
+	collectors map[string]Collector
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]Collector)}
+}
+
+// Register adds the collectors, names must be unique within the registry
+func (r *Registry) Register(collectors ...Collector) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range collectors {
+		if _, ok := r.collectors[c.Name()]; ok {
+			return fmt.Errorf("metric %s already registered", c.Name())
+		}
+		r.collectors[c.Name()] = c
+	}
+	return nil
+}
+
+// MustRegister registers the collectors to DefaultRegistry and panics on duplicates
+func MustRegister(collectors ...Collector) {
+	if err := DefaultRegistry.Register(collectors...); err != nil {
+		panic(err)
+	}
+}
+
+// ServeHTTP writes all collectors sorted by name
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		if err := r.collectors[name].Write(&buf); err != nil {
+			r.mu.RUnlock()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	r.mu.RUnlock()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(buf.Bytes())
+}
+
+// Handler returns the http.Handler exposing DefaultRegistry
+func Handler() http.Handler {
+	return DefaultRegistry
+}
@@ -23,11 +23,109 @@ type Publisher interface {
 	Stop()
 }
 
+// Checker is implemented by agents able to report their connection status
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
 // workerFunc is a named type that represents the worker function signature
 type workerFunc func(ctx context.Context, b []byte) error
 
-// Make sure agent implements Publisher
+// requeueError marks a worker error as transient
+type requeueError struct {
+	err error
+}
+
+func (e requeueError) Error() string {
+	return e.err.Error()
+}
+
+func (e requeueError) Unwrap() error {
+	return e.err
+}
+
+// Requeue wraps the error returned by a worker func so that the message is requeued instead of dropped or
+// dead-lettered, at most maxRedeliveries times. It has no effect on workers with `autoAck`
+func Requeue(err error) error {
+	if err == nil {
+		return nil
+	}
+	return requeueError{err: err}
+}
+
+// shouldRequeue tells if the worker error asks for the message to be requeued
+func shouldRequeue(err error) bool {
+	var re requeueError
+	return errors.As(err, &re)
+}
+
+// maxRedeliveries bounds the deliveries of a message whose worker asks to requeue it, it is dead-lettered afterwards
+const maxRedeliveries = 5
+
+// retryCountHeader counts the requeues of a message, as classic queues do not count the deliveries
+const retryCountHeader = "x-retry-count"
+
+// deadLetterQueue returns the queue receiving the failed messages of the queue, see WithDeadLetter
+func deadLetterQueue(queueName string) string {
+	return queueName + ".dead-letter"
+}
+
+// WorkerOption configures the worker of NewWorker
+type WorkerOption func(a *agent)
+
+// WithDeadLetter publishes the messages failed by the worker func to the queue suffixed with .dead-letter instead of
+// dropping them. The worker publishes them itself, so the queue is declared without arguments as by its publishers.
+// Migration: a queue declared with x-dead-letter-* arguments fails this declaration with PRECONDITION_FAILED, it is
+// drained and deleted before the deploy
+func WithDeadLetter() WorkerOption {
+	return func(a *agent) {
+		a.deadLetter = true
+	}
+}
+
+// disposition is what is done with a consumed message
+type disposition int
+
+const (
+	dispositionAck disposition = iota
+	dispositionRequeue
+	dispositionDeadLetter
+)
+
+// dispose tells what is done with a message given the error of the worker and the number of times it was requeued.
+// Failed messages are acknowledged, or dead-lettered with deadLetter, unless the worker asks to requeue them, at most
+// maxRedeliveries times
+func dispose(err error, retries int, deadLetter bool) disposition {
+	switch {
+	case err == nil:
+		return dispositionAck
+	case shouldRequeue(err) && retries < maxRedeliveries:
+		return dispositionRequeue
+	case deadLetter:
+		return dispositionDeadLetter
+	default:
+		return dispositionAck
+	}
+}
+
+// retryCount returns the number of times the message was requeued, quorum queues count the deliveries themselves
+func retryCount(headers amqp.Table) int {
+	for _, key := range []string{retryCountHeader, "x-delivery-count"} {
+		switch v := headers[key].(type) {
+		case int32:
+			return int(v)
+		case int64:
+			return int(v)
+		case int:
+			return v
+		}
+	}
+	return 0
+}
+
+// Make sure agent implements Publisher and Checker
 var _ Publisher = (*agent)(nil)
+var _ Checker = (*agent)(nil)
 
 // agent is the default jobqueue agent which serves as a publisher and manages worker func
 type agent struct {
@@ -47,6 +145,8 @@ type agent struct {
 	workerFunc workerFunc
 	// autoAck is a flag to indicate whether the consumer will auto-acknowledge messages
 	autoAck bool
+	// deadLetter publishes the failed messages to the dead-letter queue, see WithDeadLetter
+	deadLetter bool
 }
 
 // NewPublisher connects to rabbitmq, returns a publisher where you can call `Publish`
@@ -71,7 +171,7 @@ func NewPublisher(ctx context.Context, queueName, amqpURL string, connBackOff ba
 //
 // when `autoAck` is false, watch out for rabbitmq re-queuing messages upon errors (e.g. connection drop)
 // https://www.rabbitmq.com/confirms.html#automatic-requeueing
-func NewWorker(ctx context.Context, queueName, amqpURL string, connBackOff backoff.BackOff, autoAck bool, callback workerFunc) (context.CancelFunc, error) {
+func NewWorker(ctx context.Context, queueName, amqpURL string, connBackOff backoff.BackOff, autoAck bool, callback workerFunc, opts ...WorkerOption) (context.CancelFunc, error) {
 	agentCtx, agentCancel := context.WithCancel(ctx)
 	logger := loglib.GetLogger(agentCtx).
 		WithField("queue", queueName).
@@ -88,6 +188,9 @@ func NewWorker(ctx context.Context, queueName, amqpURL string, connBackOff backo
 		workerFunc: recoverWorkerFunc(logger, callback),
 		autoAck:    autoAck,
 	}
+	for _, opt := range opts {
+		opt(a)
+	}
 	return a.Stop, a.connect()
 }
 
@@ -96,6 +199,16 @@ func (a *agent) Stop() {
 	a.wg.Wait()
 }
 
+// Check returns an error when the agent is not connected to rabbitmq
+func (a *agent) Check(_ context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.conn == nil || a.conn.IsClosed() {
+		return fmt.Errorf("not connected to %q", a.queueName)
+	}
+	return nil
+}
+
 // Publish marshals a job into JSON and delivers it to rabbitmq
 func (a *agent) Publish(ctx context.Context, job interface{}, b backoff.BackOff) error {
 	payload, err := json.Marshal(job)
@@ -193,10 +306,7 @@ func (a *agent) runWorker() error {
 						a.reportError(err)
 					}
 					if !a.autoAck {
-						// only this message; not "all messages before this"
-						if err := d.Ack(false); err != nil {
-							logger.ErrorF("ack failed: %q", err.Error())
-						}
+						a.settle(logger, d, err)
 					}
 				}
 			}
@@ -206,6 +316,57 @@ func (a *agent) runWorker() error {
 	return err
 }
 
+// settle acknowledges the message, or publishes it again to the queue with its retry count or to the dead-letter
+// queue before acknowledging it
+func (a *agent) settle(logger *loglib.Logger, d amqp.Delivery, err error) {
+	retries := retryCount(d.Headers)
+	var republishErr error
+	switch dispose(err, retries, a.deadLetter) {
+	case dispositionRequeue:
+		// the message is published again so that it carries its retry count
+		republishErr = a.republish(d, a.queueName, retries+1)
+	case dispositionDeadLetter:
+		logger.WarnF("dead-lettering message %s after %d retries", d.MessageId, retries)
+		republishErr = a.republish(d, deadLetterQueue(a.queueName), retries)
+	}
+	if republishErr != nil {
+		// the message is delivered again rather than lost
+		logger.ErrorF("republish failed: %q", republishErr.Error())
+		if err := d.Nack(false, true); err != nil {
+			logger.ErrorF("nack failed: %q", err.Error())
+		}
+		return
+	}
+	// only this message; not "all messages before this"
+	if err := d.Ack(false); err != nil {
+		logger.ErrorF("ack failed: %q", err.Error())
+	}
+}
+
+// republish publishes the delivered message again to the queue with the retry count
+func (a *agent) republish(d amqp.Delivery, queueName string, retries int) error {
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[retryCountHeader] = int32(retries)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.ch.Publish(
+		"",        // exchange
+		queueName, // routing key
+		false,     // mandatory
+		false,
+		amqp.Publishing{
+			Headers:      headers,
+			MessageId:    d.MessageId,
+			DeliveryMode: amqp.Persistent,
+			ContentType:  d.ContentType,
+			Body:         d.Body,
+		})
+}
+
 // [repeatedly] tries to connect (with backoff) to rabbitmq
 func (a *agent) connect() error {
 	err := backoff.Retry(func() error {
@@ -259,6 +420,18 @@ func (a *agent) openChannel() error {
 	a.ch = ch
 	a.mu.Unlock()
 
+	if a.deadLetter {
+		if _, err := ch.QueueDeclare(
+			deadLetterQueue(a.queueName), // name
+			true,                         // durable
+			false,                        // delete when unused
+			false,                        // exclusive
+			false,                        // no-wait
+			nil,                          // arguments
+		); err != nil {
+			return err
+		}
+	}
 	_, err = ch.QueueDeclare(
 		a.queueName, // name
 		true,        // durable
@@ -0,0 +1,76 @@
+package jobqueue2
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/kagelui/notification/internal/testutil"
+	"github.com/streadway/amqp"
+)
+
+func TestRequeue(t *testing.T) {
+	given := errors.New("db down")
+	tests := []struct {
+		name        string
+		err         error
+		wantRequeue bool
+	}{
+		{name: "nil", err: nil, wantRequeue: false},
+		{name: "plain error", err: given, wantRequeue: false},
+		{name: "requeue", err: Requeue(given), wantRequeue: true},
+		{name: "wrapped requeue", err: fmt.Errorf("store: %w", Requeue(given)), wantRequeue: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.Equals(t, tt.wantRequeue, shouldRequeue(tt.err))
+		})
+	}
+
+	testutil.Asserts(t, Requeue(nil) == nil, "requeue of nil should be nil")
+	testutil.Asserts(t, errors.Is(Requeue(given), given), "requeue should unwrap to the original error")
+	testutil.Equals(t, given.Error(), Requeue(given).Error())
+}
+
+func TestDispose(t *testing.T) {
+	given := errors.New("db down")
+	tests := []struct {
+		name       string
+		err        error
+		retries    int
+		deadLetter bool
+		want       disposition
+	}{
+		{name: "success", err: nil, retries: 0, deadLetter: true, want: dispositionAck},
+		{name: "success after retries", err: nil, retries: maxRedeliveries, deadLetter: true, want: dispositionAck},
+		{name: "permanent error", err: given, retries: 0, deadLetter: true, want: dispositionDeadLetter},
+		{name: "permanent error without dead-letter queue", err: given, retries: 0, want: dispositionAck},
+		{name: "requeue", err: Requeue(given), retries: 0, deadLetter: true, want: dispositionRequeue},
+		{name: "last requeue", err: Requeue(given), retries: maxRedeliveries - 1, deadLetter: true, want: dispositionRequeue},
+		{name: "requeues exhausted", err: Requeue(given), retries: maxRedeliveries, deadLetter: true, want: dispositionDeadLetter},
+		{name: "requeues exhausted without dead-letter queue", err: Requeue(given), retries: maxRedeliveries, want: dispositionAck},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.Equals(t, tt.want, dispose(tt.err, tt.retries, tt.deadLetter))
+		})
+	}
+}
+
+func TestRetryCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers amqp.Table
+		want    int
+	}{
+		{name: "no headers", headers: nil, want: 0},
+		{name: "retry count", headers: amqp.Table{retryCountHeader: int32(2)}, want: 2},
+		{name: "quorum queue delivery count", headers: amqp.Table{"x-delivery-count": int64(3)}, want: 3},
+		{name: "unexpected type", headers: amqp.Table{retryCountHeader: "2"}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.Equals(t, tt.want, retryCount(tt.headers))
+		})
+	}
+}
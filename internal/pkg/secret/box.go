@@ -0,0 +1,112 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// prefix marks the sealed values, so that they are not mistaken for plaintext
+const prefix = "enc:v1:"
+
+// KeySize is the size of the keys of Box, which encrypts with AES-256-GCM
+const KeySize = 32
+
+var (
+	// ErrNotSealed is returned when opening a value which was not sealed by a Box
+	ErrNotSealed = errors.New("value is not sealed")
+	// ErrNoKey is returned by a nil Box, i.e. when no key is configured
+	ErrNoKey = errors.New("no secrets key configured")
+)
+
+// Box seals small secrets stored in the database, e.g. credentials of the callback URLs
+type Box struct {
+	aead cipher.AEAD
+}
+
+// NewBox returns a Box sealing with the key of KeySize bytes
+func NewBox(key []byte) (*Box, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("secrets key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+// ParseKey returns the Box sealing with the base64 encoded key, a nil Box is returned for an empty key
+func ParseKey(encoded string) (*Box, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("secrets key: %v", err)
+	}
+	return NewBox(key)
+}
+
+// Seal encrypts the plaintext with a random nonce
+func (b *Box) Seal(plaintext string) (string, error) {
+	if b == nil {
+		return "", ErrNoKey
+	}
+	sealed, err := b.seal([]byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts the value sealed by Seal
+func (b *Box) Open(sealed string) (string, error) {
+	if b == nil {
+		return "", ErrNoKey
+	}
+	if !IsSealed(sealed) {
+		return "", ErrNotSealed
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(sealed, prefix))
+	if err != nil {
+		return "", fmt.Errorf("opening secret: %v", err)
+	}
+	plaintext, err := b.open(data)
+	if err != nil {
+		return "", fmt.Errorf("opening secret: %v", err)
+	}
+	return string(plaintext), nil
+}
+
+// seal encrypts the plaintext with a random nonce, which prefixes the ciphertext
+func (b *Box) seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return b.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open decrypts the nonce prefixed ciphertext of seal
+func (b *Box) open(data []byte) ([]byte, error) {
+	if len(data) < b.aead.NonceSize() {
+		return nil, errors.New("value too short")
+	}
+	nonce, ciphertext := data[:b.aead.NonceSize()], data[b.aead.NonceSize():]
+	return b.aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// IsSealed tells if the value was sealed by a Box
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
@@ -0,0 +1,67 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+		wantNil bool
+		wantErr string
+	}{
+		{name: "empty", encoded: "", wantNil: true},
+		{name: "not base64", encoded: "not a key!", wantErr: "secrets key: illegal base64 data at input byte 3"},
+		{name: "too short", encoded: base64.StdEncoding.EncodeToString([]byte("short")), wantErr: "secrets key must be 32 bytes, got 5"},
+		{name: "valid", encoded: base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, KeySize)) + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			box, err := ParseKey(tt.encoded)
+			testutil.CompareError(t, tt.wantErr, err)
+			if err == nil {
+				testutil.Equals(t, tt.wantNil, box == nil)
+			}
+		})
+	}
+}
+
+func TestBox(t *testing.T) {
+	box, err := NewBox(bytes.Repeat([]byte{1}, KeySize))
+	testutil.Ok(t, err)
+	other, err := NewBox(bytes.Repeat([]byte{2}, KeySize))
+	testutil.Ok(t, err)
+
+	sealed, err := box.Seal("client secret")
+	testutil.Ok(t, err)
+	testutil.Asserts(t, IsSealed(sealed), "value should be sealed")
+	again, err := box.Seal("client secret")
+	testutil.Ok(t, err)
+	testutil.Asserts(t, sealed != again, "nonce should be random")
+
+	tests := []struct {
+		name    string
+		box     *Box
+		sealed  string
+		want    string
+		wantErr string
+	}{
+		{name: "opened", box: box, sealed: sealed, want: "client secret"},
+		{name: "plaintext", box: box, sealed: "client secret", wantErr: ErrNotSealed.Error()},
+		{name: "truncated", box: box, sealed: prefix + "AAAA", wantErr: "opening secret: value too short"},
+		{name: "other key", box: other, sealed: sealed, wantErr: "opening secret: cipher: message authentication failed"},
+		{name: "no key", box: nil, sealed: sealed, wantErr: ErrNoKey.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.box.Open(tt.sealed)
+			testutil.CompareError(t, tt.wantErr, err)
+			testutil.Equals(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package secret
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// envelopePrefix marks the values sealed by a Keyring
+const envelopePrefix = "env:v1:"
+
+// ErrUnknownKey is returned when opening a value sealed by a key missing from the keyring
+var ErrUnknownKey = errors.New("unknown keyring key")
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Keyring seals values with envelope encryption: every value is sealed by its own data key, which is sealed by the
+// primary key of the keyring. The ID of the sealing key is stored next to the value, so that the keys can rotate
+type Keyring struct {
+	primary string
+	keys    map[string]*Box
+}
+
+// Key is a key of a Keyring
+type Key struct {
+	ID  string
+	Key []byte
+}
+
+// NewKeyring returns a Keyring sealing with the first key, the other keys only open the values they sealed
+func NewKeyring(keys ...Key) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("keyring has no keys")
+	}
+	k := &Keyring{primary: keys[0].ID, keys: make(map[string]*Box, len(keys))}
+	for _, key := range keys {
+		if !keyIDPattern.MatchString(key.ID) {
+			return nil, fmt.Errorf("invalid keyring key ID %q", key.ID)
+		}
+		if _, ok := k.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate keyring key ID %q", key.ID)
+		}
+		box, err := NewBox(key.Key)
+		if err != nil {
+			return nil, fmt.Errorf("keyring key %s: %v", key.ID, err)
+		}
+		k.keys[key.ID] = box
+	}
+	return k, nil
+}
+
+// LoadKeyring reads the keyring file, a nil Keyring is returned for an empty path.
+// The file has one key per line, its ID and its base64 encoded key separated by spaces, e.g.
+//
+//	# the first key seals, the others only open
+//	2021-05 q0E4b2...=
+//	2021-01 Zm9vYm...=
+func LoadKeyring(path string) (*Keyring, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readKeyring(f)
+}
+
+func readKeyring(r io.Reader) (*Keyring, error) {
+	var keys []Key
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("keyring line %d: expected a key ID and a key", n)
+		}
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("keyring line %d: %v", n, err)
+		}
+		keys = append(keys, Key{ID: fields[0], Key: key})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewKeyring(keys...)
+}
+
+// Primary returns the ID of the key sealing the values, which is empty for a nil Keyring
+func (k *Keyring) Primary() string {
+	if k == nil {
+		return ""
+	}
+	return k.primary
+}
+
+// Seal encrypts the plaintext with a random data key sealed by the primary key, whose ID is returned
+func (k *Keyring) Seal(plaintext string) (keyID, sealed string, err error) {
+	if k == nil {
+		return "", "", ErrNoKey
+	}
+	dataKey := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", "", err
+	}
+	box, err := NewBox(dataKey)
+	if err != nil {
+		return "", "", err
+	}
+	ciphertext, err := box.seal([]byte(plaintext))
+	if err != nil {
+		return "", "", err
+	}
+	wrapped, err := k.keys[k.primary].seal(dataKey)
+	if err != nil {
+		return "", "", err
+	}
+	sealed = envelopePrefix + base64.StdEncoding.EncodeToString(wrapped) + ":" + base64.StdEncoding.EncodeToString(ciphertext)
+	return k.primary, sealed, nil
+}
+
+// Open decrypts the value sealed by the key with the ID
+func (k *Keyring) Open(keyID, sealed string) (string, error) {
+	if k == nil {
+		return "", ErrNoKey
+	}
+	kek, ok := k.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	if !IsEnvelope(sealed) {
+		return "", ErrNotSealed
+	}
+	parts := strings.SplitN(strings.TrimPrefix(sealed, envelopePrefix), ":", 2)
+	if len(parts) != 2 {
+		return "", errors.New("opening envelope: missing data key")
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", fmt.Errorf("opening envelope: %v", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("opening envelope: %v", err)
+	}
+	dataKey, err := kek.open(wrapped)
+	if err != nil {
+		return "", fmt.Errorf("opening envelope data key: %v", err)
+	}
+	box, err := NewBox(dataKey)
+	if err != nil {
+		return "", fmt.Errorf("opening envelope: %v", err)
+	}
+	plaintext, err := box.open(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("opening envelope: %v", err)
+	}
+	return string(plaintext), nil
+}
+
+// IsEnvelope tells if the value was sealed by a Keyring
+func IsEnvelope(value string) bool {
+	return strings.HasPrefix(value, envelopePrefix)
+}
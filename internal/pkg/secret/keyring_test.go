@@ -0,0 +1,81 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+func TestReadKeyring(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, KeySize))
+	tests := []struct {
+		name        string
+		file        string
+		wantPrimary string
+		wantErr     string
+	}{
+		{name: "empty", file: "# no keys\n", wantErr: "keyring has no keys"},
+		{name: "missing key", file: "2021-05\n", wantErr: "keyring line 1: expected a key ID and a key"},
+		{name: "not base64", file: "2021-05 not!base64", wantErr: "keyring line 1: illegal base64 data at input byte 3"},
+		{name: "too short", file: "2021-05 c2hvcnQ=", wantErr: "keyring key 2021-05: secrets key must be 32 bytes, got 5"},
+		{name: "invalid ID", file: "2021/05 " + key, wantErr: `invalid keyring key ID "2021/05"`},
+		{name: "duplicate ID", file: "2021-05 " + key + "\n2021-05 " + key, wantErr: `duplicate keyring key ID "2021-05"`},
+		{name: "valid", file: "# the first key seals\n\n2021-05 " + key + "\n  2021-01 " + key + "  \n", wantPrimary: "2021-05"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := readKeyring(strings.NewReader(tt.file))
+			testutil.CompareError(t, tt.wantErr, err)
+			testutil.Equals(t, tt.wantPrimary, keys.Primary())
+		})
+	}
+}
+
+func TestKeyring(t *testing.T) {
+	old, err := NewKeyring(Key{ID: "2021-01", Key: bytes.Repeat([]byte{1}, KeySize)})
+	testutil.Ok(t, err)
+	rotated, err := NewKeyring(Key{ID: "2021-05", Key: bytes.Repeat([]byte{2}, KeySize)}, Key{ID: "2021-01", Key: bytes.Repeat([]byte{1}, KeySize)})
+	testutil.Ok(t, err)
+	other, err := NewKeyring(Key{ID: "2021-01", Key: bytes.Repeat([]byte{3}, KeySize)})
+	testutil.Ok(t, err)
+
+	keyID, sealed, err := old.Seal("account number")
+	testutil.Ok(t, err)
+	testutil.Equals(t, "2021-01", keyID)
+	testutil.Asserts(t, IsEnvelope(sealed), "value should be an envelope")
+	testutil.Asserts(t, !strings.Contains(sealed, "account"), "value should be encrypted")
+	_, again, err := old.Seal("account number")
+	testutil.Ok(t, err)
+	testutil.Asserts(t, sealed != again, "data key should be random")
+
+	keyID, _, err = rotated.Seal("account number")
+	testutil.Ok(t, err)
+	testutil.Equals(t, "2021-05", keyID)
+
+	tests := []struct {
+		name    string
+		keys    *Keyring
+		keyID   string
+		sealed  string
+		want    string
+		wantErr string
+	}{
+		{name: "opened", keys: old, keyID: "2021-01", sealed: sealed, want: "account number"},
+		{name: "opened after rotation", keys: rotated, keyID: "2021-01", sealed: sealed, want: "account number"},
+		{name: "unknown key", keys: rotated, keyID: "2020-01", sealed: sealed, wantErr: `unknown keyring key "2020-01"`},
+		{name: "plaintext", keys: old, keyID: "2021-01", sealed: "account number", wantErr: ErrNotSealed.Error()},
+		{name: "truncated", keys: old, keyID: "2021-01", sealed: envelopePrefix + "AAAA", wantErr: "opening envelope: missing data key"},
+		{name: "other key", keys: other, keyID: "2021-01", sealed: sealed, wantErr: "opening envelope data key: cipher: message authentication failed"},
+		{name: "no key", keys: nil, keyID: "2021-01", sealed: sealed, wantErr: ErrNoKey.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.keys.Open(tt.keyID, tt.sealed)
+			testutil.CompareError(t, tt.wantErr, err)
+			testutil.Equals(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AdminConfig configures the admin listener, it is read from the environment with the ADMIN_ prefix.
+// The listener is off unless Addr is set, addresses other than loopback need a bearer token or verified client
+// certificates
+type AdminConfig struct {
+	Addr string `env:"ADDR,optional"`
+	// WriteTimeout replaces the write timeout of the server, net/http/pprof rejects the profiles and traces lasting
+	// as long, 30s by default
+	WriteTimeout time.Duration `env:"WRITE_TIMEOUT,default=2m"`
+	// Token is the bearer token of the admin requests, the probes are served without it
+	Token string    `env:"TOKEN,optional,secret"`
+	TLS   TLSConfig `env:"TLS_"`
+}
+
+// unauthenticatedPaths are served without the admin token so that the kubelet can probe the admin listener
+var unauthenticatedPaths = map[string]bool{"/healthz": true, "/readyz": true}
+
+// validate checks that the listener is authenticated unless it is bound to loopback
+func (c AdminConfig) validate() error {
+	if c.Token != "" || isLoopback(c.Addr) {
+		return nil
+	}
+	if c.TLS.Enabled() {
+		auth, err := c.TLS.clientAuth()
+		if err != nil {
+			return err
+		}
+		if auth == tls.RequireAndVerifyClientCert {
+			return nil
+		}
+	}
+	return fmt.Errorf("admin listener %s is not on loopback, it needs a token or verified client certificates", c.Addr)
+}
+
+// isLoopback tells if the listen address only accepts local connections, an empty host listens on all interfaces
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// requireToken rejects the requests without the bearer token, except for the probes
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unauthenticatedPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		auth := r.Header.Get("Authorization")
+		const prefix = "Bearer "
+		if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) ||
+			subtle.ConstantTimeCompare([]byte(auth[len(prefix):]), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
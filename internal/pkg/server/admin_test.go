@@ -0,0 +1,84 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+func TestAdminConfig_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     AdminConfig
+		wantErr string
+	}{
+		{name: "loopback", cfg: AdminConfig{Addr: "127.0.0.1:8081"}},
+		{name: "ipv6 loopback", cfg: AdminConfig{Addr: "[::1]:8081"}},
+		{name: "localhost", cfg: AdminConfig{Addr: "localhost:8081"}},
+		{name: "all interfaces with token", cfg: AdminConfig{Addr: ":8081", Token: "secret"}},
+		{
+			name: "all interfaces with verified client certificates",
+			cfg:  AdminConfig{Addr: ":8081", TLS: TLSConfig{CertFile: "admin.crt", KeyFile: "admin.key", ClientCAFile: "ca.crt"}},
+		},
+		{
+			name:    "all interfaces",
+			cfg:     AdminConfig{Addr: ":8081"},
+			wantErr: "admin listener :8081 is not on loopback",
+		},
+		{
+			name:    "TLS without client certificates",
+			cfg:     AdminConfig{Addr: "10.0.0.1:8081", TLS: TLSConfig{CertFile: "admin.crt", KeyFile: "admin.key"}},
+			wantErr: "admin listener 10.0.0.1:8081 is not on loopback",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.CompareError(t, tt.wantErr, tt.cfg.validate())
+		})
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		wantStatus    int
+	}{
+		{name: "token", path: "/metrics", authorization: "Bearer secret", wantStatus: http.StatusNoContent},
+		{name: "lowercase scheme", path: "/metrics", authorization: "bearer secret", wantStatus: http.StatusNoContent},
+		{name: "no token", path: "/metrics", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", path: "/metrics", authorization: "Bearer guess", wantStatus: http.StatusUnauthorized},
+		{name: "basic", path: "/metrics", authorization: "Basic c2VjcmV0", wantStatus: http.StatusUnauthorized},
+		{name: "probe", path: "/readyz", wantStatus: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rr := httptest.NewRecorder()
+			requireToken("secret", next).ServeHTTP(rr, req)
+			testutil.Equals(t, tt.wantStatus, rr.Code)
+		})
+	}
+}
+
+func TestApp_SetAdmin(t *testing.T) {
+	app := New(":8080", http.NotFoundHandler())
+	testutil.Ok(t, app.SetAdmin(AdminConfig{Addr: "127.0.0.1:8081", WriteTimeout: 2 * time.Minute}, http.NotFoundHandler()))
+	testutil.Equals(t, 2*time.Minute, app.admin.WriteTimeout)
+	testutil.Equals(t, DefaultTimeouts.Read, app.admin.ReadTimeout)
+
+	// timeouts set afterwards apply to the admin listener as well, but its write timeout which outlasts the profiles
+	app.SetTimeouts(Timeouts{ReadHeader: time.Second, Read: time.Second, Write: time.Minute, Idle: time.Second})
+	testutil.Equals(t, 2*time.Minute, app.admin.WriteTimeout)
+	testutil.Equals(t, time.Second, app.admin.ReadTimeout)
+
+	testutil.CompareError(t, "is not on loopback", app.SetAdmin(AdminConfig{Addr: ":8081"}, http.NotFoundHandler()))
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -10,27 +11,141 @@ import (
 	"time"
 )
 
+// Timeouts bounds the time spent on a connection, it is read from the environment with the SERVER_ prefix.
+// Write must be longer than the slowest handler, see web.Timeout
+type Timeouts struct {
+	ReadHeader time.Duration `env:"READ_HEADER_TIMEOUT,default=5s"`
+	Read       time.Duration `env:"READ_TIMEOUT,default=15s"`
+	Write      time.Duration `env:"WRITE_TIMEOUT,default=30s"`
+	Idle       time.Duration `env:"IDLE_TIMEOUT,default=60s"`
+}
+
+// DefaultTimeouts are the timeouts of the server returned by New
+var DefaultTimeouts = Timeouts{
+	ReadHeader: 5 * time.Second,
+	Read:       15 * time.Second,
+	Write:      30 * time.Second,
+	Idle:       60 * time.Second,
+}
+
 type App struct {
-	server *http.Server
-	logger *log.Logger
+	server     *http.Server
+	admin      *http.Server
+	adminWrite time.Duration
+	certs      *certReloader
+	adminCerts *certReloader
+	timeouts   Timeouts
+	logger     *log.Logger
+	readiness  *Readiness
 }
 
 func New(addr string, handler http.Handler) *App {
-	return &App{
+	a := &App{
 		server: &http.Server{Addr: addr, Handler: handler},
 		logger: log.New(os.Stderr, "", log.Ldate|log.Ltime|log.Lshortfile),
 	}
+	a.SetTimeouts(DefaultTimeouts)
+	return a
+}
+
+// SetTimeouts sets the timeouts of the server and of the admin listener, it must be called before Start
+func (a *App) SetTimeouts(t Timeouts) {
+	a.timeouts = t
+	t.apply(a.server)
+	if a.admin != nil {
+		t.apply(a.admin)
+		a.admin.WriteTimeout = a.adminWrite
+	}
+}
+
+func (t Timeouts) apply(s *http.Server) {
+	s.ReadHeaderTimeout = t.ReadHeader
+	s.ReadTimeout = t.Read
+	s.WriteTimeout = t.Write
+	s.IdleTimeout = t.Idle
+}
+
+// SetTLS serves the app over TLS, the certificate and client CAs are reloaded when their files change.
+// It must be called before Start
+func (a *App) SetTLS(cfg TLSConfig) error {
+	certs, err := newCertReloader(cfg, a.logger)
+	if err != nil {
+		return err
+	}
+	a.certs = certs
+	a.server.TLSConfig = certs.tlsConfig()
+	return nil
+}
+
+// SetAdmin serves the handler on a separate listener with the timeouts of the server but its write timeout, e.g. for
+// metrics and pprof which should not be exposed on the public port. Requests need the bearer token when set and the listener is
+// served over TLS when configured. It must be called before Start
+func (a *App) SetAdmin(cfg AdminConfig, handler http.Handler) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	if cfg.Token != "" {
+		handler = requireToken(cfg.Token, handler)
+	}
+	admin := &http.Server{Addr: cfg.Addr, Handler: handler}
+	a.timeouts.apply(admin)
+	a.adminWrite = cfg.WriteTimeout
+	admin.WriteTimeout = cfg.WriteTimeout
+	if cfg.TLS.Enabled() {
+		certs, err := newCertReloader(cfg.TLS, a.logger)
+		if err != nil {
+			return fmt.Errorf("admin: %v", err)
+		}
+		a.adminCerts = certs
+		admin.TLSConfig = certs.tlsConfig()
+	}
+	a.admin = admin
+	return nil
+}
+
+// SetReadiness sets the readiness probe which is drained as soon as a termination signal is received
+func (a *App) SetReadiness(r *Readiness) {
+	a.readiness = r
 }
 
 // Start starts the server asynchronously and wait for termination
 func (a *App) Start() {
 	// starts server asynchronously
 	go func() {
-		a.logger.Printf("Server started at port %s", a.server.Addr)
-		if err := a.server.ListenAndServe(); err != http.ErrServerClosed {
-			a.logger.Fatalf("ListenAndServe: %s", err)
+		if a.certs == nil {
+			a.logger.Printf("Server started at port %s", a.server.Addr)
+			if err := a.server.ListenAndServe(); err != http.ErrServerClosed {
+				a.logger.Fatalf("ListenAndServe: %s", err)
+			}
+			return
+		}
+		if err := a.certs.watch(); err != nil {
+			a.logger.Printf("Could not watch TLS certificate, it will not be reloaded: %v", err)
+		}
+		a.logger.Printf("TLS server started at port %s", a.server.Addr)
+		// the certificate is served by the TLS config
+		if err := a.server.ListenAndServeTLS("", ""); err != http.ErrServerClosed {
+			a.logger.Fatalf("ListenAndServeTLS: %s", err)
 		}
 	}()
+	if a.admin != nil {
+		go func() {
+			if a.adminCerts == nil {
+				a.logger.Printf("Admin server started at port %s", a.admin.Addr)
+				if err := a.admin.ListenAndServe(); err != http.ErrServerClosed {
+					a.logger.Fatalf("Admin ListenAndServe: %s", err)
+				}
+				return
+			}
+			if err := a.adminCerts.watch(); err != nil {
+				a.logger.Printf("Could not watch admin TLS certificate, it will not be reloaded: %v", err)
+			}
+			a.logger.Printf("Admin TLS server started at port %s", a.admin.Addr)
+			if err := a.admin.ListenAndServeTLS("", ""); err != http.ErrServerClosed {
+				a.logger.Fatalf("Admin ListenAndServeTLS: %s", err)
+			}
+		}()
+	}
 
 	// Handle graceful shutdown
 	// Channel to listen for an interrupt or terminate signal from the OS.
@@ -38,6 +153,10 @@ func (a *App) Start() {
 	signal.Notify(osSignals, os.Interrupt, syscall.SIGTERM)
 	// Block waiting for a receive on signal from OS
 	s := <-osSignals
+	if a.readiness != nil {
+		a.logger.Printf("%s received. Failing readiness probe", s)
+		a.readiness.Drain()
+	}
 	switch s {
 	case syscall.SIGTERM:
 		d := 10 * time.Second
@@ -66,4 +185,17 @@ func (a *App) Stop() {
 			a.logger.Printf("Could not stop http server: %v", err)
 		}
 	}
+	if a.certs != nil {
+		a.certs.close()
+	}
+	// the admin server outlives the public one so that metrics can be scraped while draining
+	if a.admin != nil {
+		if err := a.admin.Shutdown(ctx); err != nil {
+			a.logger.Printf("Could not stop admin server gracefully: %v", err)
+			a.admin.Close()
+		}
+	}
+	if a.adminCerts != nil {
+		a.adminCerts.close()
+	}
 }
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// checkTimeout bounds the duration of all readiness checks
+const checkTimeout = 2 * time.Second
+
+// Check reports an unhealthy dependency by returning an error
+type Check func(ctx context.Context) error
+
+// Readiness serves the readiness probe by running the registered checks.
+// It reports not ready once draining, regardless of the checks
+type Readiness struct {
+	mu       sync.RWMutex
+	checks   map[string]Check
+	draining int32
+}
+
+// NewReadiness returns a Readiness without any check
+func NewReadiness() *Readiness {
+	return &Readiness{checks: make(map[string]Check)}
+}
+
+// Add registers a named check
+func (r *Readiness) Add(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks[name] = check
+}
+
+// Drain makes the readiness probe fail so that load balancers stop sending traffic
+func (r *Readiness) Drain() {
+	atomic.StoreInt32(&r.draining, 1)
+}
+
+// Draining tells if Drain has been called
+func (r *Readiness) Draining() bool {
+	return atomic.LoadInt32(&r.draining) == 1
+}
+
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// ServeHTTP responds 200 when all checks pass, 503 otherwise
+func (r *Readiness) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.Draining() {
+		writeHealth(w, http.StatusServiceUnavailable, healthResponse{Status: "draining"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), checkTimeout)
+	defer cancel()
+
+	r.mu.RLock()
+	names := make([]string, 0, len(r.checks))
+	for name := range r.checks {
+		names = append(names, name)
+	}
+	r.mu.RUnlock()
+	sort.Strings(names)
+
+	resp := healthResponse{Status: "ok", Checks: make(map[string]string, len(names))}
+	status := http.StatusOK
+	for _, name := range names {
+		r.mu.RLock()
+		check := r.checks[name]
+		r.mu.RUnlock()
+
+		if err := check(ctx); err != nil {
+			resp.Checks[name] = err.Error()
+			resp.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		resp.Checks[name] = "ok"
+	}
+	writeHealth(w, status, resp)
+}
+
+// Liveness responds 200 as long as the process is able to serve HTTP
+func Liveness(w http.ResponseWriter, _ *http.Request) {
+	writeHealth(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+// writeHealth skips web.RespondJSON on purpose, probes are too frequent to log every response
+func writeHealth(w http.ResponseWriter, status int, resp healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
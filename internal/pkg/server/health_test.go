@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+func TestReadiness_ServeHTTP(t *testing.T) {
+	healthy := func(context.Context) error { return nil }
+	unhealthy := func(context.Context) error { return errors.New("connection refused") }
+
+	tests := []struct {
+		name       string
+		checks     map[string]Check
+		drain      bool
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "no checks",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"status":"ok"}` + "\n",
+		},
+		{
+			name:       "all healthy",
+			checks:     map[string]Check{"postgres": healthy, "amqp": healthy},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"status":"ok","checks":{"amqp":"ok","postgres":"ok"}}` + "\n",
+		},
+		{
+			name:       "one unhealthy",
+			checks:     map[string]Check{"postgres": unhealthy, "amqp": healthy},
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   `{"status":"unavailable","checks":{"amqp":"ok","postgres":"connection refused"}}` + "\n",
+		},
+		{
+			name:       "draining",
+			checks:     map[string]Check{"postgres": healthy},
+			drain:      true,
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   `{"status":"draining"}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReadiness()
+			for name, check := range tt.checks {
+				r.Add(name, check)
+			}
+			if tt.drain {
+				r.Drain()
+			}
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			testutil.Equals(t, tt.wantStatus, rr.Code)
+			testutil.Equals(t, tt.wantBody, rr.Body.String())
+			testutil.Equals(t, "application/json", rr.Header().Get("Content-Type"))
+		})
+	}
+}
+
+func TestLiveness(t *testing.T) {
+	rr := httptest.NewRecorder()
+	Liveness(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	testutil.Equals(t, http.StatusOK, rr.Code)
+	testutil.Equals(t, `{"status":"ok"}`+"\n", rr.Body.String())
+}
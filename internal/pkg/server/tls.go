@@ -0,0 +1,193 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// TLSConfig enables TLS on the server when the certificate and key files are set, it is read from the
+// environment with the SERVER_TLS_ prefix. Client certificates are verified against ClientCAFile when set,
+// ClientAuth is one of none, request, require, verify_if_given and verify, the latter by default with a CA
+type TLSConfig struct {
+	CertFile     string `env:"CERT_FILE,optional"`
+	KeyFile      string `env:"KEY_FILE,optional"`
+	ClientCAFile string `env:"CLIENT_CA_FILE,optional"`
+	ClientAuth   string `env:"CLIENT_AUTH,optional"`
+}
+
+// Enabled tells if TLS is configured
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"none":            tls.NoClientCert,
+	"request":         tls.RequestClientCert,
+	"require":         tls.RequireAnyClientCert,
+	"verify_if_given": tls.VerifyClientCertIfGiven,
+	"verify":          tls.RequireAndVerifyClientCert,
+}
+
+func (c TLSConfig) clientAuth() (tls.ClientAuthType, error) {
+	name := c.ClientAuth
+	if name == "" {
+		if c.ClientCAFile == "" {
+			return tls.NoClientCert, nil
+		}
+		name = "verify"
+	}
+	auth, ok := clientAuthTypes[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown client auth %q", name)
+	}
+	if auth >= tls.VerifyClientCertIfGiven && c.ClientCAFile == "" {
+		return 0, fmt.Errorf("client auth %s needs a client CA file", name)
+	}
+	return auth, nil
+}
+
+// certReloader serves the certificate and client CAs of the TLSConfig, reloading them whenever their files change
+type certReloader struct {
+	cfg        TLSConfig
+	clientAuth tls.ClientAuthType
+	logger     *log.Logger
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+
+	watcher *fsnotify.Watcher
+}
+
+func newCertReloader(cfg TLSConfig, logger *log.Logger) (*certReloader, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, fmt.Errorf("both TLS certificate and key files must be set")
+	}
+	auth, err := cfg.clientAuth()
+	if err != nil {
+		return nil, err
+	}
+	c := &certReloader{cfg: cfg, clientAuth: auth, logger: logger}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// reload loads the files, the previous certificate and CAs are kept on error
+func (c *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(c.cfg.CertFile, c.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("loading TLS certificate: %v", err)
+	}
+	var pool *x509.CertPool
+	if c.cfg.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(c.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("loading client CA: %v", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("loading client CA: no certificate found in %s", c.cfg.ClientCAFile)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = &cert
+	c.clientCAs = pool
+	return nil
+}
+
+// tlsConfig returns the server TLS config, the certificate and CAs are resolved for every handshake
+func (c *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*c.cert},
+				ClientAuth:   c.clientAuth,
+				ClientCAs:    c.clientCAs,
+				NextProtos:   []string{"h2", "http/1.1"},
+			}, nil
+		},
+	}
+}
+
+// watch reloads the files on change until close is called. The directories are watched rather than the files
+// so that atomic replacements, e.g. of Kubernetes mounted secrets, are noticed
+func (c *certReloader) watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	dirs := make(map[string]bool)
+	for _, f := range []string{c.cfg.CertFile, c.cfg.KeyFile, c.cfg.ClientCAFile} {
+		if f != "" {
+			dirs[filepath.Dir(f)] = true
+		}
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return err
+		}
+	}
+	c.watcher = watcher
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 || !c.watches(event.Name) {
+					continue
+				}
+				if err := c.reload(); err != nil {
+					c.logger.Printf("Could not reload TLS certificate: %v", err)
+					continue
+				}
+				c.logger.Printf("TLS certificate reloaded after change of %s", event.Name)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				c.logger.Printf("TLS certificate watcher: %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// watches tells if the changed path may affect the files, Kubernetes swaps the ..data symlink of the directory
+func (c *certReloader) watches(name string) bool {
+	base := filepath.Base(name)
+	if strings.HasPrefix(base, "..") {
+		return true
+	}
+	for _, f := range []string{c.cfg.CertFile, c.cfg.KeyFile, c.cfg.ClientCAFile} {
+		if f != "" && filepath.Clean(f) == filepath.Clean(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *certReloader) close() {
+	if c.watcher != nil {
+		c.watcher.Close()
+	}
+}
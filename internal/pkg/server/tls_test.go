@@ -0,0 +1,159 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+// writeCert writes a self-signed certificate and its key to dir as <name>.crt and <name>.key
+func writeCert(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	testutil.Ok(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	testutil.Ok(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	testutil.Ok(t, err)
+
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	testutil.Ok(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	testutil.Ok(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func TestTLSConfig_clientAuth(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     TLSConfig
+		want    tls.ClientAuthType
+		wantErr string
+	}{
+		{name: "no CA", cfg: TLSConfig{}, want: tls.NoClientCert},
+		{name: "CA defaults to verify", cfg: TLSConfig{ClientCAFile: "ca.crt"}, want: tls.RequireAndVerifyClientCert},
+		{name: "explicit", cfg: TLSConfig{ClientCAFile: "ca.crt", ClientAuth: "verify_if_given"}, want: tls.VerifyClientCertIfGiven},
+		{name: "request without CA", cfg: TLSConfig{ClientAuth: "request"}, want: tls.RequestClientCert},
+		{name: "verify without CA", cfg: TLSConfig{ClientAuth: "verify"}, wantErr: "client auth verify needs a client CA file"},
+		{name: "unknown", cfg: TLSConfig{ClientAuth: "maybe"}, wantErr: `unknown client auth "maybe"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.cfg.clientAuth()
+			testutil.CompareError(t, tt.wantErr, err)
+			if err == nil {
+				testutil.Equals(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNewCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "server")
+	tests := []struct {
+		name    string
+		cfg     TLSConfig
+		wantErr string
+	}{
+		{name: "missing key", cfg: TLSConfig{CertFile: certFile}, wantErr: "both TLS certificate and key files must be set"},
+		{name: "missing file", cfg: TLSConfig{CertFile: certFile, KeyFile: filepath.Join(dir, "nope.key")}, wantErr: "loading TLS certificate: open " + filepath.Join(dir, "nope.key") + ": no such file or directory"},
+		{name: "CA without certificate", cfg: TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: keyFile}, wantErr: "loading client CA: no certificate found in " + keyFile},
+		{name: "valid", cfg: TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newCertReloader(tt.cfg, log.New(ioutil.Discard, "", 0))
+			testutil.CompareError(t, tt.wantErr, err)
+		})
+	}
+}
+
+func TestCertReloader_mutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "server")
+	clientCert, clientKey := writeCert(t, dir, "client")
+	certs, err := newCertReloader(TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: clientCert}, log.New(ioutil.Discard, "", 0))
+	testutil.Ok(t, err)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = certs.tlsConfig()
+	srv.StartTLS()
+	defer srv.Close()
+
+	serverPEM, err := ioutil.ReadFile(certFile)
+	testutil.Ok(t, err)
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(serverPEM)
+	pair, err := tls.LoadX509KeyPair(clientCert, clientKey)
+	testutil.Ok(t, err)
+
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: certs,
+			ServerName:   "localhost",
+		}}}
+	}
+
+	_, err = client().Get(srv.URL)
+	testutil.Asserts(t, err != nil, "request without client certificate should fail")
+
+	resp, err := client(pair).Get(srv.URL)
+	testutil.Ok(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "client", string(body))
+}
+
+func TestCertReloader_watch(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "server")
+	certs, err := newCertReloader(TLSConfig{CertFile: certFile, KeyFile: keyFile}, log.New(ioutil.Discard, "", 0))
+	testutil.Ok(t, err)
+	testutil.Ok(t, certs.watch())
+	defer certs.close()
+
+	leaf := func() string {
+		certs.mu.RLock()
+		defer certs.mu.RUnlock()
+		cert, err := x509.ParseCertificate(certs.cert.Certificate[0])
+		testutil.Ok(t, err)
+		return cert.SerialNumber.String()
+	}
+	before := leaf()
+
+	writeCert(t, dir, "server")
+	deadline := time.Now().Add(5 * time.Second)
+	for leaf() == before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	testutil.Asserts(t, leaf() != before, "certificate should be reloaded")
+}
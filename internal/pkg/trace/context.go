@@ -0,0 +1,117 @@
+// Package trace propagates request IDs and W3C trace context (https://www.w3.org/TR/trace-context/)
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// HTTP headers carrying the correlation
+const (
+	TraceparentHeader = "traceparent"
+	RequestIDHeader   = "X-Request-ID"
+)
+
+const (
+	traceparentVersion = "00"
+	sampledFlags       = "01"
+)
+
+type contextKey string
+
+var (
+	spanContextKey = contextKey("span_context")
+	spanKey        = contextKey("span")
+	requestIDKey   = contextKey("request_id")
+)
+
+// SpanContext identifies a span within a trace, IDs are lowercase hex
+type SpanContext struct {
+	TraceID string
+	SpanID  string
+	Flags   string
+}
+
+// NewSpanContext starts a new sampled trace
+func NewSpanContext() SpanContext {
+	return SpanContext{TraceID: randomHex(16), SpanID: randomHex(8), Flags: sampledFlags}
+}
+
+// Parse reads a traceparent header value
+func Parse(traceparent string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || !isHex(parts[0]) {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", traceparent)
+	}
+	// future versions may append fields, version 00 must have exactly 4
+	if parts[0] == traceparentVersion && len(parts) != 4 {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", traceparent)
+	}
+
+	sc := SpanContext{TraceID: parts[1], SpanID: parts[2], Flags: parts[3]}
+	if len(sc.TraceID) != 32 || len(sc.SpanID) != 16 || len(sc.Flags) != 2 ||
+		!isHex(sc.TraceID) || !isHex(sc.SpanID) || !isHex(sc.Flags) || !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", traceparent)
+	}
+	return sc, nil
+}
+
+// IsValid tells if both IDs are set and not all zeros
+func (sc SpanContext) IsValid() bool {
+	return strings.Trim(sc.TraceID, "0") != "" && strings.Trim(sc.SpanID, "0") != ""
+}
+
+// Child returns a new span within the same trace
+func (sc SpanContext) Child() SpanContext {
+	return SpanContext{TraceID: sc.TraceID, SpanID: randomHex(8), Flags: sc.Flags}
+}
+
+// String returns the traceparent header value, or an empty string when invalid
+func (sc SpanContext) String() string {
+	if !sc.IsValid() {
+		return ""
+	}
+	return strings.Join([]string{traceparentVersion, sc.TraceID, sc.SpanID, sc.Flags}, "-")
+}
+
+// NewContext returns a copy of ctx carrying the span context
+func NewContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey, sc)
+}
+
+// FromContext returns the span context carried by ctx
+func FromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey).(SpanContext)
+	return sc, ok
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestID returns the request ID carried by ctx, or an empty string
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
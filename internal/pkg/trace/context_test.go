@@ -0,0 +1,70 @@
+package trace
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		given   string
+		want    SpanContext
+		wantErr string
+	}{
+		{
+			name:  "valid",
+			given: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			want:  SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Flags: "01"},
+		},
+		{
+			name:  "future version with extra field",
+			given: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra",
+			want:  SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Flags: "00"},
+		},
+		{name: "empty", given: "", wantErr: "invalid traceparent"},
+		{name: "version 00 with extra field", given: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", wantErr: "invalid traceparent"},
+		{name: "forbidden version", given: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantErr: "invalid traceparent"},
+		{name: "uppercase", given: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", wantErr: "invalid traceparent"},
+		{name: "short span", given: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa-01", wantErr: "invalid traceparent"},
+		{name: "zero trace", given: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", wantErr: "invalid traceparent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.given)
+			testutil.CompareError(t, tt.wantErr, err)
+			testutil.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func TestSpanContext(t *testing.T) {
+	sc := NewSpanContext()
+	testutil.Asserts(t, sc.IsValid(), "new span context should be valid")
+
+	parsed, err := Parse(sc.String())
+	testutil.Ok(t, err)
+	testutil.Equals(t, sc, parsed)
+
+	child := sc.Child()
+	testutil.Equals(t, sc.TraceID, child.TraceID)
+	testutil.Asserts(t, sc.SpanID != child.SpanID, "child should have a new span ID")
+
+	testutil.Equals(t, "", SpanContext{}.String())
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	_, ok := FromContext(ctx)
+	testutil.Asserts(t, !ok, "should not have span context when not set")
+	testutil.Equals(t, "", RequestID(ctx))
+
+	sc := NewSpanContext()
+	ctx = WithRequestID(NewContext(ctx, sc), "request0")
+	got, ok := FromContext(ctx)
+	testutil.Asserts(t, ok, "should have span context")
+	testutil.Equals(t, sc, got)
+	testutil.Equals(t, "request0", RequestID(ctx))
+}
@@ -0,0 +1,258 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exporter kinds accepted by NewExporter
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+const defaultOTLPEndpoint = "http://localhost:4318"
+
+// Config selects the exporter, it is read from the environment with the TRACE_ prefix.
+// Spans are not exported when Exporter is empty
+type Config struct {
+	Exporter     string `env:"EXPORTER,optional"`
+	OTLPEndpoint string `env:"OTLP_ENDPOINT,optional"`
+	File         string `env:"FILE,optional"`
+}
+
+// NewExporter returns the exporter of the kind: otlp sends to the OTLP/HTTP endpoint, stdout and file write JSON lines
+func NewExporter(kind, serviceName, endpoint, file string) (Exporter, error) {
+	switch kind {
+	case ExporterOTLP:
+		if endpoint == "" {
+			endpoint = defaultOTLPEndpoint
+		}
+		return &OTLPExporter{Endpoint: endpoint, ServiceName: serviceName, Client: &http.Client{Timeout: 10 * time.Second}}, nil
+	case ExporterStdout:
+		return &WriterExporter{W: os.Stdout}, nil
+	case ExporterFile:
+		f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return &WriterExporter{W: f}, nil
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", kind)
+	}
+}
+
+// WriterExporter writes one JSON object per span, for local debugging without a tracing backend
+type WriterExporter struct {
+	W  io.Writer
+	mu sync.Mutex
+}
+
+type spanLine struct {
+	TraceID      string                 `json:"trace_id"`
+	SpanID       string                 `json:"span_id"`
+	ParentSpanID string                 `json:"parent_span_id,omitempty"`
+	Name         string                 `json:"name"`
+	Kind         SpanKind               `json:"kind"`
+	Start        time.Time              `json:"start"`
+	DurationMS   float64                `json:"duration_ms"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+	Error        string                 `json:"error,omitempty"`
+}
+
+// Export implements Exporter
+func (e *WriterExporter) Export(_ context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	enc := json.NewEncoder(e.W)
+	for _, s := range spans {
+		if err := enc.Encode(spanLine{
+			TraceID:      s.SpanContext.TraceID,
+			SpanID:       s.SpanContext.SpanID,
+			ParentSpanID: s.ParentSpanID,
+			Name:         s.Name,
+			Kind:         s.Kind,
+			Start:        s.StartTime,
+			DurationMS:   float64(s.EndTime.Sub(s.StartTime)) / float64(time.Millisecond),
+			Attributes:   s.Attributes,
+			Error:        s.Error,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Shutdown implements Exporter, closing the writer unless it is stdout or stderr
+func (e *WriterExporter) Shutdown(context.Context) error {
+	if e.W == os.Stdout || e.W == os.Stderr {
+		return nil
+	}
+	if c, ok := e.W.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// OTLPExporter sends spans to an OpenTelemetry collector using OTLP/HTTP with JSON encoding
+type OTLPExporter struct {
+	// Endpoint is the collector base URL, spans are posted to Endpoint/v1/traces
+	Endpoint    string
+	ServiceName string
+	Client      *http.Client
+}
+
+// Export implements Exporter
+func (e *OTLPExporter) Export(ctx context.Context, spans []SpanData) error {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(e.Endpoint, "/")+"/v1/traces", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("otlp export error: %v, response: %v", resp.StatusCode, string(data))
+	}
+	return nil
+}
+
+// Shutdown implements Exporter
+func (e *OTLPExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// OTLP status codes
+const (
+	otlpStatusOK    = 1
+	otlpStatusError = 2
+)
+
+const instrumentationScope = "github.com/kagelui/notification"
+
+func (e *OTLPExporter) request(spans []SpanData) otlpRequest {
+	converted := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           s.SpanContext.TraceID,
+			SpanID:            s.SpanContext.SpanID,
+			ParentSpanID:      s.ParentSpanID,
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.EndTime.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attributes),
+			Status:            otlpStatus{Code: otlpStatusOK},
+		}
+		if s.Error != "" {
+			span.Status = otlpStatus{Code: otlpStatusError, Message: s.Error}
+		}
+		converted = append(converted, span)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: otlpAttributes(map[string]interface{}{"service.name": e.ServiceName})},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: instrumentationScope},
+			Spans: converted,
+		}},
+	}}}
+}
+
+// otlpAttributes converts the attributes sorted by key, unsupported values are sent as strings
+func otlpAttributes(attributes map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		var value map[string]interface{}
+		switch v := attributes[k].(type) {
+		case string:
+			value = map[string]interface{}{"stringValue": v}
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		result = append(result, otlpKeyValue{Key: k, Value: value})
+	}
+	return result
+}
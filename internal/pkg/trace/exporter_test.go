@@ -0,0 +1,90 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+var testSpan = SpanData{
+	Name:         "callback.http",
+	Kind:         SpanKindClient,
+	SpanContext:  SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Flags: "01"},
+	ParentSpanID: "53995c3f42cd8ad8",
+	StartTime:    time.Unix(1620000000, 0),
+	EndTime:      time.Unix(1620000000, int64(1500*time.Microsecond)),
+	Attributes:   map[string]interface{}{"http.status_code": 500, "business_id": "user00"},
+	Error:        "callback error: 500",
+}
+
+func TestWriterExporter_Export(t *testing.T) {
+	var buf bytes.Buffer
+	e := &WriterExporter{W: &buf}
+	testutil.Ok(t, e.Export(context.TODO(), []SpanData{testSpan}))
+	testutil.Ok(t, e.Shutdown(context.TODO()))
+
+	var got map[string]interface{}
+	testutil.Ok(t, json.Unmarshal(buf.Bytes(), &got))
+	testutil.Equals(t, "4bf92f3577b34da6a3ce929d0e0e4736", got["trace_id"])
+	testutil.Equals(t, "53995c3f42cd8ad8", got["parent_span_id"])
+	testutil.Equals(t, "callback.http", got["name"])
+	testutil.Equals(t, 1.5, got["duration_ms"])
+	testutil.Equals(t, "callback error: 500", got["error"])
+}
+
+func TestOTLPExporter_Export(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		wantErr    string
+	}{
+		{name: "success", statusCode: http.StatusOK, wantErr: ""},
+		{name: "fail", statusCode: http.StatusBadRequest, wantErr: "otlp export error: 400, response: bad payload"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &OTLPExporter{
+				Endpoint:    "http://collector:4318/",
+				ServiceName: "serverd",
+				Client: testutil.NewTestClient(func(req *http.Request) *http.Response {
+					testutil.Equals(t, "http://collector:4318/v1/traces", req.URL.String())
+					testutil.Equals(t, "application/json", req.Header.Get("Content-Type"))
+
+					var got otlpRequest
+					testutil.Ok(t, json.NewDecoder(req.Body).Decode(&got))
+					resource := got.ResourceSpans[0]
+					testutil.Equals(t, "service.name", resource.Resource.Attributes[0].Key)
+					span := resource.ScopeSpans[0].Spans[0]
+					testutil.Equals(t, "1620000000000000000", span.StartTimeUnixNano)
+					testutil.Equals(t, "1620000000001500000", span.EndTimeUnixNano)
+					testutil.Equals(t, otlpStatus{Code: otlpStatusError, Message: "callback error: 500"}, span.Status)
+					testutil.Equals(t, []otlpKeyValue{
+						{Key: "business_id", Value: map[string]interface{}{"stringValue": "user00"}},
+						{Key: "http.status_code", Value: map[string]interface{}{"intValue": "500"}},
+					}, span.Attributes)
+
+					return &http.Response{
+						StatusCode: tt.statusCode,
+						Body:       ioutil.NopCloser(bytes.NewBufferString("bad payload")),
+					}
+				}),
+			}
+			testutil.CompareError(t, tt.wantErr, e.Export(context.TODO(), []SpanData{testSpan}))
+		})
+	}
+}
+
+func TestNewExporter(t *testing.T) {
+	_, err := NewExporter("zipkin", "serverd", "", "")
+	testutil.CompareError(t, `unknown trace exporter "zipkin"`, err)
+
+	e, err := NewExporter(ExporterOTLP, "serverd", "", "")
+	testutil.Ok(t, err)
+	testutil.Equals(t, defaultOTLPEndpoint, e.(*OTLPExporter).Endpoint)
+}
@@ -0,0 +1,211 @@
+package trace
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kagelui/notification/internal/pkg/loglib"
+)
+
+// batching of the ended spans
+const (
+	queueSize      = 2048
+	batchSize      = 128
+	exportInterval = 5 * time.Second
+)
+
+// SpanKind follows the OpenTelemetry span kinds
+type SpanKind int
+
+// SpanKind constants
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// SpanData is an ended span handed over to the exporter
+type SpanData struct {
+	Name         string
+	Kind         SpanKind
+	SpanContext  SpanContext
+	ParentSpanID string
+	StartTime    time.Time
+	EndTime      time.Time
+	Attributes   map[string]interface{}
+	// Error is the error recorded by the span, empty when the operation succeeded
+	Error string
+}
+
+// Span is a timed operation within a trace
+type Span struct {
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// StartSpan starts a span as a child of the span context carried by ctx, or as the root of a new trace.
+// The returned context carries the new span context, End must be called once the operation is done
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	sc := NewSpanContext()
+	var parentID string
+	if parent, ok := FromContext(ctx); ok && parent.IsValid() {
+		sc, parentID = parent.Child(), parent.SpanID
+	}
+
+	span := &Span{data: SpanData{
+		Name:         name,
+		Kind:         SpanKindInternal,
+		SpanContext:  sc,
+		ParentSpanID: parentID,
+		StartTime:    time.Now(),
+		Attributes:   make(map[string]interface{}),
+	}}
+	return context.WithValue(NewContext(ctx, sc), spanKey, span), span
+}
+
+// SpanFromContext returns the span started by StartSpan which ctx carries, so that handlers annotate the span of
+// their middleware. A span which is never exported is returned when ctx carries none
+func SpanFromContext(ctx context.Context) *Span {
+	if span, ok := ctx.Value(spanKey).(*Span); ok {
+		return span
+	}
+	return &Span{data: SpanData{Attributes: make(map[string]interface{})}, ended: true}
+}
+
+// SpanContext returns the identifiers of the span
+func (s *Span) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+// SetKind sets the span kind, spans are internal by default
+func (s *Span) SetKind(kind SpanKind) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Kind = kind
+}
+
+// SetAttribute sets a string, bool, integer or float attribute
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attributes[key] = value
+}
+
+// RecordError marks the span as failed, nil errors are ignored
+func (s *Span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Error = err.Error()
+}
+
+// End ends the span and queues it for export, later calls are ignored
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.EndTime = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	global.enqueue(data)
+}
+
+// Exporter sends batches of ended spans to a tracing backend
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+	Shutdown(ctx context.Context) error
+}
+
+// processor batches the ended spans, spans are dropped when no exporter is set or the queue is full
+type processor struct {
+	mu       sync.RWMutex
+	exporter Exporter
+	queue    chan SpanData
+	done     chan struct{}
+}
+
+var global = &processor{}
+
+// SetExporter starts exporting the ended spans with the exporter, replacing the previous one
+func SetExporter(e Exporter) {
+	Shutdown(context.Background())
+
+	global.mu.Lock()
+	defer global.mu.Unlock()
+	global.exporter = e
+	global.queue = make(chan SpanData, queueSize)
+	global.done = make(chan struct{})
+	go global.run(e, global.queue, global.done)
+}
+
+// Shutdown exports the queued spans then shuts the exporter down
+func Shutdown(ctx context.Context) error {
+	global.mu.Lock()
+	e, queue, done := global.exporter, global.queue, global.done
+	global.exporter, global.queue, global.done = nil, nil, nil
+	global.mu.Unlock()
+
+	if e == nil {
+		return nil
+	}
+	close(queue)
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return e.Shutdown(ctx)
+}
+
+func (p *processor) enqueue(data SpanData) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.exporter == nil {
+		return
+	}
+	select {
+	case p.queue <- data:
+	default:
+	}
+}
+
+func (p *processor) run(e Exporter, queue <-chan SpanData, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	var batch []SpanData
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.Export(context.Background(), batch); err != nil {
+			loglib.DefaultLogger().ErrorF("error exporting %d spans: %v", len(batch), err.Error())
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case data, ok := <-queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, data)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+type memoryExporter struct {
+	mu       sync.Mutex
+	spans    []SpanData
+	shutdown bool
+}
+
+func (e *memoryExporter) Export(_ context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *memoryExporter) Shutdown(context.Context) error {
+	e.shutdown = true
+	return nil
+}
+
+func TestStartSpan(t *testing.T) {
+	exporter := &memoryExporter{}
+	SetExporter(exporter)
+
+	ctx, root := StartSpan(context.Background(), "ingest")
+	root.SetKind(SpanKindServer)
+	root.SetAttribute("product_id", "va")
+
+	sc, ok := FromContext(ctx)
+	testutil.Asserts(t, ok, "context should carry the span context")
+	testutil.Equals(t, root.SpanContext(), sc)
+
+	_, child := StartSpan(ctx, "message.insert")
+	child.RecordError(nil)
+	child.RecordError(errors.New("duplicate key"))
+	child.End()
+	child.End()
+	root.End()
+
+	testutil.Ok(t, Shutdown(context.Background()))
+	testutil.Asserts(t, exporter.shutdown, "exporter should be shut down")
+
+	// spans ended without exporter are dropped
+	_, dropped := StartSpan(context.Background(), "dropped")
+	dropped.End()
+
+	testutil.Equals(t, 2, len(exporter.spans))
+	gotChild, gotRoot := exporter.spans[0], exporter.spans[1]
+
+	testutil.Equals(t, "ingest", gotRoot.Name)
+	testutil.Equals(t, SpanKindServer, gotRoot.Kind)
+	testutil.Equals(t, "", gotRoot.ParentSpanID)
+	testutil.Equals(t, map[string]interface{}{"product_id": "va"}, gotRoot.Attributes)
+	testutil.Asserts(t, !gotRoot.EndTime.Before(gotRoot.StartTime), "span should end after it starts")
+
+	testutil.Equals(t, "message.insert", gotChild.Name)
+	testutil.Equals(t, SpanKindInternal, gotChild.Kind)
+	testutil.Equals(t, gotRoot.SpanContext.TraceID, gotChild.SpanContext.TraceID)
+	testutil.Equals(t, gotRoot.SpanContext.SpanID, gotChild.ParentSpanID)
+	testutil.Equals(t, "duplicate key", gotChild.Error)
+}
+
+func TestStartSpan_remoteParent(t *testing.T) {
+	remote, err := Parse("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	testutil.Ok(t, err)
+
+	_, span := StartSpan(NewContext(context.Background(), remote), "ingest")
+	testutil.Equals(t, remote.TraceID, span.SpanContext().TraceID)
+	testutil.Equals(t, remote.SpanID, span.data.ParentSpanID)
+}
+
+func TestSpanFromContext(t *testing.T) {
+	ctx, span := StartSpan(context.Background(), "HTTP POST /callback")
+	testutil.Asserts(t, SpanFromContext(ctx) == span, "context should carry the span")
+
+	// the child context carries the child span
+	childCtx, child := StartSpan(ctx, "message.insert")
+	testutil.Asserts(t, SpanFromContext(childCtx) == child, "child context should carry the child span")
+
+	detached := SpanFromContext(context.Background())
+	detached.SetAttribute("product_id", "va")
+	detached.End()
+	testutil.Asserts(t, !detached.SpanContext().IsValid(), "detached span should not be part of a trace")
+}
@@ -0,0 +1,103 @@
+package validate
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kagelui/notification/internal/pkg/web"
+)
+
+const tagName = "validate"
+
+// Error codes of the field errors returned by Struct
+const (
+	CodeRequired  = "required"
+	CodeMaxLength = "max_length"
+	CodeMaxBytes  = "max_bytes"
+)
+
+// Struct checks the string fields of the struct against the rules of their `validate` tag, e.g.
+// `validate:"required,max=64"`, and returns the invalid fields named after their json tag.
+//
+// Rules are required, max=N (characters) and maxbytes=N
+func Struct(target interface{}) ([]web.FieldError, error) {
+	v := reflect.ValueOf(target)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("invalid type %v passed", reflect.TypeOf(target))
+	}
+
+	var fieldErrors []web.FieldError
+	refType := v.Type()
+	for i := 0; i < refType.NumField(); i++ {
+		refTypeField := refType.Field(i)
+		tag, ok := refTypeField.Tag.Lookup(tagName)
+		if !ok {
+			continue
+		}
+		if refTypeField.Type.Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported type %s for field %s", refTypeField.Type.String(), refTypeField.Name)
+		}
+
+		name := jsonName(refTypeField)
+		value := v.Field(i).String()
+		for _, rule := range strings.Split(tag, ",") {
+			fieldError, err := check(name, value, rule)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %v", refTypeField.Name, err)
+			}
+			if fieldError != nil {
+				fieldErrors = append(fieldErrors, *fieldError)
+				// later rules are meaningless for a missing value
+				break
+			}
+		}
+	}
+	return fieldErrors, nil
+}
+
+func check(name, value, rule string) (*web.FieldError, error) {
+	ruleName, arg := rule, ""
+	if i := strings.Index(rule, "="); i >= 0 {
+		ruleName, arg = rule[:i], rule[i+1:]
+	}
+
+	switch ruleName {
+	case "required":
+		if strings.TrimSpace(value) == "" {
+			return &web.FieldError{Field: name, Code: CodeRequired, Message: name + " is required"}, nil
+		}
+	case "max":
+		max, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %s: %v", rule, err)
+		}
+		if utf8.RuneCountInString(value) > max {
+			return &web.FieldError{Field: name, Code: CodeMaxLength, Message: fmt.Sprintf("%s must be at most %d characters", name, max)}, nil
+		}
+	case "maxbytes":
+		max, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %s: %v", rule, err)
+		}
+		if len(value) > max {
+			return &web.FieldError{Field: name, Code: CodeMaxBytes, Message: fmt.Sprintf("%s must be at most %d bytes", name, max)}, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown rule %s", rule)
+	}
+	return nil, nil
+}
+
+// jsonName returns the name of the field in the request body
+func jsonName(f reflect.StructField) string {
+	if name := strings.Split(f.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return f.Name
+}
@@ -0,0 +1,79 @@
+package validate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kagelui/notification/internal/pkg/web"
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+func TestStruct(t *testing.T) {
+	type request struct {
+		ID      string `json:"id" validate:"required,max=4"`
+		Name    string `validate:"max=3"`
+		Payload string `json:"payload,omitempty" validate:"maxbytes=4"`
+		Ignored string `json:"ignored"`
+	}
+	tests := []struct {
+		name    string
+		target  interface{}
+		want    []web.FieldError
+		wantErr string
+	}{
+		{
+			name:    "not a struct",
+			target:  "something",
+			wantErr: "invalid type string passed",
+		},
+		{
+			name: "unsupported type",
+			target: struct {
+				Count int `validate:"required"`
+			}{},
+			wantErr: "unsupported type int for field Count",
+		},
+		{
+			name: "unknown rule",
+			target: struct {
+				ID string `validate:"uuid"`
+			}{},
+			wantErr: "field ID: unknown rule uuid",
+		},
+		{
+			name: "invalid rule",
+			target: struct {
+				ID string `validate:"max=ten"`
+			}{ID: "a"},
+			wantErr: `field ID: invalid rule max=ten: strconv.Atoi: parsing "ten": invalid syntax`,
+		},
+		{
+			name:   "valid",
+			target: &request{ID: "abcd", Name: "äöü", Payload: "{}", Ignored: strings.Repeat("a", 100)},
+			want:   nil,
+		},
+		{
+			name:   "blank required",
+			target: request{ID: "  "},
+			want:   []web.FieldError{{Field: "id", Code: CodeRequired, Message: "id is required"}},
+		},
+		{
+			name:   "too long",
+			target: request{ID: "abcde", Name: "abcd", Payload: "äöü"},
+			want: []web.FieldError{
+				{Field: "id", Code: CodeMaxLength, Message: "id must be at most 4 characters"},
+				{Field: "Name", Code: CodeMaxLength, Message: "Name must be at most 3 characters"},
+				{Field: "payload", Code: CodeMaxBytes, Message: "payload must be at most 4 bytes"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Struct(tt.target)
+			testutil.CompareError(t, tt.wantErr, err)
+			if err == nil {
+				testutil.Equals(t, tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+// Package wakeup wakes a worker when the earliest of the scheduled times is reached, falling back to polling
+package wakeup
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// maxScheduled bounds the scheduled times kept in memory, the later times are left to the polling
+const maxScheduled = 10000
+
+// Scheduler keeps the scheduled times in a min-heap, Wait returns when the earliest one is reached
+type Scheduler struct {
+	poll    time.Duration
+	mu      sync.Mutex
+	times   timeHeap
+	changed chan struct{}
+}
+
+// NewScheduler returns a Scheduler whose Wait returns after the poll interval at the latest
+func NewScheduler(poll time.Duration) *Scheduler {
+	return &Scheduler{poll: poll, changed: make(chan struct{}, 1)}
+}
+
+// Schedule wakes the worker at the time, or as soon as possible for past times
+func (s *Scheduler) Schedule(t time.Time) {
+	s.mu.Lock()
+	if len(s.times) < maxScheduled {
+		heap.Push(&s.times, t)
+	} else if t.Before(s.times[0]) {
+		// an earlier root keeps the heap ordered
+		s.times[0] = t
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Len returns the number of scheduled times
+func (s *Scheduler) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.times)
+}
+
+// Wait blocks until a scheduled time is reached or the poll interval elapses, the times reached are discarded as
+// the worker catches up with all of them at once. It returns the error of the context when it is done
+func (s *Scheduler) Wait(ctx context.Context) error {
+	poll := time.NewTimer(s.poll)
+	defer poll.Stop()
+	for {
+		next, reached := s.pop(time.Now())
+		if reached {
+			return nil
+		}
+
+		var timer *time.Timer
+		var due <-chan time.Time
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			due = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			stop(timer)
+			return ctx.Err()
+		case <-poll.C:
+			stop(timer)
+			return nil
+		case <-s.changed:
+			stop(timer)
+		case <-due:
+		}
+	}
+}
+
+// pop discards the times reached at now and returns the earliest time left, which is zero if there is none
+func (s *Scheduler) pop(now time.Time) (next time.Time, reached bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.times) > 0 && !s.times[0].After(now) {
+		heap.Pop(&s.times)
+		reached = true
+	}
+	if len(s.times) > 0 {
+		next = s.times[0]
+	}
+	return next, reached
+}
+
+func stop(timer *time.Timer) {
+	if timer != nil {
+		timer.Stop()
+	}
+}
+
+// timeHeap implements heap.Interface, the earliest time first
+type timeHeap []time.Time
+
+func (h timeHeap) Len() int            { return len(h) }
+func (h timeHeap) Less(i, j int) bool  { return h[i].Before(h[j]) }
+func (h timeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *timeHeap) Push(x interface{}) { *h = append(*h, x.(time.Time)) }
+func (h *timeHeap) Pop() interface{} {
+	old := *h
+	t := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return t
+}
@@ -0,0 +1,85 @@
+package wakeup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+func TestScheduler_Wait(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule []time.Duration
+		poll     time.Duration
+		min, max time.Duration
+		wantLeft int
+	}{
+		{name: "nothing scheduled", poll: 50 * time.Millisecond, min: 50 * time.Millisecond, max: time.Second},
+		{name: "past time", schedule: []time.Duration{-time.Minute}, poll: time.Minute, max: 50 * time.Millisecond},
+		{
+			name:     "earliest time",
+			schedule: []time.Duration{time.Hour, 50 * time.Millisecond, time.Minute},
+			poll:     time.Minute,
+			min:      50 * time.Millisecond,
+			max:      time.Second,
+			wantLeft: 2,
+		},
+		{
+			name:     "times reached together",
+			schedule: []time.Duration{-time.Second, -time.Minute, time.Hour},
+			poll:     time.Minute,
+			max:      50 * time.Millisecond,
+			wantLeft: 1,
+		},
+		{name: "poll first", schedule: []time.Duration{time.Hour}, poll: 50 * time.Millisecond, min: 50 * time.Millisecond, max: time.Second, wantLeft: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewScheduler(tt.poll)
+			now := time.Now()
+			for _, d := range tt.schedule {
+				s.Schedule(now.Add(d))
+			}
+			start := time.Now()
+			testutil.Ok(t, s.Wait(context.Background()))
+			waited := time.Since(start)
+			testutil.Asserts(t, waited >= tt.min && waited < tt.max, "waited %v, expected between %v and %v", waited, tt.min, tt.max)
+			testutil.Equals(t, tt.wantLeft, s.Len())
+		})
+	}
+}
+
+func TestScheduler_Schedule(t *testing.T) {
+	s := NewScheduler(time.Minute)
+	done := make(chan error)
+	go func() {
+		done <- s.Wait(context.Background())
+	}()
+	// an earlier time scheduled while waiting wakes the worker
+	time.Sleep(10 * time.Millisecond)
+	s.Schedule(time.Now().Add(20 * time.Millisecond))
+	select {
+	case err := <-done:
+		testutil.Ok(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("scheduled time not reached")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	testutil.Asserts(t, s.Wait(ctx) == context.Canceled, "wait should stop with the context")
+
+	// the latest times are dropped once full
+	now := time.Now().Add(time.Hour)
+	for i := 0; i < maxScheduled; i++ {
+		s.Schedule(now.Add(time.Duration(i) * time.Second))
+	}
+	s.Schedule(now.Add(time.Hour * 24))
+	s.Schedule(now.Add(-time.Second))
+	testutil.Equals(t, maxScheduled, s.Len())
+	next, reached := s.pop(time.Now())
+	testutil.Asserts(t, !reached, "no time should be reached")
+	testutil.Equals(t, now.Add(-time.Second), next)
+}
@@ -0,0 +1,99 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/kagelui/notification/internal/pkg/loglib"
+	"github.com/kagelui/notification/internal/pkg/trace"
+)
+
+// maxRequestIDLength bounds the client provided request ID, longer ones are replaced
+const maxRequestIDLength = 128
+
+// Correlate is a middleware propagating the request ID and W3C trace context of the request, or assigning new ones.
+// The request is traced by a server span, which is carried by the request context along with a logger
+// logging the correlation. The request ID is echoed in the response
+func Correlate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(trace.RequestIDHeader)
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			requestID = uuid.New().String()
+		}
+
+		ctx := trace.WithRequestID(r.Context(), requestID)
+		if parent, err := trace.Parse(r.Header.Get(trace.TraceparentHeader)); err == nil {
+			ctx = trace.NewContext(ctx, parent)
+		}
+		ctx, span := trace.StartSpan(ctx, "HTTP "+r.Method+" "+r.URL.Path)
+		span.SetKind(trace.SpanKindServer)
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.target", r.URL.Path)
+		defer span.End()
+
+		logger := loglib.GetLogger(ctx).WithFields(map[string]interface{}{
+			"request_id": requestID,
+			"trace_id":   span.SpanContext().TraceID,
+		})
+		ctx = loglib.SetLogger(ctx, logger)
+
+		w.Header().Set(trace.RequestIDHeader, requestID)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec.wrap(), r.WithContext(ctx))
+		span.SetAttribute("http.status_code", rec.status)
+	})
+}
+
+// statusRecorder keeps the status code and the number of bytes written to the response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+	// written tells if the response has started
+	written bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status, r.written = status, true
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.written = true
+	n, err := r.ResponseWriter.Write(b)
+	r.size += n
+	return n, err
+}
+
+// Flush implements http.Flusher when the wrapped writer does
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// wrap returns the recorder along with the optional interfaces of the wrapped writer, handlers asserting
+// http.Hijacker or http.Pusher find them only when the wrapped writer implements them
+func (r *statusRecorder) wrap() http.ResponseWriter {
+	hijacker, isHijacker := r.ResponseWriter.(http.Hijacker)
+	pusher, isPusher := r.ResponseWriter.(http.Pusher)
+	switch {
+	case isHijacker && isPusher:
+		return struct {
+			*statusRecorder
+			http.Hijacker
+			http.Pusher
+		}{r, hijacker, pusher}
+	case isHijacker:
+		return struct {
+			*statusRecorder
+			http.Hijacker
+		}{r, hijacker}
+	case isPusher:
+		return struct {
+			*statusRecorder
+			http.Pusher
+		}{r, pusher}
+	}
+	return r
+}
@@ -0,0 +1,114 @@
+package web
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kagelui/notification/internal/pkg/loglib"
+	"github.com/kagelui/notification/internal/pkg/trace"
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+func TestCorrelate(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	tests := []struct {
+		name          string
+		headers       map[string]string
+		wantRequestID string
+		wantTraceID   string
+	}{
+		{
+			name:          "propagated",
+			headers:       map[string]string{trace.RequestIDHeader: "request0", trace.TraceparentHeader: traceparent},
+			wantRequestID: "request0",
+			wantTraceID:   "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{
+			name:    "assigned",
+			headers: map[string]string{trace.TraceparentHeader: "garbage"},
+		},
+		{
+			name:    "request ID too long",
+			headers: map[string]string{trace.RequestIDHeader: strings.Repeat("a", maxRequestIDLength+1)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotRequestID string
+			var gotSpan trace.SpanContext
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotRequestID = trace.RequestID(r.Context())
+				var ok bool
+				gotSpan, ok = trace.FromContext(r.Context())
+				testutil.Asserts(t, ok, "should have span context")
+
+				logger, ok := loglib.HasLogger(r.Context())
+				testutil.Asserts(t, ok, "should have logger")
+				testutil.Equals(t, gotRequestID, logger.LogEntry.Data["request_id"])
+				testutil.Equals(t, gotSpan.TraceID, logger.LogEntry.Data["trace_id"])
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/callback", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			Correlate(next).ServeHTTP(rr, req)
+
+			testutil.Asserts(t, gotRequestID != "" && len(gotRequestID) <= maxRequestIDLength, "request ID should be set")
+			testutil.Asserts(t, gotSpan.IsValid(), "span context should be valid")
+			testutil.Equals(t, gotRequestID, rr.Header().Get(trace.RequestIDHeader))
+			if tt.wantRequestID != "" {
+				testutil.Equals(t, tt.wantRequestID, gotRequestID)
+			}
+			if tt.wantTraceID != "" {
+				testutil.Equals(t, tt.wantTraceID, gotSpan.TraceID)
+				testutil.Asserts(t, gotSpan.SpanID != "00f067aa0ba902b7", "server span should be a child")
+			}
+		})
+	}
+}
+
+type hijackWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, nil
+}
+
+func TestStatusRecorder_wrap(t *testing.T) {
+	tests := []struct {
+		name         string
+		w            *httptest.ResponseRecorder
+		wantHijacker bool
+	}{
+		{name: "recorder", w: httptest.NewRecorder(), wantHijacker: false},
+		{name: "hijacker", w: httptest.NewRecorder(), wantHijacker: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rw http.ResponseWriter = tt.w
+			if tt.wantHijacker {
+				rw = hijackWriter{tt.w}
+			}
+			rec := &statusRecorder{ResponseWriter: rw, status: http.StatusOK}
+			w := rec.wrap()
+			_, isHijacker := w.(http.Hijacker)
+			testutil.Equals(t, tt.wantHijacker, isHijacker)
+			_, isPusher := w.(http.Pusher)
+			testutil.Equals(t, false, isPusher)
+
+			flusher, ok := w.(http.Flusher)
+			testutil.Asserts(t, ok, "wrapped writer should flush")
+			w.WriteHeader(http.StatusAccepted)
+			flusher.Flush()
+			testutil.Equals(t, http.StatusAccepted, rec.status)
+			testutil.Asserts(t, tt.w.Flushed, "flush should reach the wrapped writer")
+		})
+	}
+}
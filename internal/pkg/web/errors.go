@@ -6,19 +6,56 @@ import (
 	"github.com/pkg/errors"
 )
 
+// Stable error codes shared by the services, service specific codes are declared next to their errors
+const (
+	CodeInternal         = "internal_error"
+	CodeBadRequest       = "bad_request"
+	CodeValidationFailed = "validation_failed"
+	CodeNotFound         = "not_found"
+	CodeUnavailable      = "service_unavailable"
+)
+
 // Error represents a handler error. It contains web-related information such as
 // HTTP status code, error code, description, and embeds the built-in error interface.
+// Title, Fields and ProblemCode are only rendered in problem details, see Problem
 type Error struct {
-	Status int    `json:"-"`
-	Code   string `json:"error"`
-	Desc   string `json:"error_description"`
-	Err    error  `json:"-"`
+	Status int          `json:"-"`
+	Code   string       `json:"error"`
+	Desc   string       `json:"error_description"`
+	Title  string       `json:"-"`
+	Fields []FieldError `json:"-"`
+	// ProblemCode is the catalogue code of errors whose legacy Code predates the catalogue, Code is used when empty
+	ProblemCode string `json:"-"`
+	Err         error  `json:"-"`
 }
 
 func (e Error) Error() string {
 	return e.Desc
 }
 
+// Unwrap returns the underlying error
+func (e Error) Unwrap() error {
+	return e.Err
+}
+
+// FieldError describes why a request field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewValidationError returns the error of a request with invalid fields
+func NewValidationError(fields []FieldError) *Error {
+	return &Error{
+		Status: http.StatusUnprocessableEntity,
+		Code:   CodeValidationFailed,
+		Desc:   "request validation failed",
+		Title:  "Validation failed",
+		Fields: fields,
+	}
+}
+
 // TypecastError performs a type assertion on the provide `error` and returns the object if concrete type is `Error`
 func TypecastError(err error) *Error {
 	if err == nil {
@@ -35,7 +72,7 @@ func TypecastError(err error) *Error {
 func WithStack(err error) *Error {
 	webErr := TypecastError(err)
 	if webErr == nil {
-		webErr = &Error{Status: http.StatusInternalServerError, Code: "internal_error", Desc: err.Error()}
+		webErr = &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Desc: err.Error()}
 	}
 	if webErr.Err == nil {
 		webErr.Err = errors.WithStack(errors.New(webErr.Error()))
@@ -49,12 +86,13 @@ func NewError(err error, message string) *Error {
 	webErr := TypecastError(err)
 	if webErr != nil {
 		result = &Error{
-			Status: webErr.Status,
-			Code:   webErr.Code,
-			Desc:   message,
+			Status:      webErr.Status,
+			Code:        webErr.Code,
+			Desc:        message,
+			ProblemCode: webErr.ProblemCode,
 		}
 	} else {
-		result = &Error{Status: http.StatusInternalServerError, Code: "internal_error", Desc: message}
+		result = &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Desc: message}
 	}
 	result.Err = errors.WithStack(errors.New(message))
 	return result
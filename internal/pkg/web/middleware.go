@@ -0,0 +1,192 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kagelui/notification/internal/pkg/loglib"
+)
+
+var (
+	// ErrBodyTooLarge is returned for request bodies over the limit of LimitBody
+	ErrBodyTooLarge = &Error{
+		Status: http.StatusRequestEntityTooLarge,
+		Code:   "body_too_large",
+		Desc:   "request body is too large",
+		Title:  "Request body too large",
+	}
+
+	// ErrTimeout is returned for requests not handled within the limit of Timeout
+	ErrTimeout = &Error{
+		Status: http.StatusServiceUnavailable,
+		Code:   "timeout",
+		Desc:   "request timed out",
+		Title:  "Request timeout",
+	}
+
+	errPanic = &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Desc: "panic"}
+)
+
+// bodyTooLargeMessage is the error message of http.MaxBytesReader past its limit
+const bodyTooLargeMessage = "http: request body too large"
+
+// Chain applies the middlewares to the handler, the first one being the outermost
+func Chain(h http.Handler, middlewares ...func(http.Handler) http.Handler) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// Recover is a middleware turning panics into a logged 500 error, http.ErrAbortHandler is left to the server.
+// A response already under way cannot become a 500, the connection is aborted instead so that the client sees it truncated
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			loglib.GetLogger(r.Context()).ErrorF("panic serving %s %s: %v\n%s", r.Method, r.URL.Path, p, debug.Stack())
+			if rec.written {
+				panic(http.ErrAbortHandler)
+			}
+			RespondError(w, r, errPanic)
+		}()
+		next.ServeHTTP(rec.wrap(), r)
+	})
+}
+
+// LimitBody returns a middleware rejecting request bodies over maxBytes.
+// Bodies without content length fail when read past the limit, see IsBodyTooLarge
+func LimitBody(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				RespondError(w, r, ErrBodyTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// IsBodyTooLarge tells if the error comes from reading a body past the limit of LimitBody
+func IsBodyTooLarge(err error) bool {
+	return err != nil && strings.Contains(err.Error(), bodyTooLargeMessage)
+}
+
+// Timeout returns a middleware responding ErrTimeout when the handler does not complete within d.
+// The request context is cancelled at the deadline, what the handler writes afterwards is discarded
+func Timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{header: make(http.Header)}
+			done := make(chan struct{})
+			panics := make(chan interface{}, 1)
+			go func() {
+				defer func() {
+					p := recover()
+					switch {
+					case p == http.ErrAbortHandler:
+						panics <- p
+					case p != nil:
+						// keep the stack of the handler goroutine for Recover
+						panics <- fmt.Sprintf("%v\n%s", p, debug.Stack())
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case p := <-panics:
+				panic(p)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				dst := w.Header()
+				for k, v := range tw.header {
+					dst[k] = v
+				}
+				if tw.status == 0 {
+					tw.status = http.StatusOK
+				}
+				w.WriteHeader(tw.status)
+				w.Write(tw.buf.Bytes())
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.timedOut = true
+				RespondError(w, r, ErrTimeout)
+			}
+		})
+	}
+}
+
+// timeoutWriter buffers the response until the handler completes
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.buf.Write(b)
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.status != 0 {
+		return
+	}
+	tw.status = status
+}
+
+// AccessLog is a middleware logging the method, path, status, size and latency of every request.
+// It logs with the request logger so it should be placed after Correlate
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec.wrap(), r)
+
+		loglib.GetLogger(r.Context()).WithFields(map[string]interface{}{
+			"method":     r.Method,
+			"path":       r.URL.Path,
+			"status":     rec.status,
+			"bytes":      rec.size,
+			"latency_ms": time.Since(start).Milliseconds(),
+		}).InfoF("[Access] %s %s %d", r.Method, r.URL.Path, rec.status)
+	})
+}
@@ -0,0 +1,191 @@
+package web
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+func TestChain(t *testing.T) {
+	var order []string
+	mark := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { order = append(order, "handler") }),
+		mark("first"), mark("second"))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	testutil.Equals(t, []string{"first", "second", "handler"}, order)
+}
+
+func TestRecover(t *testing.T) {
+	tests := []struct {
+		name       string
+		panicWith  interface{}
+		written    bool
+		wantStatus int
+		wantBody   string
+		wantPanic  bool
+	}{
+		{
+			name:       "no panic",
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "panic",
+			panicWith:  "boom",
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   `{"error":"internal_error","error_description":"Sorry, there was a problem. Please try again later."}`,
+		},
+		{
+			name:      "abort",
+			panicWith: http.ErrAbortHandler,
+			wantPanic: true,
+		},
+		{
+			name:       "panic after writing",
+			panicWith:  "boom",
+			written:    true,
+			wantStatus: http.StatusAccepted,
+			wantBody:   "partial",
+			wantPanic:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.written {
+					w.WriteHeader(http.StatusAccepted)
+					w.Write([]byte("partial"))
+				}
+				if tt.panicWith != nil {
+					panic(tt.panicWith)
+				}
+				w.WriteHeader(http.StatusNoContent)
+			})
+			rr := httptest.NewRecorder()
+			func() {
+				defer func() {
+					p := recover()
+					testutil.Equals(t, tt.wantPanic, p != nil)
+					if tt.wantPanic {
+						testutil.Asserts(t, p == http.ErrAbortHandler, "should panic with http.ErrAbortHandler")
+					}
+				}()
+				Recover(next).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/callback", nil))
+			}()
+			if tt.wantStatus == 0 {
+				return
+			}
+			testutil.Equals(t, tt.wantStatus, rr.Code)
+			testutil.Equals(t, tt.wantBody, strings.TrimSpace(rr.Body.String()))
+		})
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		unknownLength bool
+		wantStatus    int
+		wantReadErr   bool
+	}{
+		{name: "within limit", body: "1234", wantStatus: http.StatusOK},
+		{name: "content length over limit", body: "12345", wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "read over limit", body: "12345", unknownLength: true, wantStatus: http.StatusOK, wantReadErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var readErr error
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, readErr = ioutil.ReadAll(r.Body)
+			})
+			req := httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader(tt.body))
+			if tt.unknownLength {
+				req.ContentLength = -1
+			}
+			rr := httptest.NewRecorder()
+			LimitBody(4)(next).ServeHTTP(rr, req)
+
+			testutil.Equals(t, tt.wantStatus, rr.Code)
+			testutil.Equals(t, tt.wantReadErr, IsBodyTooLarge(readErr))
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		delay      time.Duration
+		wantStatus int
+		wantHeader string
+		wantBody   string
+	}{
+		{
+			name:       "completed",
+			wantStatus: http.StatusCreated,
+			wantHeader: "yes",
+			wantBody:   "created",
+		},
+		{
+			name:       "timed out",
+			delay:      time.Second,
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   `{"error":"timeout","error_description":"request timed out"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-time.After(tt.delay):
+				case <-r.Context().Done():
+				}
+				w.Header().Set("X-Handled", "yes")
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte("created"))
+			})
+			rr := httptest.NewRecorder()
+			Timeout(50*time.Millisecond)(next).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/callback", nil))
+
+			testutil.Equals(t, tt.wantStatus, rr.Code)
+			testutil.Equals(t, tt.wantHeader, rr.Header().Get("X-Handled"))
+			testutil.Equals(t, tt.wantBody, strings.TrimSpace(rr.Body.String()))
+		})
+	}
+}
+
+func TestTimeoutPanic(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("boom") })
+	rr := httptest.NewRecorder()
+	Recover(Timeout(time.Second)(next)).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/callback", nil))
+	testutil.Equals(t, http.StatusInternalServerError, rr.Code)
+
+	// the server aborts the connection silently
+	abort := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic(http.ErrAbortHandler) })
+	defer func() {
+		testutil.Asserts(t, recover() == http.ErrAbortHandler, "should panic with http.ErrAbortHandler")
+	}()
+	Timeout(time.Second)(abort).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/callback", nil))
+}
+
+func TestAccessLog(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("queued"))
+	})
+	rr := httptest.NewRecorder()
+	AccessLog(next).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/callback", nil))
+	testutil.Equals(t, http.StatusAccepted, rr.Code)
+	testutil.Equals(t, "queued", rr.Body.String())
+}
@@ -0,0 +1,97 @@
+package web
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/kagelui/notification/internal/pkg/loglib"
+	"github.com/kagelui/notification/internal/pkg/trace"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem details
+const ProblemContentType = "application/problem+json"
+
+// ProblemTypeBase prefixes the error code to form the problem type URI
+var ProblemTypeBase = "/problems/"
+
+// Problem is the RFC 7807 representation of Error, Code and RequestID are extension members
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// Problem returns the problem details of the error raised by the request
+func (e Error) Problem(r *http.Request) Problem {
+	code := e.ProblemCode
+	if code == "" {
+		code = e.Code
+	}
+	p := Problem{
+		Type:      ProblemTypeBase + code,
+		Title:     e.Title,
+		Status:    e.Status,
+		Detail:    e.Desc,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: trace.RequestID(r.Context()),
+		Errors:    e.Fields,
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(e.Status)
+	}
+	if sanitize(e.Status) {
+		p.Detail = GenericErrorMessage
+	}
+	return p
+}
+
+// AcceptsProblem tells if the Accept header of the request lists application/problem+json
+func AcceptsProblem(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(mediaRange)
+			if err == nil && mediaType == ProblemContentType && params["q"] != "0" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RespondError writes the error as problem details when the client accepts them, in the legacy
+// {"error","error_description"} shape otherwise. Errors other than Error are internal errors
+func RespondError(w http.ResponseWriter, r *http.Request, err error) {
+	webErr := TypecastError(err)
+	if webErr == nil {
+		webErr = &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Desc: err.Error(), Err: err}
+	}
+	if !AcceptsProblem(r) {
+		RespondJSON(r.Context(), w, webErr, nil)
+		return
+	}
+
+	logger := loglib.GetLogger(r.Context())
+	logger.ErrorF("[Web responder] Web error: %d %s %s", webErr.Status, webErr.Code, webErr.Desc)
+
+	respBytes, err := json.Marshal(webErr.Problem(r))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		logger.ErrorF("[Web responder] JSON marshal error: %s", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	logger = logger.WithField("error", "true").WithField("status", webErr.Status)
+	logger.InfoF("[Web responder] Wrote %d bytes", len(respBytes))
+
+	w.WriteHeader(webErr.Status)
+	w.Write(respBytes)
+}
@@ -0,0 +1,131 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kagelui/notification/internal/pkg/trace"
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+func TestAcceptsProblem(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept []string
+		want   bool
+	}{
+		{name: "no accept header", want: false},
+		{name: "json", accept: []string{"application/json"}, want: false},
+		{name: "any", accept: []string{"*/*"}, want: false},
+		{name: "problem", accept: []string{"application/problem+json"}, want: true},
+		{name: "problem in list", accept: []string{"application/json;q=0.9, application/problem+json"}, want: true},
+		{name: "problem in second header", accept: []string{"text/html", "application/problem+json;q=0.5"}, want: true},
+		{name: "problem refused", accept: []string{"application/problem+json;q=0"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/callback", nil)
+			for _, a := range tt.accept {
+				req.Header.Add("Accept", a)
+			}
+			testutil.Equals(t, tt.want, AcceptsProblem(req))
+		})
+	}
+}
+
+func TestRespondError(t *testing.T) {
+	shared := &Error{Status: http.StatusInternalServerError, Code: "db_error", Desc: "connection refused"}
+	tests := []struct {
+		name       string
+		err        error
+		accept     string
+		wantStatus int
+		wantType   string
+		wantBody   string
+	}{
+		{
+			name:       "legacy",
+			err:        &Error{Status: http.StatusBadRequest, Code: CodeBadRequest, Desc: "cannot parse request"},
+			wantStatus: http.StatusBadRequest,
+			wantType:   "application/json",
+			wantBody:   `{"error":"bad_request","error_description":"cannot parse request"}`,
+		},
+		{
+			name:       "legacy sanitized",
+			err:        shared,
+			wantStatus: http.StatusInternalServerError,
+			wantType:   "application/json",
+			wantBody:   `{"error":"db_error","error_description":"Sorry, there was a problem. Please try again later."}`,
+		},
+		{
+			name:       "legacy non web error",
+			err:        errors.New("boom"),
+			wantStatus: http.StatusInternalServerError,
+			wantType:   "application/json",
+			wantBody:   `{"error":"internal_error","error_description":"Sorry, there was a problem. Please try again later."}`,
+		},
+		{
+			name:       "problem",
+			err:        &Error{Status: http.StatusBadRequest, Code: CodeBadRequest, Desc: "cannot parse request", Title: "Malformed request body"},
+			accept:     ProblemContentType,
+			wantStatus: http.StatusBadRequest,
+			wantType:   ProblemContentType,
+			wantBody: `{"type":"/problems/bad_request","title":"Malformed request body","status":400,` +
+				`"detail":"cannot parse request","instance":"/callback","code":"bad_request","request_id":"request0"}`,
+		},
+		{
+			name:       "legacy code",
+			err:        &Error{Status: http.StatusBadRequest, Code: "400 Bad Request", Desc: "cannot parse request", ProblemCode: CodeBadRequest},
+			wantStatus: http.StatusBadRequest,
+			wantType:   "application/json",
+			wantBody:   `{"error":"400 Bad Request","error_description":"cannot parse request"}`,
+		},
+		{
+			name:       "problem of legacy code",
+			err:        &Error{Status: http.StatusBadRequest, Code: "400 Bad Request", Desc: "cannot parse request", ProblemCode: CodeBadRequest},
+			accept:     ProblemContentType,
+			wantStatus: http.StatusBadRequest,
+			wantType:   ProblemContentType,
+			wantBody: `{"type":"/problems/bad_request","title":"Bad Request","status":400,` +
+				`"detail":"cannot parse request","instance":"/callback","code":"bad_request","request_id":"request0"}`,
+		},
+		{
+			name:       "problem sanitized with default title",
+			err:        shared,
+			accept:     ProblemContentType,
+			wantStatus: http.StatusInternalServerError,
+			wantType:   ProblemContentType,
+			wantBody: `{"type":"/problems/db_error","title":"Internal Server Error","status":500,` +
+				`"detail":"Sorry, there was a problem. Please try again later.","instance":"/callback","code":"db_error","request_id":"request0"}`,
+		},
+		{
+			name:       "problem with field errors",
+			err:        NewValidationError([]FieldError{{Field: "product_id", Code: "required", Message: "product_id is required"}}),
+			accept:     ProblemContentType,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantType:   ProblemContentType,
+			wantBody: `{"type":"/problems/validation_failed","title":"Validation failed","status":422,` +
+				`"detail":"request validation failed","instance":"/callback","code":"validation_failed","request_id":"request0",` +
+				`"errors":[{"field":"product_id","code":"required","message":"product_id is required"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/callback", nil)
+			req = req.WithContext(trace.WithRequestID(req.Context(), "request0"))
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+
+			RespondError(rr, req, tt.err)
+
+			testutil.Equals(t, tt.wantStatus, rr.Code)
+			testutil.Equals(t, tt.wantType, rr.Header().Get("Content-Type"))
+			testutil.Equals(t, tt.wantBody, rr.Body.String())
+			testutil.Equals(t, "connection refused", shared.Desc)
+		})
+	}
+}
@@ -38,10 +38,11 @@ func RespondJSON(ctx context.Context, w http.ResponseWriter, object interface{},
 		// Log raw error response
 		logger.ErrorF("[Web responder] Web error: %d %s %s", werr.Status, werr.Code, werr.Desc)
 
-		// 5XX (except 503) should be sanitized before showing to human
-		if werr.Status >= 500 && werr.Status != http.StatusServiceUnavailable {
-			werr.Desc = GenericErrorMessage
-			respBytes, _ = json.Marshal(werr)
+		// 5XX (except 503) should be sanitized before showing to human, errors may be shared so werr is not modified
+		if sanitize(werr.Status) {
+			sanitized := *werr
+			sanitized.Desc = GenericErrorMessage
+			respBytes, _ = json.Marshal(sanitized)
 		}
 
 		// Add logger fields
@@ -49,11 +50,16 @@ func RespondJSON(ctx context.Context, w http.ResponseWriter, object interface{},
 		status = werr.Status
 	}
 
-	// Log response body
-	logger.WithField("status", status).
-		InfoF("[Web responder] Wrote %d bytes: %v", len(respBytes), string(respBytes))
+	// Log response size, the body is not logged as it may contain PII
+	logger = logger.WithField("status", status)
+	logger.InfoF("[Web responder] Wrote %d bytes", len(respBytes))
 
 	// Write response
 	w.WriteHeader(status)
 	w.Write(respBytes)
 }
+
+// sanitize tells if the description of errors with the status must be hidden from clients
+func sanitize(status int) bool {
+	return status >= 500 && status != http.StatusServiceUnavailable
+}
@@ -0,0 +1,295 @@
+package messages
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kagelui/notification/internal/models/bmodels"
+	"github.com/kagelui/notification/internal/pkg/secret"
+	"github.com/kagelui/notification/internal/pkg/web"
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+)
+
+// Authentication strategies of the callback URLs, the merchant token is sent with all of them
+const (
+	AuthTypeNone   = ""
+	AuthTypeStatic = "static"
+	AuthTypeBasic  = "basic"
+	AuthTypeOAuth2 = "oauth2"
+)
+
+// tokenExpiryLeeway renews OAuth2 tokens before they expire on the way to the merchant
+const tokenExpiryLeeway = 30 * time.Second
+
+// defaultTokenLifetime is assumed for OAuth2 tokens returned without expiry
+const defaultTokenLifetime = 5 * time.Minute
+
+// AuthConfig configures the authentication strategy of a callback URL, it is stored sealed as it holds secrets
+type AuthConfig struct {
+	// static header, e.g. Authorization: ApiKey abc
+	Header string `json:"header,omitempty"`
+	Value  string `json:"value,omitempty"`
+	// basic auth
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// OAuth2 client credentials
+	TokenURL     string   `json:"token_url,omitempty"`
+	ClientID     string   `json:"client_id,omitempty"`
+	ClientSecret string   `json:"client_secret,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+}
+
+// Validate returns the missing or invalid settings of the auth type
+func (a AuthConfig) Validate(authType string) []web.FieldError {
+	var required map[string]string
+	switch authType {
+	case AuthTypeNone:
+		return nil
+	case AuthTypeStatic:
+		required = map[string]string{"header": a.Header, "value": a.Value}
+	case AuthTypeBasic:
+		required = map[string]string{"username": a.Username, "password": a.Password}
+	case AuthTypeOAuth2:
+		required = map[string]string{"token_url": a.TokenURL, "client_id": a.ClientID, "client_secret": a.ClientSecret}
+	default:
+		return []web.FieldError{{Field: "type", Code: "unknown_auth_type", Message: fmt.Sprintf("unknown auth type %q", authType)}}
+	}
+
+	var fieldErrors []web.FieldError
+	for _, field := range []string{"header", "value", "username", "password", "token_url", "client_id", "client_secret"} {
+		if value, ok := required[field]; ok && strings.TrimSpace(value) == "" {
+			fieldErrors = append(fieldErrors, web.FieldError{Field: "config." + field, Code: "required", Message: field + " is required"})
+		}
+	}
+	if authType == AuthTypeOAuth2 && a.TokenURL != "" {
+		if u, err := url.Parse(a.TokenURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			fieldErrors = append(fieldErrors, web.FieldError{Field: "config.token_url", Code: "invalid_url", Message: "token_url must be an absolute HTTP(S) URL"})
+		}
+	}
+	return fieldErrors
+}
+
+// authorizer adds the credentials of a callback URL to the callback requests
+type authorizer interface {
+	authorize(ctx context.Context, req *http.Request) error
+}
+
+type staticAuth struct {
+	header, value string
+}
+
+func (a staticAuth) authorize(_ context.Context, req *http.Request) error {
+	req.Header.Set(a.header, a.value)
+	return nil
+}
+
+type basicAuth struct {
+	username, password string
+}
+
+func (a basicAuth) authorize(_ context.Context, req *http.Request) error {
+	req.SetBasicAuth(a.username, a.password)
+	return nil
+}
+
+// tokenSource obtains and caches the OAuth2 token of the client credentials
+type tokenSource struct {
+	cfg    AuthConfig
+	client *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func (s *tokenSource) authorize(ctx context.Context, req *http.Request) error {
+	token, err := s.Token(ctx)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// Token returns the cached token, or requests a new one when it is about to expire
+func (s *tokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Now().Before(s.expiry) {
+		return s.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(s.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.cfg.Scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(s.cfg.ClientID), url.QueryEscape(s.cfg.ClientSecret))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("requesting OAuth2 token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, resp.Body)
+		return "", fmt.Errorf("requesting OAuth2 token: status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("decoding OAuth2 token: %v", err)
+	}
+	if body.AccessToken == "" {
+		return "", fmt.Errorf("decoding OAuth2 token: no access token")
+	}
+	if body.TokenType != "" && !strings.EqualFold(body.TokenType, "bearer") {
+		return "", fmt.Errorf("unsupported OAuth2 token type %s", body.TokenType)
+	}
+	lifetime := defaultTokenLifetime
+	if body.ExpiresIn > 0 {
+		lifetime = time.Duration(body.ExpiresIn) * time.Second
+	}
+	if lifetime > 2*tokenExpiryLeeway {
+		lifetime -= tokenExpiryLeeway
+	}
+	s.token, s.expiry = body.AccessToken, time.Now().Add(lifetime)
+	return s.token, nil
+}
+
+// invalidate drops the cached token, e.g. when the merchant rejects it before its expiry
+func (s *tokenSource) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = ""
+}
+
+// cachedSource is the token source of a callback URL with the sealed settings it was opened from
+type cachedSource struct {
+	sealed string
+	source *tokenSource
+}
+
+// Authenticators opens the auth settings of the callback URLs and caches their OAuth2 tokens
+type Authenticators struct {
+	// Keys seals the auth settings, callback URLs with auth cannot be called without it
+	Keys *secret.Keyring
+	// Secrets opens the auth settings sealed by SECRETS_KEY before the keyring, which have no key ID
+	Secrets *secret.Box
+	// Client requests the OAuth2 tokens
+	Client *http.Client
+
+	mu      sync.Mutex
+	sources map[int]cachedSource
+}
+
+// NewAuthenticators returns Authenticators sealing the auth settings with keys, secrets only opens the settings
+// sealed before the keyring and may be nil
+func NewAuthenticators(keys *secret.Keyring, secrets *secret.Box, client *http.Client) *Authenticators {
+	return &Authenticators{Keys: keys, Secrets: secrets, Client: client, sources: make(map[int]cachedSource)}
+}
+
+// authorizer returns the authorizer of the callback URL, nil when it has no auth
+func (a *Authenticators) authorizer(url *bmodels.CallbackURL) (authorizer, error) {
+	if url.AuthType == AuthTypeNone {
+		return nil, nil
+	}
+	if a == nil {
+		return nil, fmt.Errorf("auth of callback URL %d: %v", url.ID, secret.ErrNoKey)
+	}
+	cfg, err := a.open(url.AuthConfig, url.AuthConfigKeyID)
+	if err != nil {
+		return nil, fmt.Errorf("auth of callback URL %d: %v", url.ID, err)
+	}
+
+	switch url.AuthType {
+	case AuthTypeStatic:
+		return staticAuth{header: cfg.Header, value: cfg.Value}, nil
+	case AuthTypeBasic:
+		return basicAuth{username: cfg.Username, password: cfg.Password}, nil
+	case AuthTypeOAuth2:
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		// the sealed settings change with every update, so updated credentials replace the source and its token
+		cached, ok := a.sources[url.ID]
+		if !ok || cached.sealed != url.AuthConfig {
+			cached = cachedSource{sealed: url.AuthConfig, source: &tokenSource{cfg: cfg, client: a.Client}}
+			a.sources[url.ID] = cached
+		}
+		return cached.source, nil
+	}
+	return nil, fmt.Errorf("auth of callback URL %d: unknown auth type %q", url.ID, url.AuthType)
+}
+
+// seal seals the auth settings with the primary key of the keyring, they are never stored in plaintext
+func (a *Authenticators) seal(plaintext string) (sealed, keyID string, err error) {
+	if a == nil {
+		return "", "", secret.ErrNoKey
+	}
+	keyID, sealed, err = a.Keys.Seal(plaintext)
+	return sealed, keyID, err
+}
+
+// openAuthConfig opens the auth settings sealed by the keyring key with the ID, or by secrets without key ID
+func openAuthConfig(keys *secret.Keyring, secrets *secret.Box, sealed, keyID string) (string, error) {
+	if keyID == "" {
+		return secrets.Open(sealed)
+	}
+	return keys.Open(keyID, sealed)
+}
+
+func (a *Authenticators) open(sealed, keyID string) (AuthConfig, error) {
+	var cfg AuthConfig
+	plaintext, err := openAuthConfig(a.Keys, a.Secrets, sealed, keyID)
+	if err != nil {
+		return cfg, err
+	}
+	err = json.Unmarshal([]byte(plaintext), &cfg)
+	return cfg, err
+}
+
+// SetCallbackAuth validates and seals the auth settings of the callback URL, AuthTypeNone removes them
+func (m ModelStore) SetCallbackAuth(ctx context.Context, callbackURLID int, authType string, cfg AuthConfig) error {
+	if fieldErrors := cfg.Validate(authType); len(fieldErrors) > 0 {
+		return web.NewValidationError(fieldErrors)
+	}
+	url, err := bmodels.FindCallbackURL(ctx, m.DB, callbackURLID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUnknownCallbackURL
+	}
+	if err != nil {
+		return err
+	}
+
+	url.AuthType, url.AuthConfig, url.AuthConfigKeyID = authType, "", ""
+	if authType != AuthTypeNone {
+		data, err := json.Marshal(cfg)
+		if err != nil {
+			return err
+		}
+		if url.AuthConfig, url.AuthConfigKeyID, err = m.Auth.seal(string(data)); err != nil {
+			return err
+		}
+	}
+	_, err = url.Update(ctx, m.DB, boil.Whitelist(bmodels.CallbackURLColumns.AuthType, bmodels.CallbackURLColumns.AuthConfig,
+		bmodels.CallbackURLColumns.AuthConfigKeyID, bmodels.CallbackURLColumns.UpdatedAt))
+	return err
+}
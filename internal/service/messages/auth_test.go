@@ -0,0 +1,281 @@
+package messages
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kagelui/notification/internal/models/bmodels"
+	"github.com/kagelui/notification/internal/pkg/secret"
+	"github.com/kagelui/notification/internal/pkg/web"
+	"github.com/kagelui/notification/internal/testutil"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+)
+
+func newTestBox(t *testing.T) *secret.Box {
+	t.Helper()
+	box, err := secret.NewBox(bytes.Repeat([]byte{7}, secret.KeySize))
+	testutil.Ok(t, err)
+	return box
+}
+
+// authURL returns a callback URL with the auth settings sealed by the keyring
+func authURL(t *testing.T, keys *secret.Keyring, id int, authType string, cfg AuthConfig) bmodels.CallbackURL {
+	t.Helper()
+	data, err := json.Marshal(cfg)
+	testutil.Ok(t, err)
+	keyID, sealed, err := keys.Seal(string(data))
+	testutil.Ok(t, err)
+	return bmodels.CallbackURL{ID: id, AuthType: authType, AuthConfig: sealed, AuthConfigKeyID: keyID}
+}
+
+// newTokenServer issues the tokens token0, token1... to the client credentials, counting the requests
+func newTokenServer(t *testing.T, expiresIn int) (*httptest.Server, *int32) {
+	var issued int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "client" || secret != "s3cret" || r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		testutil.Equals(t, "callbacks:write", r.FormValue("scope"))
+		n := atomic.AddInt32(&issued, 1) - 1
+		fmt.Fprintf(w, `{"access_token":"token%d","token_type":"Bearer","expires_in":%d}`, n, expiresIn)
+	}))
+	return srv, &issued
+}
+
+func TestAuthConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		authType string
+		cfg      AuthConfig
+		want     []web.FieldError
+	}{
+		{name: "none", authType: AuthTypeNone},
+		{name: "unknown", authType: "digest", want: []web.FieldError{{Field: "type", Code: "unknown_auth_type", Message: `unknown auth type "digest"`}}},
+		{name: "static", authType: AuthTypeStatic, cfg: AuthConfig{Header: "Authorization", Value: "ApiKey abc"}},
+		{
+			name:     "static without value",
+			authType: AuthTypeStatic,
+			cfg:      AuthConfig{Header: "Authorization"},
+			want:     []web.FieldError{{Field: "config.value", Code: "required", Message: "value is required"}},
+		},
+		{
+			name:     "basic without credentials",
+			authType: AuthTypeBasic,
+			want: []web.FieldError{
+				{Field: "config.username", Code: "required", Message: "username is required"},
+				{Field: "config.password", Code: "required", Message: "password is required"},
+			},
+		},
+		{
+			name:     "oauth2 with relative token URL",
+			authType: AuthTypeOAuth2,
+			cfg:      AuthConfig{TokenURL: "/token", ClientID: "client", ClientSecret: "s3cret"},
+			want:     []web.FieldError{{Field: "config.token_url", Code: "invalid_url", Message: "token_url must be an absolute HTTP(S) URL"}},
+		},
+		{name: "oauth2", authType: AuthTypeOAuth2, cfg: AuthConfig{TokenURL: "https://bank/token", ClientID: "client", ClientSecret: "s3cret"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.Equals(t, tt.want, tt.cfg.Validate(tt.authType))
+		})
+	}
+}
+
+func TestAuthenticators_authorizer(t *testing.T) {
+	box, keys := newTestBox(t), testKeyring(t, "2021-05")
+	tokenServer, _ := newTokenServer(t, 3600)
+	defer tokenServer.Close()
+	legacy, err := box.Seal(`{"header":"X-Api-Key","value":"legacy"}`)
+	testutil.Ok(t, err)
+
+	tests := []struct {
+		name       string
+		auth       *Authenticators
+		url        bmodels.CallbackURL
+		wantHeader string
+		wantValue  string
+		wantErr    string
+	}{
+		{
+			name: "none",
+			auth: nil,
+			url:  bmodels.CallbackURL{ID: 1},
+		},
+		{
+			name:    "no key",
+			auth:    nil,
+			url:     authURL(t, keys, 2, AuthTypeStatic, AuthConfig{Header: "X-Api-Key", Value: "abc"}),
+			wantErr: "auth of callback URL 2: no secrets key configured",
+		},
+		{
+			name:    "plaintext settings",
+			auth:    NewAuthenticators(keys, box, http.DefaultClient),
+			url:     bmodels.CallbackURL{ID: 3, AuthType: AuthTypeStatic, AuthConfig: `{"header":"X-Api-Key","value":"abc"}`},
+			wantErr: "auth of callback URL 3: value is not sealed",
+		},
+		{
+			name:       "static",
+			auth:       NewAuthenticators(keys, nil, http.DefaultClient),
+			url:        authURL(t, keys, 4, AuthTypeStatic, AuthConfig{Header: "X-Api-Key", Value: "abc"}),
+			wantHeader: "X-Api-Key",
+			wantValue:  "abc",
+		},
+		{
+			name:       "basic",
+			auth:       NewAuthenticators(keys, nil, http.DefaultClient),
+			url:        authURL(t, keys, 5, AuthTypeBasic, AuthConfig{Username: "notification", Password: "pass"}),
+			wantHeader: "Authorization",
+			wantValue:  "Basic bm90aWZpY2F0aW9uOnBhc3M=",
+		},
+		{
+			name:       "oauth2",
+			auth:       NewAuthenticators(keys, nil, http.DefaultClient),
+			url:        authURL(t, keys, 6, AuthTypeOAuth2, AuthConfig{TokenURL: tokenServer.URL, ClientID: "client", ClientSecret: "s3cret", Scopes: []string{"callbacks:write"}}),
+			wantHeader: "Authorization",
+			wantValue:  "Bearer token0",
+		},
+		{
+			name:       "sealed before the keyring",
+			auth:       NewAuthenticators(keys, box, http.DefaultClient),
+			url:        bmodels.CallbackURL{ID: 7, AuthType: AuthTypeStatic, AuthConfig: legacy},
+			wantHeader: "X-Api-Key",
+			wantValue:  "legacy",
+		},
+		{
+			name:    "sealed before the keyring without secrets key",
+			auth:    NewAuthenticators(keys, nil, http.DefaultClient),
+			url:     bmodels.CallbackURL{ID: 8, AuthType: AuthTypeStatic, AuthConfig: legacy},
+			wantErr: "auth of callback URL 8: no secrets key configured",
+		},
+		{
+			name:    "unknown key",
+			auth:    NewAuthenticators(testKeyring(t, "2022-01"), nil, http.DefaultClient),
+			url:     authURL(t, keys, 9, AuthTypeStatic, AuthConfig{Header: "X-Api-Key", Value: "abc"}),
+			wantErr: `auth of callback URL 9: unknown keyring key "2021-05"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, err := tt.auth.authorizer(&tt.url)
+			testutil.CompareError(t, tt.wantErr, err)
+			if err != nil || tt.wantHeader == "" {
+				testutil.Asserts(t, auth == nil, "authorizer should be nil")
+				return
+			}
+			req := httptest.NewRequest(http.MethodPost, "https://merchant/callback", nil)
+			testutil.Ok(t, auth.authorize(context.Background(), req))
+			testutil.Equals(t, tt.wantValue, req.Header.Get(tt.wantHeader))
+		})
+	}
+}
+
+func TestTokenSource(t *testing.T) {
+	tokenServer, issued := newTokenServer(t, 3600)
+	defer tokenServer.Close()
+	keys := testKeyring(t, "2021-05")
+	auth := NewAuthenticators(keys, nil, http.DefaultClient)
+	oauth2 := authURL(t, keys, 1, AuthTypeOAuth2, AuthConfig{TokenURL: tokenServer.URL, ClientID: "client", ClientSecret: "s3cret", Scopes: []string{"callbacks:write"}})
+	url := &oauth2
+	ctx := context.Background()
+
+	first, err := auth.authorizer(url)
+	testutil.Ok(t, err)
+	second, err := auth.authorizer(url)
+	testutil.Ok(t, err)
+	testutil.Asserts(t, first == second, "token source should be shared")
+
+	// updated settings replace the source of the callback URL
+	updated := authURL(t, keys, 1, AuthTypeOAuth2, AuthConfig{TokenURL: tokenServer.URL, ClientID: "client", ClientSecret: "s3cret", Scopes: []string{"callbacks:write"}})
+	replaced, err := auth.authorizer(&updated)
+	testutil.Ok(t, err)
+	testutil.Asserts(t, replaced != first, "token source should be replaced")
+	testutil.Equals(t, 1, len(auth.sources))
+	first, err = auth.authorizer(url)
+	testutil.Ok(t, err)
+
+	source := first.(*tokenSource)
+	token, err := source.Token(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "token0", token)
+	token, err = source.Token(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "token0", token)
+	testutil.Equals(t, int32(1), atomic.LoadInt32(issued))
+
+	source.invalidate()
+	token, err = source.Token(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "token1", token)
+
+	// expired tokens are renewed
+	source.mu.Lock()
+	source.expiry = time.Now().Add(-time.Second)
+	source.mu.Unlock()
+	token, err = source.Token(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "token2", token)
+
+	bad := &tokenSource{cfg: AuthConfig{TokenURL: tokenServer.URL, ClientID: "client", ClientSecret: "wrong"}, client: http.DefaultClient}
+	_, err = bad.Token(ctx)
+	testutil.CompareError(t, "requesting OAuth2 token: status 401", err)
+}
+
+func TestCallbackClient_doOneCallback_auth(t *testing.T) {
+	var gotHeader string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Get("X-Api-Key")
+	}))
+	defer srv.Close()
+
+	c := CallbackClient{Client: http.DefaultClient}
+	code, err := c.doOneCallback(context.Background(), c.Client, staticAuth{header: "X-Api-Key", value: "abc"}, RequestOptions{}, srv.URL, []string{"some token"}, "{}")
+	testutil.Ok(t, err)
+	testutil.Equals(t, http.StatusOK, code)
+	testutil.Equals(t, "abc", gotHeader)
+}
+
+func TestModelStore_SetCallbackAuth(t *testing.T) {
+	ctx := context.TODO()
+	keys := testKeyring(t, "2021-05")
+	tx := db.MustBegin()
+	defer tx.Rollback()
+	url := bmodels.CallbackURL{ID: 42001, BusinessID: "bank0", ProductID: "va", CallbackURL: "https://bank0"}
+	testutil.Ok(t, url.Insert(ctx, tx, boil.Infer()))
+
+	tests := []struct {
+		name     string
+		store    ModelStore
+		id       int
+		authType string
+		cfg      AuthConfig
+		wantErr  string
+	}{
+		{name: "unknown callback URL", store: ModelStore{DB: tx, Auth: NewAuthenticators(keys, nil, nil)}, id: 1, authType: AuthTypeNone, wantErr: ErrUnknownCallbackURL.Error()},
+		{name: "invalid", store: ModelStore{DB: tx, Auth: NewAuthenticators(keys, nil, nil)}, id: url.ID, authType: AuthTypeBasic, wantErr: "request validation failed"},
+		{name: "no key", store: ModelStore{DB: tx}, id: url.ID, authType: AuthTypeBasic, cfg: AuthConfig{Username: "u", Password: "p"}, wantErr: secret.ErrNoKey.Error()},
+		{name: "no keyring", store: ModelStore{DB: tx, Auth: NewAuthenticators(nil, newTestBox(t), nil)}, id: url.ID, authType: AuthTypeBasic, cfg: AuthConfig{Username: "u", Password: "p"}, wantErr: secret.ErrNoKey.Error()},
+		{name: "sealed", store: ModelStore{DB: tx, Auth: NewAuthenticators(keys, nil, nil)}, id: url.ID, authType: AuthTypeBasic, cfg: AuthConfig{Username: "u", Password: "p"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.CompareError(t, tt.wantErr, tt.store.SetCallbackAuth(ctx, tt.id, tt.authType, tt.cfg))
+		})
+	}
+
+	testutil.Ok(t, url.Reload(ctx, tx))
+	testutil.Equals(t, AuthTypeBasic, url.AuthType)
+	testutil.Asserts(t, secret.IsEnvelope(url.AuthConfig), "auth config should be sealed")
+	testutil.Equals(t, "2021-05", url.AuthConfigKeyID)
+	cfg, err := NewAuthenticators(keys, nil, nil).open(url.AuthConfig, url.AuthConfigKeyID)
+	testutil.Ok(t, err)
+	testutil.Equals(t, AuthConfig{Username: "u", Password: "p"}, cfg)
+}
@@ -0,0 +1,34 @@
+package messages
+
+import (
+	"context"
+
+	"github.com/kagelui/notification/internal/models/bmodels"
+	"github.com/kagelui/notification/internal/pkg/loglib"
+	"github.com/kagelui/notification/internal/pkg/trace"
+)
+
+// MessageContext returns a copy of ctx carrying the request ID and trace context stored with the message,
+// so that every delivery attempt logs and forwards the correlation of the original request
+func MessageContext(ctx context.Context, m *bmodels.Message) context.Context {
+	fields := map[string]interface{}{"message_id": m.ID}
+	if m.RequestID != "" {
+		ctx = trace.WithRequestID(ctx, m.RequestID)
+		fields["request_id"] = m.RequestID
+	}
+	if sc, err := trace.Parse(m.Traceparent); err == nil {
+		ctx = trace.NewContext(ctx, sc)
+		fields["trace_id"] = sc.TraceID
+	}
+	return loglib.SetLogger(ctx, loglib.GetLogger(ctx).WithFields(fields))
+}
+
+// setCorrelationHeaders forwards the request ID and the trace context carried by ctx
+func setCorrelationHeaders(ctx context.Context, header interface{ Set(key, value string) }) {
+	if requestID := trace.RequestID(ctx); requestID != "" {
+		header.Set(trace.RequestIDHeader, requestID)
+	}
+	if sc, ok := trace.FromContext(ctx); ok && sc.IsValid() {
+		header.Set(trace.TraceparentHeader, sc.String())
+	}
+}
@@ -0,0 +1,36 @@
+package messages
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/kagelui/notification/internal/models/bmodels"
+	"github.com/kagelui/notification/internal/pkg/loglib"
+	"github.com/kagelui/notification/internal/pkg/trace"
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+func TestMessageContext(t *testing.T) {
+	sc := trace.NewSpanContext()
+	ctx := MessageContext(context.TODO(), &bmodels.Message{ID: "message0", RequestID: "request0", Traceparent: sc.String()})
+
+	testutil.Equals(t, "request0", trace.RequestID(ctx))
+	got, ok := trace.FromContext(ctx)
+	testutil.Asserts(t, ok, "should have span context")
+	testutil.Equals(t, sc, got)
+	testutil.Equals(t, "message0", loglib.GetLogger(ctx).LogEntry.Data["message_id"])
+	testutil.Equals(t, "request0", loglib.GetLogger(ctx).LogEntry.Data["request_id"])
+	testutil.Equals(t, sc.TraceID, loglib.GetLogger(ctx).LogEntry.Data["trace_id"])
+
+	header := http.Header{}
+	setCorrelationHeaders(ctx, header)
+	testutil.Equals(t, "request0", header.Get(trace.RequestIDHeader))
+	testutil.Equals(t, sc.String(), header.Get(trace.TraceparentHeader))
+
+	// messages stored before correlation was introduced
+	ctx = MessageContext(context.TODO(), &bmodels.Message{ID: "message1"})
+	header = http.Header{}
+	setCorrelationHeaders(ctx, header)
+	testutil.Equals(t, http.Header{}, header)
+}
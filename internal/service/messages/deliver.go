@@ -1,21 +1,36 @@
 package messages
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"time"
 
 	"github.com/kagelui/notification/internal/models/bmodels"
+	"github.com/kagelui/notification/internal/pkg/loglib"
+	"github.com/kagelui/notification/internal/pkg/secret"
+	"github.com/kagelui/notification/internal/pkg/trace"
 	"github.com/volatiletech/sqlboiler/v4/boil"
 )
 
 const tokenHeaderKey = "x-callback-token"
 
+// maxResponseBytes bounds how much of a callback response is read
+const maxResponseBytes = 64 << 10
+
 type CallbackClient struct {
 	Client *http.Client
+	// Events receives the outcome of every callback attempt, events are discarded when nil
+	Events EventSink
+	// Transports calls the callback URLs with TLS settings, a shared cache is used when nil
+	Transports *TransportCache
+	// Auth authenticates the callbacks to the callback URLs with auth settings, which fail when nil
+	Auth *Authenticators
+	// Keys opens the sealed merchant tokens and payloads, which fail when nil
+	Keys *secret.Keyring
 }
 
 // Inquirer unifies *sql.DB and *sql.Tx, facilitating unit tests
@@ -29,52 +44,168 @@ type Inquirer interface {
 }
 
 // DoCallback carries out the callback, note that messageWithMerchantInfo must contain the merchant info
-func (c CallbackClient) DoCallback(ctx context.Context, db Inquirer, messageWithMerchantInfo *bmodels.Message) error {
+func (c CallbackClient) DoCallback(ctx context.Context, db Inquirer, messageWithMerchantInfo *bmodels.Message) (err error) {
 	if messageWithMerchantInfo.R == nil || messageWithMerchantInfo.R.Merchant == nil {
 		return ErrMerchantInfoNotLoaded
 	}
+	ctx = MessageContext(ctx, messageWithMerchantInfo)
+
+	event := DeliveryEvent{
+		MessageID:  messageWithMerchantInfo.ID,
+		BusinessID: messageWithMerchantInfo.R.Merchant.BusinessID,
+		ProductID:  messageWithMerchantInfo.ProductID,
+		Attempt:    messageWithMerchantInfo.RetryCount + 1,
+	}
+
+	ctx, span := trace.StartSpan(ctx, "deliver")
+	span.SetAttribute("message_id", event.MessageID)
+	span.SetAttribute("business_id", event.BusinessID)
+	span.SetAttribute("product_id", event.ProductID)
+	span.SetAttribute("attempt", event.Attempt)
+	defer func() {
+		span.SetAttribute("outcome", event.Status)
+		span.RecordError(err)
+		span.End()
+	}()
 
+	spanCtx, urlSpan := trace.StartSpan(ctx, "callback_url.lookup")
 	urlRecord, err := bmodels.CallbackUrls(
 		bmodels.CallbackURLWhere.ProductID.EQ(messageWithMerchantInfo.ProductID),
-		bmodels.CallbackURLWhere.BusinessID.EQ(messageWithMerchantInfo.R.Merchant.BusinessID)).One(ctx, db)
+		bmodels.CallbackURLWhere.BusinessID.EQ(messageWithMerchantInfo.R.Merchant.BusinessID)).One(spanCtx, db)
+	urlSpan.RecordError(err)
+	urlSpan.End()
 	if err != nil {
 		return err
 	}
 
-	if c.doOneCallback(urlRecord.CallbackURL, messageWithMerchantInfo.R.Merchant.Token, messageWithMerchantInfo.Payload.String()) != nil {
+	// a missing or retired key, or a broken TLS, auth or option setting fails the attempt so that the message is
+	// retried once it is fixed
+	spanCtx, tokenSpan := trace.StartSpan(ctx, "merchant_token.lookup")
+	tokens, callbackErr := activeTokens(spanCtx, db, c.Keys, messageWithMerchantInfo.R.Merchant, time.Now())
+	tokenSpan.RecordError(callbackErr)
+	tokenSpan.End()
+	var payload string
+	if callbackErr == nil {
+		payload, callbackErr = openPayload(c.Keys, messageWithMerchantInfo)
+	}
+
+	spanCtx, httpSpan := trace.StartSpan(ctx, "callback.http")
+	httpSpan.SetKind(trace.SpanKindClient)
+	deliveriesInFlight.Add(1)
+	start := time.Now()
+	var code int
+	var httpClient *http.Client
+	if callbackErr == nil {
+		httpClient, callbackErr = c.transports().Client(c.Client, urlRecord)
+	}
+	var auth authorizer
+	if callbackErr == nil {
+		auth, callbackErr = c.Auth.authorizer(urlRecord)
+	}
+	var opts RequestOptions
+	if callbackErr == nil {
+		opts, callbackErr = callbackOptions(urlRecord)
+	}
+	if callbackErr == nil {
+		httpClient = opts.client(httpClient)
+		code, callbackErr = c.doOneCallback(spanCtx, httpClient, auth, opts, urlRecord.CallbackURL, tokens, payload)
+		// the merchant may revoke an OAuth2 token before its expiry
+		if source, ok := auth.(*tokenSource); ok && code == http.StatusUnauthorized {
+			source.invalidate()
+			code, callbackErr = c.doOneCallback(spanCtx, httpClient, auth, opts, urlRecord.CallbackURL, tokens, payload)
+		}
+	}
+	duration := time.Since(start).Seconds()
+	deliveriesInFlight.Add(-1)
+	httpSpan.SetAttribute("http.status_code", code)
+	httpSpan.RecordError(callbackErr)
+	httpSpan.End()
+
+	event.HTTPCode = code
+	if callbackErr != nil {
+		loglib.GetLogger(ctx).WarnF("callback attempt %d failed: %v", event.Attempt, callbackErr.Error())
 		messageWithMerchantInfo.Status = MessageDeliveryStatusFailed
 		messageWithMerchantInfo.NextDeliveryTime = getRetryTime(messageWithMerchantInfo.NextDeliveryTime, messageWithMerchantInfo.RetryCount)
 		messageWithMerchantInfo.RetryCount++
-		_, e := messageWithMerchantInfo.Update(ctx, db,
-			boil.Whitelist(bmodels.MessageColumns.Status,
-				bmodels.MessageColumns.NextDeliveryTime,
-				bmodels.MessageColumns.RetryCount, bmodels.MessageColumns.UpdatedAt))
-		return e
+		event.Status = DeliveryOutcomeFailed
+		if messageWithMerchantInfo.RetryCount >= maxRetry {
+			event.Status = DeliveryOutcomeExhausted
+		}
+		// the attempt is counted even if its outcome cannot be stored
+		observeDelivery(event, duration)
+		if err = c.updateStatus(ctx, db, messageWithMerchantInfo,
+			bmodels.MessageColumns.Status,
+			bmodels.MessageColumns.NextDeliveryTime,
+			bmodels.MessageColumns.RetryCount, bmodels.MessageColumns.UpdatedAt); err == nil {
+			c.emit(ctx, event)
+		}
+		return err
 	}
 
 	messageWithMerchantInfo.Status = MessageDeliveryStatusSuccess
-	_, e := messageWithMerchantInfo.Update(ctx, db, boil.Whitelist(bmodels.MessageColumns.Status, bmodels.MessageColumns.UpdatedAt))
-	return e
+	event.Status = DeliveryOutcomeSuccess
+	observeDelivery(event, duration)
+	if err = c.updateStatus(ctx, db, messageWithMerchantInfo, bmodels.MessageColumns.Status, bmodels.MessageColumns.UpdatedAt); err == nil {
+		c.emit(ctx, event)
+	}
+	return err
+}
+
+func (c CallbackClient) transports() *TransportCache {
+	if c.Transports == nil {
+		return defaultTransports
+	}
+	return c.Transports
+}
+
+// updateStatus updates the whitelisted columns of the message
+func (c CallbackClient) updateStatus(ctx context.Context, db Inquirer, message *bmodels.Message, columns ...string) error {
+	ctx, span := trace.StartSpan(ctx, "message.status_update")
+	defer span.End()
+	span.SetAttribute("status", message.Status)
+
+	_, err := message.Update(ctx, db, boil.Whitelist(columns...))
+	span.RecordError(err)
+	return err
+}
+
+// emit sends the event to the configured sink
+func (c CallbackClient) emit(ctx context.Context, event DeliveryEvent) {
+	if c.Events == nil {
+		return
+	}
+	event.OccurredAt = time.Now()
+	c.Events.Emit(ctx, event)
 }
 
-func (c CallbackClient) doOneCallback(url, token, payload string) error {
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer([]byte(payload)))
+// doOneCallback sends the payload with the newest of the tokens, signed with all of them, and returns the HTTP
+// status code, which is 0 if no response is received
+func (c CallbackClient) doOneCallback(ctx context.Context, client *http.Client, auth authorizer, opts RequestOptions, url string, tokens []string, payload string) (int, error) {
+	req, err := opts.newRequest(ctx, url, tokens[0], payload)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	req.Header.Set(signatureHeaderKey, signature(tokens, time.Now(), payload))
+	setCorrelationHeaders(ctx, req.Header)
+	if auth != nil {
+		if err := auth.authorize(ctx, req); err != nil {
+			return 0, err
+		}
 	}
-	req.Header.Set(tokenHeaderKey, token)
-	req.Header.Set("Content-Type", "application/json")
-	resp, e := c.Client.Do(req)
+	resp, e := client.Do(req)
 	if e != nil {
-		return e
+		return 0, e
 	}
+	defer resp.Body.Close()
+	// the body is read so that the connection can be reused
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
 	if resp.StatusCode != http.StatusOK {
-		data, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
-			return err
+			return resp.StatusCode, err
 		}
-		resp.Body.Close()
-		return fmt.Errorf("callback error: %v, response: %v", resp.StatusCode, string(data))
+		// the merchant response may contain PII so only its size is logged
+		loglib.GetLogger(ctx).InfoF("callback response of %d bytes", len(data))
+		return resp.StatusCode, fmt.Errorf("callback error: %v", resp.StatusCode)
 	}
-	return nil
+	return resp.StatusCode, nil
 }
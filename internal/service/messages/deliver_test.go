@@ -11,12 +11,15 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/kagelui/notification/internal/models/bmodels"
+	"github.com/kagelui/notification/internal/pkg/trace"
 	"github.com/kagelui/notification/internal/testutil"
 	"github.com/volatiletech/sqlboiler/v4/boil"
 	"github.com/volatiletech/sqlboiler/v4/types"
 )
 
 func TestCallbackClient_doOneCallback(t *testing.T) {
+	sc := trace.NewSpanContext()
+	ctx := trace.NewContext(trace.WithRequestID(context.TODO(), "request0"), sc)
 	errorMsg := "mock error"
 	errorResp := &http.Response{
 		Status:        "500 Internal Error",
@@ -39,10 +42,11 @@ func TestCallbackClient_doOneCallback(t *testing.T) {
 		payload string
 	}
 	tests := []struct {
-		name    string
-		fields  fields
-		args    args
-		wantErr string
+		name     string
+		fields   fields
+		args     args
+		wantCode int
+		wantErr  string
 	}{
 		{
 			name: "fail",
@@ -64,7 +68,8 @@ func TestCallbackClient_doOneCallback(t *testing.T) {
 				token:   "some token",
 				payload: "{}",
 			},
-			wantErr: "callback error: 500, response: mock error",
+			wantCode: http.StatusInternalServerError,
+			wantErr:  "callback error: 500",
 		},
 		{
 			name: "success",
@@ -78,6 +83,11 @@ func TestCallbackClient_doOneCallback(t *testing.T) {
 						req.Header.Get(tokenHeaderKey) != "some token" || string(data) != "{}" {
 						return errorResp
 					}
+					testutil.Equals(t, "request0", req.Header.Get(trace.RequestIDHeader))
+					testutil.Asserts(t, strings.HasPrefix(req.Header.Get(signatureHeaderKey), "t="), "unsigned callback")
+					forwarded, err := trace.Parse(req.Header.Get(trace.TraceparentHeader))
+					testutil.Ok(t, err)
+					testutil.Equals(t, sc.TraceID, forwarded.TraceID)
 					return &http.Response{StatusCode: http.StatusOK}
 				}),
 			},
@@ -86,7 +96,8 @@ func TestCallbackClient_doOneCallback(t *testing.T) {
 				token:   "some token",
 				payload: "{}",
 			},
-			wantErr: "",
+			wantCode: http.StatusOK,
+			wantErr:  "",
 		},
 	}
 	for _, tt := range tests {
@@ -94,7 +105,9 @@ func TestCallbackClient_doOneCallback(t *testing.T) {
 			c := CallbackClient{
 				Client: tt.fields.Client,
 			}
-			testutil.CompareError(t, tt.wantErr, c.doOneCallback(tt.args.url, tt.args.token, tt.args.payload))
+			code, err := c.doOneCallback(ctx, c.Client, nil, RequestOptions{}, tt.args.url, []string{tt.args.token}, tt.args.payload)
+			testutil.CompareError(t, tt.wantErr, err)
+			testutil.Equals(t, tt.wantCode, code)
 		})
 	}
 }
@@ -214,6 +227,41 @@ func TestCallbackClient_DoCallback(t *testing.T) {
 			},
 			wantErr: "",
 		},
+		{
+			// the token sealed by a key missing from the keyring fails the attempt rather than leaving it pending
+			name:    "unknown token key",
+			respErr: true,
+			f: fixture{
+				merchant: bmodels.Merchant{
+					ID:         92137,
+					BusinessID: "merchant0",
+					Token:      "env:v1:sealed",
+					TokenKeyID: "2020-01",
+				},
+				url: bmodels.CallbackURL{
+					ID:          32916,
+					BusinessID:  "merchant0",
+					ProductID:   "va",
+					CallbackURL: "success_url",
+				},
+				message: bmodels.Message{
+					ID:               uuid.New().String(),
+					ProductID:        "va",
+					ProductType:      "something",
+					Payload:          payloadJSON,
+					MerchantID:       92137,
+					RetryCount:       0,
+					NextDeliveryTime: time.Now(),
+					Status:           MessageDeliveryStatusPending,
+				},
+			},
+			fields: fields{
+				Client: testutil.NewTestClient(func(req *http.Request) *http.Response {
+					return &http.Response{StatusCode: http.StatusOK}
+				}),
+			},
+			wantErr: "",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -226,20 +274,30 @@ func TestCallbackClient_DoCallback(t *testing.T) {
 			tt.f.message.R.Merchant = &tt.f.merchant
 			currRetryTime, currRetryCount := tt.f.message.NextDeliveryTime, tt.f.message.RetryCount
 
+			sink := &recordingEventSink{}
 			c := CallbackClient{
 				Client: tt.fields.Client,
+				Events: sink,
 			}
 			err := c.DoCallback(ctx, tx, &tt.f.message)
 			testutil.CompareError(t, tt.wantErr, err)
 
 			if err == nil {
 				testutil.Ok(t, tt.f.message.Reload(ctx, tx))
+				testutil.Equals(t, 1, len(sink.events))
+				testutil.Equals(t, tt.f.message.ID, sink.events[0].MessageID)
+				testutil.Equals(t, tt.f.merchant.BusinessID, sink.events[0].BusinessID)
+				testutil.Equals(t, currRetryCount+1, sink.events[0].Attempt)
 				if tt.respErr {
 					testutil.Equals(t, MessageDeliveryStatusFailed, tt.f.message.Status)
 					testutil.Equals(t, currRetryCount+1, tt.f.message.RetryCount)
 					testutil.CheckTimeApproximately(t, getRetryTime(currRetryTime, currRetryCount), tt.f.message.NextDeliveryTime)
+					testutil.Equals(t, DeliveryOutcomeFailed, sink.events[0].Status)
+					testutil.Equals(t, http.StatusInternalServerError, sink.events[0].HTTPCode)
 				} else {
 					testutil.Equals(t, MessageDeliveryStatusSuccess, tt.f.message.Status)
+					testutil.Equals(t, DeliveryOutcomeSuccess, sink.events[0].Status)
+					testutil.Equals(t, http.StatusOK, sink.events[0].HTTPCode)
 				}
 			}
 
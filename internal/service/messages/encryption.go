@@ -0,0 +1,273 @@
+package messages
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kagelui/notification/internal/models/bmodels"
+	"github.com/kagelui/notification/internal/pkg/secret"
+	"github.com/volatiletech/sqlboiler/v4/types"
+)
+
+// defaultRekeyBatchSize is the number of rows sealed again per transaction by Rekey
+const defaultRekeyBatchSize = 500
+
+// sealValue seals the value with the primary key of the keyring, values are stored in plaintext without keyring
+func sealValue(keys *secret.Keyring, value string) (sealed, keyID string, err error) {
+	if keys == nil {
+		return value, "", nil
+	}
+	keyID, sealed, err = keys.Seal(value)
+	return sealed, keyID, err
+}
+
+// openValue opens the value sealed by the key with the ID, the value is plaintext when the key ID is empty
+func openValue(keys *secret.Keyring, value, keyID string) (string, error) {
+	if keyID == "" {
+		return value, nil
+	}
+	return keys.Open(keyID, value)
+}
+
+// sealPayload seals the JSON payload, which is stored as a JSON string when sealed
+func sealPayload(keys *secret.Keyring, payload types.JSON) (types.JSON, string, error) {
+	sealed, keyID, err := sealValue(keys, payload.String())
+	if err != nil || keyID == "" {
+		return payload, keyID, err
+	}
+	sealedJSON := types.JSON{}
+	err = sealedJSON.Marshal(sealed)
+	return sealedJSON, keyID, err
+}
+
+// openPayload returns the JSON payload of the message
+func openPayload(keys *secret.Keyring, message *bmodels.Message) (string, error) {
+	return openPayloadValue(keys, message.Payload.String(), message.PayloadKeyID)
+}
+
+func openPayloadValue(keys *secret.Keyring, payload, keyID string) (string, error) {
+	if keyID == "" {
+		return payload, nil
+	}
+	var sealed string
+	if err := json.Unmarshal([]byte(payload), &sealed); err != nil {
+		return "", fmt.Errorf("sealed payload: %v", err)
+	}
+	return openValue(keys, sealed, keyID)
+}
+
+// RekeyOptions configures Rekey
+type RekeyOptions struct {
+	// BatchSize is the number of rows sealed again per transaction, 500 when zero
+	BatchSize int
+	// DryRun opens the values without storing them again
+	DryRun bool
+	// Decrypt stores the values in plaintext instead of sealing them with the primary key, the auth settings of the
+	// callback URLs are sealed with Secrets instead
+	Decrypt bool
+	// Secrets opens the auth settings sealed by SECRETS_KEY before the keyring, it may be nil
+	Secrets *secret.Box
+}
+
+// RekeyReport counts the values sealed again by Rekey, per table
+type RekeyReport struct {
+	Merchants      int `json:"merchants"`
+	MerchantTokens int `json:"merchant_tokens"`
+	Messages       int `json:"messages"`
+	CallbackURLs   int `json:"callback_urls"`
+}
+
+// sealedColumn is a column stored sealed, with the key ID in another column of the row
+type sealedColumn struct {
+	table     string
+	column    string
+	keyColumn string
+	// cursor is the primary key the rows are paged by
+	cursor []cursorColumn
+	// payload columns are JSONB, their sealed values are stored as JSON strings
+	payload bool
+	// auth columns are never stored in plaintext, their values without key ID are sealed by SECRETS_KEY
+	auth bool
+}
+
+// cursorColumn is a column of the primary key of a table, the values of the cursor are scanned as text and cast back
+// to the type of the column
+type cursorColumn struct {
+	name string
+	typ  string
+}
+
+var (
+	idCursor = []cursorColumn{{name: "id", typ: "integer"}}
+	// the messages are partitioned by created_at, which comes first so that the pages are read partition by partition
+	messageCursor = []cursorColumn{{name: "created_at", typ: "timestamptz"}, {name: "id", typ: "uuid"}}
+)
+
+var sealedColumns = []sealedColumn{
+	{table: "merchants", column: "token", keyColumn: "token_key_id", cursor: idCursor},
+	{table: "merchant_tokens", column: "token", keyColumn: "key_id", cursor: idCursor},
+	{table: "messages", column: "payload", keyColumn: "payload_key_id", cursor: messageCursor, payload: true},
+	{table: "callback_urls", column: "auth_config", keyColumn: "auth_config_key_id", cursor: idCursor, auth: true},
+}
+
+// cursorColumns lists the cursor columns, cast to text when scanned
+func (c sealedColumn) cursorColumns(cast bool) string {
+	columns := make([]string, len(c.cursor))
+	for i, col := range c.cursor {
+		columns[i] = col.name
+		if cast {
+			columns[i] += "::text"
+		}
+	}
+	return strings.Join(columns, ", ")
+}
+
+// cursorParams lists the parameters of the cursor from $first, cast to the types of the cursor columns
+func (c sealedColumn) cursorParams(first int) string {
+	params := make([]string, len(c.cursor))
+	for i, col := range c.cursor {
+		params[i] = fmt.Sprintf("$%d::%s", first+i, col.typ)
+	}
+	return strings.Join(params, ", ")
+}
+
+// selectQuery pages through the rows by primary key, as the rows sealed again in a dry run keep their key.
+// The first page has no cursor
+func (c sealedColumn) selectQuery(first bool) string {
+	after := ""
+	if !first {
+		after = fmt.Sprintf(" AND (%s) > (%s)", c.cursorColumns(false), c.cursorParams(3))
+	}
+	return fmt.Sprintf(`SELECT %s, %s::text, %s FROM %s WHERE %s <> $1 AND %s::text <> ''%s ORDER BY %s LIMIT $2`,
+		c.cursorColumns(true), c.column, c.keyColumn, c.table, c.keyColumn, c.column, after, c.cursorColumns(false))
+}
+
+// updateQuery leaves the rows sealed again concurrently alone
+func (c sealedColumn) updateQuery() string {
+	value := "$1"
+	if c.payload {
+		value = "$1::jsonb"
+	}
+	return fmt.Sprintf(`UPDATE %s SET %s = %s, %s = $2 WHERE %s = $3 AND (%s) = (%s)`,
+		c.table, c.column, value, c.keyColumn, c.keyColumn, c.cursorColumns(false), c.cursorParams(4))
+}
+
+func (c sealedColumn) open(keys *secret.Keyring, opts RekeyOptions, value, keyID string) (string, error) {
+	switch {
+	case c.payload:
+		return openPayloadValue(keys, value, keyID)
+	case c.auth:
+		return openAuthConfig(keys, opts.Secrets, value, keyID)
+	}
+	return openValue(keys, value, keyID)
+}
+
+func (c sealedColumn) seal(target *secret.Keyring, opts RekeyOptions, value string) (string, string, error) {
+	switch {
+	case c.payload:
+		sealed, keyID, err := sealPayload(target, types.JSON(value))
+		return sealed.String(), keyID, err
+	case c.auth && target == nil:
+		sealed, err := opts.Secrets.Seal(value)
+		return sealed, "", err
+	}
+	return sealValue(target, value)
+}
+
+// Rekey seals the merchant tokens, the payloads of the messages and the auth settings of the callback URLs which are
+// not sealed by the primary key of the keyring, e.g. the rows stored before the keyring was configured or sealed by
+// a retired key
+func Rekey(ctx context.Context, db Inquirer, keys *secret.Keyring, opts RekeyOptions) (RekeyReport, error) {
+	var report RekeyReport
+	if keys == nil {
+		return report, secret.ErrNoKey
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultRekeyBatchSize
+	}
+	target := keys
+	if opts.Decrypt {
+		target = nil
+	}
+	counts := []*int{&report.Merchants, &report.MerchantTokens, &report.Messages, &report.CallbackURLs}
+	for i, c := range sealedColumns {
+		n, err := rekeyColumn(ctx, db, keys, target, c, opts)
+		*counts[i] = n
+		if err != nil {
+			return report, fmt.Errorf("rekeying %s.%s: %v", c.table, c.column, err)
+		}
+	}
+	return report, nil
+}
+
+// rekeyColumn opens the values of the column with keys and seals them with target, one batch per transaction
+func rekeyColumn(ctx context.Context, db Inquirer, keys, target *secret.Keyring, c sealedColumn, opts RekeyOptions) (int, error) {
+	type row struct {
+		cursor       []string
+		value, keyID string
+	}
+	total := 0
+	var cursor []string
+	for {
+		var batch []row
+		err := withTx(ctx, db, func(tx Inquirer) error {
+			args := []interface{}{target.Primary(), opts.BatchSize}
+			for _, v := range cursor {
+				args = append(args, v)
+			}
+			rows, err := tx.QueryContext(ctx, c.selectQuery(cursor == nil), args...)
+			if err != nil {
+				return err
+			}
+			for rows.Next() {
+				r := row{cursor: make([]string, len(c.cursor))}
+				dest := make([]interface{}, 0, len(c.cursor)+2)
+				for i := range r.cursor {
+					dest = append(dest, &r.cursor[i])
+				}
+				if err := rows.Scan(append(dest, &r.value, &r.keyID)...); err != nil {
+					rows.Close()
+					return err
+				}
+				batch = append(batch, r)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+
+			for _, r := range batch {
+				id := strings.Join(r.cursor, " ")
+				plaintext, err := c.open(keys, opts, r.value, r.keyID)
+				if err != nil {
+					return fmt.Errorf("row %s: %v", id, err)
+				}
+				if opts.DryRun {
+					continue
+				}
+				sealed, keyID, err := c.seal(target, opts, plaintext)
+				if err != nil {
+					return fmt.Errorf("row %s: %v", id, err)
+				}
+				args := []interface{}{sealed, keyID, r.keyID}
+				for _, v := range r.cursor {
+					args = append(args, v)
+				}
+				if _, err = tx.ExecContext(ctx, c.updateQuery(), args...); err != nil {
+					return fmt.Errorf("row %s: %v", id, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return total, err
+		}
+		total += len(batch)
+		if len(batch) < opts.BatchSize {
+			return total, nil
+		}
+		cursor = batch[len(batch)-1].cursor
+	}
+}
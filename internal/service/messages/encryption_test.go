@@ -0,0 +1,143 @@
+package messages
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kagelui/notification/internal/models/bmodels"
+	"github.com/kagelui/notification/internal/pkg/secret"
+	"github.com/kagelui/notification/internal/testutil"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/types"
+)
+
+func testKeyring(t *testing.T, ids ...string) *secret.Keyring {
+	keys := make([]secret.Key, 0, len(ids))
+	for i, id := range ids {
+		keys = append(keys, secret.Key{ID: id, Key: bytes.Repeat([]byte{byte(i + 1)}, secret.KeySize)})
+	}
+	keyring, err := secret.NewKeyring(keys...)
+	testutil.Ok(t, err)
+	return keyring
+}
+
+func TestSealPayload(t *testing.T) {
+	payload := types.JSON{}
+	testutil.Ok(t, payload.Marshal(`{"account_number":"12345678"}`))
+	tests := []struct {
+		name      string
+		keys      *secret.Keyring
+		wantKeyID string
+	}{
+		{name: "plaintext", keys: nil},
+		{name: "sealed", keys: testKeyring(t, "2021-05"), wantKeyID: "2021-05"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed, keyID, err := sealPayload(tt.keys, payload)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tt.wantKeyID, keyID)
+			testutil.Asserts(t, keyID == "" || !strings.Contains(sealed.String(), "12345678"), "payload should be sealed")
+
+			opened, err := openPayload(tt.keys, &bmodels.Message{Payload: sealed, PayloadKeyID: keyID})
+			testutil.Ok(t, err)
+			testutil.Equals(t, payload.String(), opened)
+		})
+	}
+
+	_, err := openPayload(nil, &bmodels.Message{Payload: payload, PayloadKeyID: "2021-05"})
+	testutil.CompareError(t, secret.ErrNoKey.Error(), err)
+}
+
+func TestRekey(t *testing.T) {
+	ctx := context.TODO()
+	tx := db.MustBegin()
+	defer tx.Rollback()
+
+	merchant := bmodels.Merchant{ID: 92139, BusinessID: "merchant2", Token: "some token"}
+	testutil.Ok(t, merchant.Insert(ctx, tx, boil.Infer()))
+	store := ModelStore{DB: tx}
+	_, err := store.RotateToken(ctx, "merchant2", TokenRotation{Token: "some token"})
+	testutil.Ok(t, err)
+	message, _, err := insertCallback(ctx, tx, nil, "va", "something", `{"account_number":"12345678"}`, "merchant2", "")
+	testutil.Ok(t, err)
+	// auth settings sealed by SECRETS_KEY before the keyring
+	box := newTestBox(t)
+	legacy, err := box.Seal(`{"header":"X-Api-Key","value":"abc"}`)
+	testutil.Ok(t, err)
+	url := bmodels.CallbackURL{ID: 92139, BusinessID: "merchant2", ProductID: "va", CallbackURL: "https://merchant2",
+		AuthType: AuthTypeStatic, AuthConfig: legacy}
+	testutil.Ok(t, url.Insert(ctx, tx, boil.Infer()))
+
+	_, err = Rekey(ctx, tx, nil, RekeyOptions{})
+	testutil.CompareError(t, secret.ErrNoKey.Error(), err)
+
+	old := testKeyring(t, "2021-01")
+	_, err = Rekey(ctx, tx, old, RekeyOptions{DryRun: true})
+	testutil.CompareError(t, "rekeying callback_urls.auth_config", err)
+	report, err := Rekey(ctx, tx, old, RekeyOptions{DryRun: true, BatchSize: 1, Secrets: box})
+	testutil.Ok(t, err)
+	testutil.Asserts(t, report.Merchants >= 1 && report.MerchantTokens >= 1 && report.Messages >= 1 && report.CallbackURLs >= 1,
+		"dry run should count the rows: %+v", report)
+	testutil.Ok(t, message.Reload(ctx, tx))
+	testutil.Equals(t, "", message.PayloadKeyID)
+
+	_, err = Rekey(ctx, tx, old, RekeyOptions{BatchSize: 1, Secrets: box})
+	testutil.Ok(t, err)
+	// the keys rotate, the rows sealed by the retired key are sealed again
+	rotated := testKeyring(t, "2021-05", "2021-01")
+	_, err = Rekey(ctx, tx, rotated, RekeyOptions{})
+	testutil.Ok(t, err)
+
+	testutil.Ok(t, merchant.Reload(ctx, tx))
+	testutil.Ok(t, message.Reload(ctx, tx))
+	testutil.Ok(t, url.Reload(ctx, tx))
+	testutil.Equals(t, "2021-05", merchant.TokenKeyID)
+	testutil.Equals(t, "2021-05", message.PayloadKeyID)
+	testutil.Equals(t, "2021-05", url.AuthConfigKeyID)
+	auth, err := NewAuthenticators(rotated, nil, nil).authorizer(&url)
+	testutil.Ok(t, err)
+	testutil.Asserts(t, auth == staticAuth{header: "X-Api-Key", value: "abc"}, "unexpected authorizer: %+v", auth)
+	testutil.Asserts(t, !strings.Contains(message.Payload.String(), "12345678"), "payload should be sealed")
+
+	tokens, err := activeTokens(ctx, tx, rotated, &merchant, time.Now())
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"some token"}, tokens)
+	payload, err := openPayload(rotated, message)
+	testutil.Ok(t, err)
+	testutil.Equals(t, `"{\"account_number\":\"12345678\"}"`, payload)
+	_, err = openPayload(old, message)
+	testutil.CompareError(t, `unknown keyring key "2021-05"`, err)
+
+	// the auth settings are sealed by SECRETS_KEY again rather than stored in plaintext
+	report, err = Rekey(ctx, tx, rotated, RekeyOptions{Decrypt: true, Secrets: box})
+	testutil.Ok(t, err)
+	testutil.Asserts(t, report.Merchants >= 1 && report.MerchantTokens >= 1 && report.Messages >= 1 && report.CallbackURLs >= 1,
+		"rows should be decrypted: %+v", report)
+	testutil.Ok(t, merchant.Reload(ctx, tx))
+	testutil.Equals(t, "some token", merchant.Token)
+	testutil.Equals(t, "", merchant.TokenKeyID)
+	testutil.Ok(t, url.Reload(ctx, tx))
+	testutil.Equals(t, "", url.AuthConfigKeyID)
+	plaintext, err := box.Open(url.AuthConfig)
+	testutil.Ok(t, err)
+	testutil.Equals(t, `{"header":"X-Api-Key","value":"abc"}`, plaintext)
+}
+
+func TestSealedColumn_queries(t *testing.T) {
+	messages := sealedColumns[2]
+	testutil.Equals(t, `SELECT created_at::text, id::text, payload::text, payload_key_id FROM messages `+
+		`WHERE payload_key_id <> $1 AND payload::text <> '' ORDER BY created_at, id LIMIT $2`, messages.selectQuery(true))
+	testutil.Equals(t, `SELECT created_at::text, id::text, payload::text, payload_key_id FROM messages `+
+		`WHERE payload_key_id <> $1 AND payload::text <> '' AND (created_at, id) > ($3::timestamptz, $4::uuid) `+
+		`ORDER BY created_at, id LIMIT $2`, messages.selectQuery(false))
+	testutil.Equals(t, `UPDATE messages SET payload = $1::jsonb, payload_key_id = $2 `+
+		`WHERE payload_key_id = $3 AND (created_at, id) = ($4::timestamptz, $5::uuid)`, messages.updateQuery())
+
+	merchants := sealedColumns[0]
+	testutil.Equals(t, `SELECT id::text, token::text, token_key_id FROM merchants `+
+		`WHERE token_key_id <> $1 AND token::text <> '' AND (id) > ($3::integer) ORDER BY id LIMIT $2`, merchants.selectQuery(false))
+}
@@ -8,3 +8,27 @@ import (
 
 // ErrMerchantInfoNotLoaded occurs when the merchant relation is not loaded
 var ErrMerchantInfoNotLoaded = web.Error{Status: http.StatusInternalServerError, Code: "info_not_loaded", Desc: "merchant_info_empty"}
+
+// ErrUnknownMerchant occurs when no merchant has the business ID of the callback
+var ErrUnknownMerchant = &web.Error{
+	Status: http.StatusUnprocessableEntity,
+	Code:   "unknown_merchant",
+	Desc:   "no merchant is registered with the business ID",
+	Title:  "Unknown merchant",
+}
+
+// ErrUnknownCallbackURL occurs when no callback URL has the ID
+var ErrUnknownCallbackURL = &web.Error{
+	Status: http.StatusNotFound,
+	Code:   "unknown_callback_url",
+	Desc:   "no callback URL is registered with the ID",
+	Title:  "Unknown callback URL",
+}
+
+// ErrNoActiveToken occurs when finishing the token rotation of a merchant without any active token
+var ErrNoActiveToken = &web.Error{
+	Status: http.StatusConflict,
+	Code:   "no_active_token",
+	Desc:   "the merchant has no active token",
+	Title:  "No active token",
+}
@@ -0,0 +1,103 @@
+package messages
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/kagelui/notification/internal/pkg/loglib"
+	jobqueue2 "github.com/kagelui/notification/internal/pkg/queue"
+)
+
+// DeliveryOutcome constants
+const (
+	DeliveryOutcomeSuccess   = "SUCCESS"
+	DeliveryOutcomeFailed    = "FAILED"
+	DeliveryOutcomeExhausted = "EXHAUSTED"
+)
+
+// eventPublishRetry is the number of retries when publishing one event
+const eventPublishRetry = 3
+
+// DeliveryEvent describes the outcome of one callback attempt
+type DeliveryEvent struct {
+	MessageID  string    `json:"message_id"`
+	BusinessID string    `json:"business_id"`
+	ProductID  string    `json:"product_id"`
+	Attempt    int       `json:"attempt"`
+	Status     string    `json:"status"`
+	HTTPCode   int       `json:"http_code"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// EventSink receives delivery outcome events, implementations must neither block nor fail the delivery
+type EventSink interface {
+	Emit(ctx context.Context, event DeliveryEvent)
+}
+
+// NopEventSink discards all events
+type NopEventSink struct{}
+
+// Emit implements EventSink
+func (NopEventSink) Emit(context.Context, DeliveryEvent) {}
+
+// QueueEventSink publishes events through a jobqueue2.Publisher in the background.
+// Events are dropped when the buffer is full so that deliveries are never held up by the message bus
+type QueueEventSink struct {
+	publisher jobqueue2.Publisher
+	events    chan DeliveryEvent
+	logger    *loglib.Logger
+	mu        sync.RWMutex
+	stopped   bool
+	wg        sync.WaitGroup
+}
+
+// NewQueueEventSink starts publishing the emitted events with the publisher, buffering up to bufferSize events
+func NewQueueEventSink(ctx context.Context, publisher jobqueue2.Publisher, bufferSize int) *QueueEventSink {
+	s := &QueueEventSink{
+		publisher: publisher,
+		events:    make(chan DeliveryEvent, bufferSize),
+		logger:    loglib.GetLogger(ctx),
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for event := range s.events {
+			b := backoff.WithMaxRetries(backoff.NewExponentialBackOff(), eventPublishRetry)
+			if err := s.publisher.Publish(ctx, event, b); err != nil {
+				s.logger.ErrorF("error publishing delivery event for %v: %v", event.MessageID, err.Error())
+			}
+		}
+	}()
+	return s
+}
+
+// Emit implements EventSink
+func (s *QueueEventSink) Emit(_ context.Context, event DeliveryEvent) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.stopped {
+		return
+	}
+
+	select {
+	case s.events <- event:
+	default:
+		s.logger.WarnF("delivery event buffer full, dropping %v event for %v", event.Status, event.MessageID)
+	}
+}
+
+// Stop publishes the buffered events then stops the publisher, later events are discarded
+func (s *QueueEventSink) Stop() {
+	s.mu.Lock()
+	if !s.stopped {
+		s.stopped = true
+		close(s.events)
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	s.publisher.Stop()
+}
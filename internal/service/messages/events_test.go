@@ -0,0 +1,53 @@
+package messages
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+type recordingEventSink struct {
+	events []DeliveryEvent
+}
+
+func (s *recordingEventSink) Emit(_ context.Context, event DeliveryEvent) {
+	s.events = append(s.events, event)
+}
+
+type mockPublisher struct {
+	mu      sync.Mutex
+	jobs    []interface{}
+	stopped bool
+}
+
+func (p *mockPublisher) Publish(_ context.Context, job interface{}, _ backoff.BackOff) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.jobs = append(p.jobs, job)
+	return nil
+}
+
+func (p *mockPublisher) Stop() {
+	p.stopped = true
+}
+
+func TestQueueEventSink(t *testing.T) {
+	ctx := context.TODO()
+	publisher := &mockPublisher{}
+	sink := NewQueueEventSink(ctx, publisher, 10)
+
+	sink.Emit(ctx, DeliveryEvent{MessageID: "one", Status: DeliveryOutcomeSuccess})
+	sink.Emit(ctx, DeliveryEvent{MessageID: "two", Status: DeliveryOutcomeExhausted})
+	sink.Stop()
+	// emitting after stop should be ignored instead of panicking
+	sink.Emit(ctx, DeliveryEvent{MessageID: "three", Status: DeliveryOutcomeFailed})
+
+	testutil.Asserts(t, publisher.stopped, "publisher should be stopped")
+	testutil.Equals(t, []interface{}{
+		DeliveryEvent{MessageID: "one", Status: DeliveryOutcomeSuccess},
+		DeliveryEvent{MessageID: "two", Status: DeliveryOutcomeExhausted},
+	}, publisher.jobs)
+}
@@ -0,0 +1,43 @@
+package messages
+
+import (
+	"strings"
+
+	"github.com/kagelui/notification/internal/pkg/metrics"
+)
+
+var (
+	messagesIngested = metrics.NewCounterVec("notification_messages_ingested_total",
+		"Callback requests stored for delivery.", "business_id", "product_id")
+	deliveries = metrics.NewCounterVec("notification_deliveries_total",
+		"Callback attempts by outcome.", "business_id", "product_id", "outcome")
+	deliveryRetries = metrics.NewCounterVec("notification_delivery_retries_total",
+		"Callback attempts other than the first one.", "business_id", "product_id")
+	callbackDuration = metrics.NewHistogramVec("notification_callback_duration_seconds",
+		"Duration of the HTTP callback to the merchant.", metrics.DefBuckets, "business_id", "product_id", "outcome")
+	deliveriesInFlight = metrics.NewGaugeVec("notification_deliveries_in_flight",
+		"Callbacks being performed.")
+	messagesPurged = metrics.NewCounterVec("notification_messages_purged_total",
+		"Delivered messages deleted past their retention.")
+	// RetryBacklog is set by the retry job to the number of due messages
+	RetryBacklog = metrics.NewGaugeVec("notification_retry_backlog",
+		"Failed messages due for retry.")
+)
+
+func init() {
+	metrics.MustRegister(messagesIngested, deliveries, deliveryRetries, callbackDuration, deliveriesInFlight, messagesPurged, RetryBacklog)
+}
+
+// DeliveriesInFlight returns the number of callbacks being performed by this process
+func DeliveriesInFlight() int {
+	return int(deliveriesInFlight.Value())
+}
+
+func observeDelivery(event DeliveryEvent, seconds float64) {
+	businessID, outcome := metrics.BusinessIDLabel(event.BusinessID), strings.ToLower(event.Status)
+	deliveries.Inc(businessID, event.ProductID, outcome)
+	callbackDuration.Observe(seconds, businessID, event.ProductID, outcome)
+	if event.Attempt > 1 {
+		deliveryRetries.Inc(businessID, event.ProductID)
+	}
+}
@@ -0,0 +1,86 @@
+package messages
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/kagelui/notification/internal/pkg/loglib"
+	"github.com/kagelui/notification/internal/pkg/wakeup"
+	"github.com/lib/pq"
+)
+
+// retryNotifyChannel is notified by the messages_notify_retry trigger when a failed message is due at a new time
+const retryNotifyChannel = "message_retry"
+
+// listenerPingInterval detects the dead connections of the listener, which reconnects
+const listenerPingInterval = 90 * time.Second
+
+// nextRetryWindow bounds the due times scheduled from the database, the later ones are covered by the polling
+const nextRetryWindow = 7 * 24 * time.Hour
+
+const nextRetryQuery = `SELECT min(next_delivery_time) FROM messages WHERE ` + dueCondition
+
+// retryNotification is the payload of the notifications of retryNotifyChannel
+type retryNotification struct {
+	ID               string    `json:"id"`
+	NextDeliveryTime time.Time `json:"next_delivery_time"`
+}
+
+// parseRetryNotification returns the due time of the message notified
+func parseRetryNotification(payload string) (time.Time, error) {
+	var notification retryNotification
+	if err := json.Unmarshal([]byte(payload), &notification); err != nil {
+		return time.Time{}, err
+	}
+	if notification.NextDeliveryTime.IsZero() {
+		return time.Time{}, errors.New("missing next_delivery_time")
+	}
+	return notification.NextDeliveryTime, nil
+}
+
+// NextRetryTime returns the earliest due time of the failed messages, ok is false when no message is to be retried
+func NextRetryTime(ctx context.Context, db Inquirer) (next time.Time, ok bool, err error) {
+	now := time.Now()
+	var due pq.NullTime
+	err = db.QueryRowContext(ctx, nextRetryQuery, MessageDeliveryStatusFailed, maxRetry, now.Add(nextRetryWindow)).Scan(&due)
+	return due.Time, due.Valid, err
+}
+
+// ListenRetries schedules the due times of the failed messages notified by the database until the context is done.
+// An immediate wake-up is scheduled on reconnection, as the notifications sent meanwhile are lost
+func ListenRetries(ctx context.Context, dsn string, scheduler *wakeup.Scheduler) error {
+	lg := loglib.GetLogger(ctx)
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			lg.WarnF("retry listener: %v", err.Error())
+		}
+	})
+	defer listener.Close()
+	if err := listener.Listen(retryNotifyChannel); err != nil {
+		return err
+	}
+
+	ping := time.NewTicker(listenerPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			if n == nil {
+				scheduler.Schedule(time.Now())
+				continue
+			}
+			due, err := parseRetryNotification(n.Extra)
+			if err != nil {
+				lg.WarnF("invalid retry notification %q: %v", n.Extra, err.Error())
+				continue
+			}
+			scheduler.Schedule(due)
+		case <-ping.C:
+			go listener.Ping()
+		}
+	}
+}
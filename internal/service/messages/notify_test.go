@@ -0,0 +1,45 @@
+package messages
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+func Test_parseRetryNotification(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			name:    "notification of the trigger",
+			payload: `{"id" : "1b9d6bcd-bbfd-4b2d-9b5d-ab8dfbbd4bed", "next_delivery_time" : "2021-05-01T10:15:30.123456+00:00"}`,
+			want:    time.Date(2021, 5, 1, 10, 15, 30, 123456000, time.UTC),
+		},
+		{
+			name:    "offset",
+			payload: `{"id" : "1b9d6bcd-bbfd-4b2d-9b5d-ab8dfbbd4bed", "next_delivery_time" : "2021-05-01T18:15:30+08:00"}`,
+			want:    time.Date(2021, 5, 1, 10, 15, 30, 0, time.UTC),
+		},
+		{
+			name:    "missing due time",
+			payload: `{"id" : "1b9d6bcd-bbfd-4b2d-9b5d-ab8dfbbd4bed"}`,
+			wantErr: true,
+		},
+		{
+			name:    "not JSON",
+			payload: `1b9d6bcd-bbfd-4b2d-9b5d-ab8dfbbd4bed`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRetryNotification(tt.payload)
+			testutil.Equals(t, tt.wantErr, err != nil)
+			testutil.Asserts(t, got.Equal(tt.want), "got %v, want %v", got, tt.want)
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package messages
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/kagelui/notification/internal/models/bmodels"
+	"github.com/kagelui/notification/internal/pkg/trace"
+	"github.com/kagelui/notification/internal/pkg/web"
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/types"
+)
+
+// maxCallbackTimeout bounds the timeout of a callback URL, longer ones would hold the runners of hermes
+const maxCallbackTimeout = 2 * time.Minute
+
+// headerNamePattern matches the valid header field names of RFC 7230
+var headerNamePattern = regexp.MustCompile("^[!#$%&'*+\\-.^_`|~0-9A-Za-z]+$")
+
+// validHeaderValue tells if the header value is accepted by the transport, which rejects the control characters
+// but the tab, as golang.org/x/net/http/httpguts.ValidHeaderFieldValue does
+func validHeaderValue(v string) bool {
+	for i := 0; i < len(v); i++ {
+		if b := v[i]; (b < ' ' && b != '\t') || b == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// reservedHeaders are set by the HTTP client, the body encoding or the callback protocol and cannot be configured
+var reservedHeaders = map[string]bool{
+	"Host":                                  true,
+	"Content-Length":                        true,
+	"Content-Encoding":                      true,
+	"Transfer-Encoding":                     true,
+	"Connection":                            true,
+	"Content-Type":                          true,
+	http.CanonicalHeaderKey(tokenHeaderKey): true,
+	http.CanonicalHeaderKey(signatureHeaderKey):      true,
+	http.CanonicalHeaderKey(trace.RequestIDHeader):   true,
+	http.CanonicalHeaderKey(trace.TraceparentHeader): true,
+}
+
+// RequestOptions are the options of the callback requests to a callback URL
+type RequestOptions struct {
+	// Headers are added to the callback requests, they cannot set the reserved headers nor the token header
+	Headers map[string]string
+	// TokenHeader carries the merchant token, x-callback-token when empty
+	TokenHeader string
+	// Method is POST or PUT, POST when empty
+	Method string
+	// Timeout overrides the timeout of the callback client when set
+	Timeout time.Duration
+	// Gzip compresses the body of the callback requests
+	Gzip bool
+}
+
+// callbackOptions returns the request options of the callback URL
+func callbackOptions(url *bmodels.CallbackURL) (RequestOptions, error) {
+	opts := RequestOptions{
+		TokenHeader: url.TokenHeader,
+		Method:      url.Method,
+		Timeout:     time.Duration(url.TimeoutMS) * time.Millisecond,
+		Gzip:        url.Gzip,
+	}
+	if len(url.Headers) > 0 {
+		if err := url.Headers.Unmarshal(&opts.Headers); err != nil {
+			return opts, fmt.Errorf("headers of callback URL %d: %v", url.ID, err)
+		}
+	}
+	return opts, nil
+}
+
+// Validate returns the invalid options
+func (o RequestOptions) Validate() []web.FieldError {
+	var fieldErrors []web.FieldError
+	names := make([]string, 0, len(o.Headers))
+	for name := range o.Headers {
+		names = append(names, name)
+	}
+	// sorted so that the errors are stable
+	sort.Strings(names)
+	for _, name := range names {
+		if !headerNamePattern.MatchString(name) {
+			fieldErrors = append(fieldErrors, web.FieldError{Field: "headers." + name, Code: "invalid_header", Message: fmt.Sprintf("%q is not a valid header name", name)})
+		} else if reservedHeaders[http.CanonicalHeaderKey(name)] || http.CanonicalHeaderKey(name) == http.CanonicalHeaderKey(o.TokenHeader) {
+			fieldErrors = append(fieldErrors, web.FieldError{Field: "headers." + name, Code: "reserved_header", Message: fmt.Sprintf("header %s cannot be set", name)})
+		} else if !validHeaderValue(o.Headers[name]) {
+			fieldErrors = append(fieldErrors, web.FieldError{Field: "headers." + name, Code: "invalid_header_value", Message: fmt.Sprintf("value of header %s contains control characters", name)})
+		}
+	}
+	tokenHeader := http.CanonicalHeaderKey(o.TokenHeader)
+	switch {
+	case o.TokenHeader == "":
+	case !headerNamePattern.MatchString(o.TokenHeader):
+		fieldErrors = append(fieldErrors, web.FieldError{Field: "token_header", Code: "invalid_header", Message: fmt.Sprintf("%q is not a valid header name", o.TokenHeader)})
+	case reservedHeaders[tokenHeader] && tokenHeader != http.CanonicalHeaderKey(tokenHeaderKey):
+		fieldErrors = append(fieldErrors, web.FieldError{Field: "token_header", Code: "reserved_header", Message: fmt.Sprintf("header %s cannot carry the token", o.TokenHeader)})
+	}
+	if o.Method != "" && o.Method != http.MethodPost && o.Method != http.MethodPut {
+		fieldErrors = append(fieldErrors, web.FieldError{Field: "method", Code: "invalid_method", Message: "method must be POST or PUT"})
+	}
+	if o.Timeout < 0 || o.Timeout > maxCallbackTimeout {
+		fieldErrors = append(fieldErrors, web.FieldError{Field: "timeout", Code: "invalid_timeout", Message: fmt.Sprintf("timeout must be between 0 and %s", maxCallbackTimeout)})
+	}
+	return fieldErrors
+}
+
+// client returns the client with the timeout of the options, if any
+func (o RequestOptions) client(base *http.Client) *http.Client {
+	if o.Timeout <= 0 || o.Timeout == base.Timeout {
+		return base
+	}
+	client := *base
+	client.Timeout = o.Timeout
+	return &client
+}
+
+// newRequest builds the callback request carrying the payload and the merchant token
+func (o RequestOptions) newRequest(ctx context.Context, url, token, payload string) (*http.Request, error) {
+	method := o.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	body := []byte(payload)
+	if o.Gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		body = buf.Bytes()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	// the protocol headers are set last, so that headers stored before they were reserved cannot override them
+	for name, value := range o.Headers {
+		req.Header.Set(name, value)
+	}
+	tokenHeader := o.TokenHeader
+	if tokenHeader == "" {
+		tokenHeader = tokenHeaderKey
+	}
+	req.Header.Set(tokenHeader, token)
+	req.Header.Set("Content-Type", "application/json")
+	if o.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	return req, nil
+}
+
+// SetCallbackOptions validates and stores the request options of the callback URL
+func (m ModelStore) SetCallbackOptions(ctx context.Context, callbackURLID int, opts RequestOptions) error {
+	if fieldErrors := opts.Validate(); len(fieldErrors) > 0 {
+		return web.NewValidationError(fieldErrors)
+	}
+	url, err := bmodels.FindCallbackURL(ctx, m.DB, callbackURLID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUnknownCallbackURL
+	}
+	if err != nil {
+		return err
+	}
+
+	headers := opts.Headers
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	data, err := json.Marshal(headers)
+	if err != nil {
+		return err
+	}
+	url.Headers = types.JSON(data)
+	url.TokenHeader = opts.TokenHeader
+	url.Method = opts.Method
+	if url.Method == "" {
+		url.Method = http.MethodPost
+	}
+	url.TimeoutMS = int(opts.Timeout / time.Millisecond)
+	url.Gzip = opts.Gzip
+	_, err = url.Update(ctx, m.DB, boil.Whitelist(
+		bmodels.CallbackURLColumns.Headers,
+		bmodels.CallbackURLColumns.TokenHeader,
+		bmodels.CallbackURLColumns.Method,
+		bmodels.CallbackURLColumns.TimeoutMS,
+		bmodels.CallbackURLColumns.Gzip,
+		bmodels.CallbackURLColumns.UpdatedAt,
+	))
+	return err
+}
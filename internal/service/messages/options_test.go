@@ -0,0 +1,183 @@
+package messages
+
+import (
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kagelui/notification/internal/models/bmodels"
+	"github.com/kagelui/notification/internal/pkg/web"
+	"github.com/kagelui/notification/internal/testutil"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/types"
+)
+
+func TestRequestOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		opts RequestOptions
+		want []web.FieldError
+	}{
+		{name: "defaults", opts: RequestOptions{}},
+		{
+			name: "valid",
+			opts: RequestOptions{Headers: map[string]string{"X-Gateway-Key": "abc"}, TokenHeader: "X-Token", Method: http.MethodPut, Timeout: time.Minute, Gzip: true},
+		},
+		{
+			name: "invalid header",
+			opts: RequestOptions{Headers: map[string]string{"X Gateway": "abc"}},
+			want: []web.FieldError{{Field: "headers.X Gateway", Code: "invalid_header", Message: `"X Gateway" is not a valid header name`}},
+		},
+		{
+			name: "reserved header",
+			opts: RequestOptions{Headers: map[string]string{"content-length": "1"}},
+			want: []web.FieldError{{Field: "headers.content-length", Code: "reserved_header", Message: "header content-length cannot be set"}},
+		},
+		{
+			name: "protocol headers",
+			opts: RequestOptions{Headers: map[string]string{"content-type": "text/plain", "X-Callback-Signature": "forged", "X-Token": "abc"}, TokenHeader: "X-Token"},
+			want: []web.FieldError{
+				{Field: "headers.X-Callback-Signature", Code: "reserved_header", Message: "header X-Callback-Signature cannot be set"},
+				{Field: "headers.X-Token", Code: "reserved_header", Message: "header X-Token cannot be set"},
+				{Field: "headers.content-type", Code: "reserved_header", Message: "header content-type cannot be set"},
+			},
+		},
+		{
+			name: "invalid header values",
+			opts: RequestOptions{Headers: map[string]string{"X-Injected": "abc\r\nX-Other: 1", "X-Null": "a\x00b", "X-Tab": "a\tb"}},
+			want: []web.FieldError{
+				{Field: "headers.X-Injected", Code: "invalid_header_value", Message: "value of header X-Injected contains control characters"},
+				{Field: "headers.X-Null", Code: "invalid_header_value", Message: "value of header X-Null contains control characters"},
+			},
+		},
+		{
+			name: "reserved token header",
+			opts: RequestOptions{TokenHeader: "x-callback-signature"},
+			want: []web.FieldError{{Field: "token_header", Code: "reserved_header", Message: "header x-callback-signature cannot carry the token"}},
+		},
+		{
+			name: "default token header",
+			opts: RequestOptions{TokenHeader: "X-Callback-Token"},
+		},
+		{
+			name: "invalid options",
+			opts: RequestOptions{TokenHeader: "x:token", Method: http.MethodGet, Timeout: time.Hour},
+			want: []web.FieldError{
+				{Field: "token_header", Code: "invalid_header", Message: `"x:token" is not a valid header name`},
+				{Field: "method", Code: "invalid_method", Message: "method must be POST or PUT"},
+				{Field: "timeout", Code: "invalid_timeout", Message: "timeout must be between 0 and 2m0s"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.Equals(t, tt.want, tt.opts.Validate())
+		})
+	}
+}
+
+func TestRequestOptions_newRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        RequestOptions
+		wantMethod  string
+		wantHeaders map[string]string
+	}{
+		{
+			name:        "defaults",
+			wantMethod:  http.MethodPost,
+			wantHeaders: map[string]string{tokenHeaderKey: "some token", "Content-Type": "application/json", "Content-Encoding": ""},
+		},
+		{
+			name: "custom",
+			opts: RequestOptions{
+				Headers:     map[string]string{"X-Gateway-Key": "abc"},
+				TokenHeader: "X-Merchant-Token",
+				Method:      http.MethodPut,
+			},
+			wantMethod: http.MethodPut,
+			wantHeaders: map[string]string{
+				tokenHeaderKey:     "",
+				"X-Merchant-Token": "some token",
+				"Content-Type":     "application/json",
+				"X-Gateway-Key":    "abc",
+			},
+		},
+		{
+			name: "stored reserved headers",
+			opts: RequestOptions{
+				Headers: map[string]string{"Content-Type": "text/plain", tokenHeaderKey: "forged"},
+			},
+			wantMethod: http.MethodPost,
+			wantHeaders: map[string]string{
+				tokenHeaderKey: "some token",
+				"Content-Type": "application/json",
+			},
+		},
+		{
+			name:        "gzip",
+			opts:        RequestOptions{Gzip: true},
+			wantMethod:  http.MethodPost,
+			wantHeaders: map[string]string{"Content-Encoding": "gzip"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := tt.opts.newRequest(context.Background(), "https://merchant/callback", "some token", `{"amount":1}`)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tt.wantMethod, req.Method)
+			for name, value := range tt.wantHeaders {
+				testutil.Equals(t, value, req.Header.Get(name))
+			}
+
+			body := req.Body
+			if tt.opts.Gzip {
+				body, err = gzip.NewReader(req.Body)
+				testutil.Ok(t, err)
+			}
+			data, err := ioutil.ReadAll(body)
+			testutil.Ok(t, err)
+			testutil.Equals(t, `{"amount":1}`, string(data))
+		})
+	}
+}
+
+func TestCallbackOptions(t *testing.T) {
+	base := &http.Client{Timeout: 10 * time.Second}
+	opts, err := callbackOptions(&bmodels.CallbackURL{Headers: types.JSON(`{"X-Gateway-Key":"abc"}`), TimeoutMS: 2500, Method: http.MethodPut})
+	testutil.Ok(t, err)
+	testutil.Equals(t, RequestOptions{Headers: map[string]string{"X-Gateway-Key": "abc"}, Method: http.MethodPut, Timeout: 2500 * time.Millisecond}, opts)
+	testutil.Equals(t, 2500*time.Millisecond, opts.client(base).Timeout)
+	testutil.Equals(t, 10*time.Second, base.Timeout)
+
+	opts, err = callbackOptions(&bmodels.CallbackURL{})
+	testutil.Ok(t, err)
+	testutil.Asserts(t, opts.client(base) == base, "client without timeout should be the base one")
+
+	_, err = callbackOptions(&bmodels.CallbackURL{ID: 3, Headers: types.JSON(`["X-Gateway-Key"]`)})
+	testutil.CompareError(t, "headers of callback URL 3: json: cannot unmarshal array into Go value of type map[string]string", err)
+}
+
+func TestModelStore_SetCallbackOptions(t *testing.T) {
+	ctx := context.TODO()
+	tx := db.MustBegin()
+	defer tx.Rollback()
+	url := bmodels.CallbackURL{ID: 43001, BusinessID: "bank0", ProductID: "va", CallbackURL: "https://bank0"}
+	testutil.Ok(t, url.Insert(ctx, tx, boil.Infer()))
+	testutil.Ok(t, url.Reload(ctx, tx))
+	testutil.Equals(t, http.MethodPost, url.Method)
+
+	store := ModelStore{DB: tx}
+	testutil.CompareError(t, ErrUnknownCallbackURL.Error(), store.SetCallbackOptions(ctx, 1, RequestOptions{}))
+	testutil.CompareError(t, "request validation failed", store.SetCallbackOptions(ctx, url.ID, RequestOptions{Method: http.MethodGet}))
+
+	want := RequestOptions{Headers: map[string]string{"X-Gateway-Key": "abc"}, TokenHeader: "X-Token", Method: http.MethodPut, Timeout: 3 * time.Second, Gzip: true}
+	testutil.Ok(t, store.SetCallbackOptions(ctx, url.ID, want))
+	testutil.Ok(t, url.Reload(ctx, tx))
+	got, err := callbackOptions(&url)
+	testutil.Ok(t, err)
+	testutil.Equals(t, want, got)
+}
@@ -0,0 +1,171 @@
+package messages
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// defaultPartitionsAhead is the number of monthly partitions created ahead of the current month
+const defaultPartitionsAhead = 3
+
+// partitionNamePattern matches the monthly partitions of messages, e.g. messages_2021_05
+var partitionNamePattern = regexp.MustCompile(`^messages_(\d{4})_(\d{2})$`)
+
+const (
+	listPartitionsQuery = `SELECT c.relname FROM pg_inherits i
+JOIN pg_class c ON c.oid = i.inhrelid
+JOIN pg_class p ON p.oid = i.inhparent
+WHERE p.relname = 'messages'`
+	createPartitionQuery = `CREATE TABLE IF NOT EXISTS %s PARTITION OF messages FOR VALUES FROM (%s) TO (%s)`
+	detachPartitionQuery = `ALTER TABLE messages DETACH PARTITION %s`
+	dropPartitionQuery   = `DROP TABLE %s`
+	// the keys of the messages of a detached partition are released as the messages are not deleted
+	releaseKeysQuery = `DELETE FROM message_idempotency_keys WHERE created_at >= $1 AND created_at < $2`
+	// the partitions are detached once the longest retention is over
+	longestRetentionQuery = `SELECT GREATEST($1, COALESCE(MAX(retention_days), 0)) FROM merchants`
+)
+
+// Partition is a monthly partition of messages, with the messages created from From until To
+type Partition struct {
+	Name string    `json:"name"`
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// newPartition returns the partition of the month of the time, in UTC
+func newPartition(t time.Time) Partition {
+	t = t.UTC()
+	from := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return Partition{Name: fmt.Sprintf("messages_%04d_%02d", from.Year(), from.Month()), From: from, To: from.AddDate(0, 1, 0)}
+}
+
+// parsePartition returns the monthly partition with the name, ok is false for other tables such as the default partition
+func parsePartition(name string) (p Partition, ok bool) {
+	match := partitionNamePattern.FindStringSubmatch(name)
+	if match == nil {
+		return p, false
+	}
+	from, err := time.Parse("2006-01", match[1]+"-"+match[2])
+	if err != nil {
+		return p, false
+	}
+	return newPartition(from), true
+}
+
+// PartitionOptions configures MaintainPartitions
+type PartitionOptions struct {
+	// Ahead is the number of months whose partitions are created ahead of the current month, 3 when zero
+	Ahead int
+	// RetentionDays applies to the merchants without retention, partitions are detached once the longest retention
+	// is over. Partitions are never detached when zero
+	RetentionDays int
+	// Drop drops the detached partitions, they are kept as standalone tables otherwise
+	Drop bool
+	// DryRun reports the partitions to create and detach without changing them
+	DryRun bool
+}
+
+// PartitionReport lists the partitions changed by MaintainPartitions
+type PartitionReport struct {
+	Created  []Partition `json:"created"`
+	Detached []Partition `json:"detached"`
+}
+
+// Partitions returns the monthly partitions of messages, the oldest first
+func Partitions(ctx context.Context, db Inquirer) ([]Partition, error) {
+	rows, err := db.QueryContext(ctx, listPartitionsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var partitions []Partition
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		if p, ok := parsePartition(name); ok {
+			partitions = append(partitions, p)
+		}
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].From.Before(partitions[j].From) })
+	return partitions, rows.Err()
+}
+
+// MaintainPartitions creates the partitions of the coming months, so that the default partition stays empty, and
+// detaches the partitions whose messages are all past the longest retention. Undelivered messages that old have
+// long exhausted their retries
+func MaintainPartitions(ctx context.Context, db Inquirer, now time.Time, opts PartitionOptions) (PartitionReport, error) {
+	var report PartitionReport
+	if opts.Ahead <= 0 {
+		opts.Ahead = defaultPartitionsAhead
+	}
+	existing, err := Partitions(ctx, db)
+	if err != nil {
+		return report, err
+	}
+	exists := make(map[string]bool, len(existing))
+	for _, p := range existing {
+		exists[p.Name] = true
+	}
+
+	// the months are stepped from the first of the month, Jan 31 plus a month being Mar 3
+	first := newPartition(now).From
+	for i := 0; i <= opts.Ahead; i++ {
+		p := newPartition(first.AddDate(0, i, 0))
+		if exists[p.Name] {
+			continue
+		}
+		if !opts.DryRun {
+			query := fmt.Sprintf(createPartitionQuery, pq.QuoteIdentifier(p.Name),
+				pq.QuoteLiteral(p.From.Format(time.RFC3339)), pq.QuoteLiteral(p.To.Format(time.RFC3339)))
+			if _, err := db.ExecContext(ctx, query); err != nil {
+				return report, fmt.Errorf("creating partition %s: %v", p.Name, err)
+			}
+		}
+		report.Created = append(report.Created, p)
+	}
+
+	if opts.RetentionDays <= 0 {
+		return report, nil
+	}
+	var retentionDays int
+	if err := db.QueryRowContext(ctx, longestRetentionQuery, opts.RetentionDays).Scan(&retentionDays); err != nil {
+		return report, err
+	}
+	cutoff := now.AddDate(0, 0, -retentionDays)
+	for _, p := range existing {
+		if p.To.After(cutoff) {
+			break
+		}
+		if !opts.DryRun {
+			if err := detachPartition(ctx, db, p, opts.Drop); err != nil {
+				return report, fmt.Errorf("detaching partition %s: %v", p.Name, err)
+			}
+		}
+		report.Detached = append(report.Detached, p)
+	}
+	return report, nil
+}
+
+func detachPartition(ctx context.Context, db Inquirer, p Partition, drop bool) error {
+	return withTx(ctx, db, func(tx Inquirer) error {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(detachPartitionQuery, pq.QuoteIdentifier(p.Name))); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, releaseKeysQuery, p.From, p.To); err != nil {
+			return err
+		}
+		if !drop {
+			return nil
+		}
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(dropPartitionQuery, pq.QuoteIdentifier(p.Name)))
+		return err
+	})
+}
@@ -0,0 +1,85 @@
+package messages
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+func TestParsePartition(t *testing.T) {
+	tests := []struct {
+		name   string
+		table  string
+		want   Partition
+		wantOk bool
+	}{
+		{
+			name:   "monthly",
+			table:  "messages_2021_05",
+			want:   Partition{Name: "messages_2021_05", From: time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)},
+			wantOk: true,
+		},
+		{
+			name:   "december",
+			table:  "messages_2021_12",
+			want:   Partition{Name: "messages_2021_12", From: time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+			wantOk: true,
+		},
+		{name: "default", table: "messages_default"},
+		{name: "invalid month", table: "messages_2021_13"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parsePartition(tt.table)
+			testutil.Equals(t, tt.wantOk, ok)
+			testutil.Equals(t, tt.want, got)
+		})
+	}
+
+	// the months are in UTC
+	testutil.Equals(t, "messages_2021_05", newPartition(time.Date(2021, 6, 1, 7, 0, 0, 0, time.FixedZone("UTC+8", 8*3600))).Name)
+}
+
+func TestMaintainPartitions(t *testing.T) {
+	ctx := context.TODO()
+	tx := db.MustBegin()
+	defer tx.Rollback()
+
+	now := time.Now()
+	// no month is skipped from the end of a longer month
+	report, err := MaintainPartitions(ctx, tx, time.Date(2099, 1, 31, 12, 0, 0, 0, time.UTC), PartitionOptions{Ahead: 2, DryRun: true})
+	testutil.Ok(t, err)
+	var names []string
+	for _, p := range report.Created {
+		names = append(names, p.Name)
+	}
+	testutil.Equals(t, []string{"messages_2099_01", "messages_2099_02", "messages_2099_03"}, names)
+
+	report, err = MaintainPartitions(ctx, tx, now, PartitionOptions{Ahead: 24, DryRun: true})
+	testutil.Ok(t, err)
+	testutil.Asserts(t, len(report.Created) > 0, "partitions should be created ahead")
+	testutil.Equals(t, newPartition(newPartition(now).From.AddDate(0, 24, 0)), report.Created[len(report.Created)-1])
+
+	_, err = MaintainPartitions(ctx, tx, now, PartitionOptions{Ahead: 24})
+	testutil.Ok(t, err)
+	partitions, err := Partitions(ctx, tx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, newPartition(newPartition(now).From.AddDate(0, 24, 0)), partitions[len(partitions)-1])
+
+	report, err = MaintainPartitions(ctx, tx, now, PartitionOptions{Ahead: 24})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(report.Created))
+
+	// partitions from 100 years ago are past any retention
+	old := newPartition(now.AddDate(-100, 0, 0))
+	_, err = MaintainPartitions(ctx, tx, old.From, PartitionOptions{Ahead: 1})
+	testutil.Ok(t, err)
+	report, err = MaintainPartitions(ctx, tx, now, PartitionOptions{RetentionDays: 30, Drop: true})
+	testutil.Ok(t, err)
+	testutil.Equals(t, old, report.Detached[0])
+	partitions, err = Partitions(ctx, tx)
+	testutil.Ok(t, err)
+	testutil.Asserts(t, partitions[0].From.After(old.From), "partition should be detached")
+}
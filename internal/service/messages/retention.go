@@ -0,0 +1,218 @@
+package messages
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kagelui/notification/internal/models/bmodels"
+	"github.com/kagelui/notification/internal/pkg/web"
+	"github.com/lib/pq"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+)
+
+// defaultPurgeBatchSize is the number of messages deleted per transaction by Purge
+const defaultPurgeBatchSize = 1000
+
+// maxRetentionDays bounds the retention of a merchant, 10 years
+const maxRetentionDays = 3650
+
+const (
+	// the retention of the merchant applies, or the default retention when the merchant has none
+	purgeCondition  = `m.status = $1 AND m.created_at < $2::timestamptz - make_interval(days => CASE WHEN mc.retention_days > 0 THEN mc.retention_days ELSE $3 END)`
+	purgeCountQuery = `SELECT mc.business_id, count(*) FROM messages m JOIN merchants mc ON mc.id = m.merchant_id
+WHERE ` + purgeCondition + `
+GROUP BY mc.business_id`
+	purgeSelectQuery = `SELECT m.id, mc.business_id, m.product_id, m.product_type, m.payload::text, m.payload_key_id, m.status,
+m.retry_count, m.idempotency_key, m.request_id, m.created_at, m.updated_at
+FROM messages m JOIN merchants mc ON mc.id = m.merchant_id
+WHERE ` + purgeCondition + `
+ORDER BY m.created_at LIMIT $4
+FOR UPDATE OF m SKIP LOCKED`
+	purgeDeleteQuery = `DELETE FROM messages WHERE id = ANY($1::uuid[])`
+)
+
+// ArchivedMessage is a purged message as exported to the archive, the payload stays sealed if it is
+type ArchivedMessage struct {
+	ID             string          `json:"id"`
+	BusinessID     string          `json:"business_id"`
+	ProductID      string          `json:"product_id"`
+	ProductType    string          `json:"product_type"`
+	Payload        json.RawMessage `json:"payload"`
+	PayloadKeyID   string          `json:"payload_key_id,omitempty"`
+	Status         string          `json:"status"`
+	RetryCount     int             `json:"retry_count"`
+	IdempotencyKey string          `json:"idempotency_key,omitempty"`
+	RequestID      string          `json:"request_id,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// Archiver stores the purged messages before they are deleted, a batch is deleted only once Archive returns
+type Archiver interface {
+	Archive(messages []ArchivedMessage) error
+}
+
+// PurgeOptions configures Purge
+type PurgeOptions struct {
+	// RetentionDays applies to the merchants without retention
+	RetentionDays int
+	// BatchSize is the number of messages deleted per transaction, 1000 when zero
+	BatchSize int
+	// DryRun counts the messages past their retention without deleting them
+	DryRun bool
+	// Archive receives the messages before they are deleted, the messages of a batch failing to be deleted are
+	// archived again by the next run. Messages are deleted without archive when nil
+	Archive Archiver
+}
+
+// PurgeReport counts the messages purged, or past their retention for a dry run
+type PurgeReport struct {
+	Messages   int            `json:"messages"`
+	ByMerchant map[string]int `json:"by_merchant"`
+}
+
+// Purge deletes the delivered messages older than the retention of their merchant, in batches so that the table is
+// never locked for long. Failed and pending messages are kept until they are delivered
+func Purge(ctx context.Context, db Inquirer, now time.Time, opts PurgeOptions) (PurgeReport, error) {
+	report := PurgeReport{ByMerchant: map[string]int{}}
+	if opts.RetentionDays <= 0 {
+		return report, fmt.Errorf("invalid default retention of %d days", opts.RetentionDays)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultPurgeBatchSize
+	}
+
+	if opts.DryRun {
+		rows, err := db.QueryContext(ctx, purgeCountQuery, MessageDeliveryStatusSuccess, now, opts.RetentionDays)
+		if err != nil {
+			return report, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var businessID string
+			var count int
+			if err := rows.Scan(&businessID, &count); err != nil {
+				return report, err
+			}
+			report.ByMerchant[businessID] = count
+			report.Messages += count
+		}
+		return report, rows.Err()
+	}
+
+	for {
+		var batch []ArchivedMessage
+		err := withTx(ctx, db, func(tx Inquirer) error {
+			var err error
+			if batch, err = purgeBatch(ctx, tx, now, opts); err != nil || len(batch) == 0 {
+				return err
+			}
+			if opts.Archive != nil {
+				if err := opts.Archive.Archive(batch); err != nil {
+					return fmt.Errorf("archiving messages: %v", err)
+				}
+			}
+			ids := make([]string, 0, len(batch))
+			for _, m := range batch {
+				ids = append(ids, m.ID)
+			}
+			_, err = tx.ExecContext(ctx, purgeDeleteQuery, pq.Array(ids))
+			return err
+		})
+		if err != nil {
+			return report, err
+		}
+		for _, m := range batch {
+			report.ByMerchant[m.BusinessID]++
+		}
+		report.Messages += len(batch)
+		messagesPurged.Add(float64(len(batch)))
+		if len(batch) < opts.BatchSize {
+			return report, nil
+		}
+	}
+}
+
+// purgeBatch locks the next batch of messages past their retention
+func purgeBatch(ctx context.Context, tx Inquirer, now time.Time, opts PurgeOptions) ([]ArchivedMessage, error) {
+	rows, err := tx.QueryContext(ctx, purgeSelectQuery, MessageDeliveryStatusSuccess, now, opts.RetentionDays, opts.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch []ArchivedMessage
+	for rows.Next() {
+		var m ArchivedMessage
+		var payload string
+		if err := rows.Scan(&m.ID, &m.BusinessID, &m.ProductID, &m.ProductType, &payload, &m.PayloadKeyID, &m.Status,
+			&m.RetryCount, &m.IdempotencyKey, &m.RequestID, &m.CreatedAt, &m.UpdatedAt); err != nil {
+			return nil, err
+		}
+		m.Payload = json.RawMessage(payload)
+		batch = append(batch, m)
+	}
+	return batch, rows.Err()
+}
+
+// FileArchive writes the purged messages to a gzip compressed NDJSON file, one message per line
+type FileArchive struct {
+	// Path is the path of the archive file
+	Path string
+	f    *os.File
+	gz   *gzip.Writer
+}
+
+// CreateArchive creates an archive file named after the time in the directory
+func CreateArchive(dir string, now time.Time) (*FileArchive, error) {
+	path := filepath.Join(dir, fmt.Sprintf("messages-%s.ndjson.gz", now.UTC().Format("20060102T150405Z")))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileArchive{Path: path, f: f, gz: gzip.NewWriter(f)}, nil
+}
+
+// Archive implements Archiver, the messages are synced to disk before it returns
+func (a *FileArchive) Archive(messages []ArchivedMessage) error {
+	enc := json.NewEncoder(a.gz)
+	for _, m := range messages {
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+	}
+	if err := a.gz.Flush(); err != nil {
+		return err
+	}
+	return a.f.Sync()
+}
+
+// Close completes the archive file
+func (a *FileArchive) Close() error {
+	if err := a.gz.Close(); err != nil {
+		a.f.Close()
+		return err
+	}
+	return a.f.Close()
+}
+
+// SetRetention sets the days the delivered messages of the merchant are kept, 0 applies the default retention
+func (m ModelStore) SetRetention(ctx context.Context, businessID string, days int) error {
+	if days < 0 || days > maxRetentionDays {
+		return web.NewValidationError([]web.FieldError{{
+			Field: "retention_days", Code: "out_of_range", Message: fmt.Sprintf("retention_days must be between 0 and %d", maxRetentionDays),
+		}})
+	}
+	merchant, err := findMerchant(ctx, m.DB, businessID)
+	if err != nil {
+		return err
+	}
+	merchant.RetentionDays = days
+	_, err = merchant.Update(ctx, m.DB, boil.Whitelist(bmodels.MerchantColumns.RetentionDays, bmodels.MerchantColumns.UpdatedAt))
+	return err
+}
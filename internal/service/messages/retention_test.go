@@ -0,0 +1,124 @@
+package messages
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kagelui/notification/internal/models/bmodels"
+	"github.com/kagelui/notification/internal/testutil"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/types"
+)
+
+func TestFileArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	testutil.Ok(t, err)
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC)
+	archive, err := CreateArchive(dir, now)
+	testutil.Ok(t, err)
+	testutil.Equals(t, filepath.Join(dir, "messages-20210501T120000Z.ndjson.gz"), archive.Path)
+	_, err = CreateArchive(dir, now)
+	testutil.Asserts(t, os.IsExist(err), "archive should not be overwritten: %v", err)
+
+	written := []ArchivedMessage{
+		{ID: "message0", BusinessID: "merchant0", Payload: json.RawMessage(`"{}"`), Status: MessageDeliveryStatusSuccess, CreatedAt: now},
+		{ID: "message1", BusinessID: "merchant0", Payload: json.RawMessage(`"env:v1:abc"`), PayloadKeyID: "2021-05", Status: MessageDeliveryStatusSuccess, CreatedAt: now},
+	}
+	testutil.Ok(t, archive.Archive(written[:1]))
+	testutil.Ok(t, archive.Archive(written[1:]))
+	testutil.Ok(t, archive.Close())
+
+	f, err := os.Open(archive.Path)
+	testutil.Ok(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	testutil.Ok(t, err)
+	var read []ArchivedMessage
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		var m ArchivedMessage
+		testutil.Ok(t, json.Unmarshal(scanner.Bytes(), &m))
+		read = append(read, m)
+	}
+	testutil.Ok(t, scanner.Err())
+	testutil.Equals(t, written, read)
+}
+
+type recordingArchive struct {
+	messages []ArchivedMessage
+}
+
+func (a *recordingArchive) Archive(messages []ArchivedMessage) error {
+	a.messages = append(a.messages, messages...)
+	return nil
+}
+
+func TestPurge(t *testing.T) {
+	ctx := context.TODO()
+	tx := db.MustBegin()
+	defer tx.Rollback()
+
+	now := time.Now()
+	payloadJSON := types.JSON{}
+	testutil.Ok(t, payloadJSON.Marshal("{}"))
+	merchants := []bmodels.Merchant{
+		{ID: 92140, BusinessID: "merchant3", Token: "some token"},
+		{ID: 92141, BusinessID: "merchant4", Token: "some token", RetentionDays: 7},
+	}
+	for i := range merchants {
+		testutil.Ok(t, merchants[i].Insert(ctx, tx, boil.Infer()))
+	}
+	message := func(merchantID int, status string, age time.Duration) bmodels.Message {
+		m := bmodels.Message{ID: uuid.New().String(), ProductID: "va", ProductType: "something", Payload: payloadJSON,
+			MerchantID: merchantID, NextDeliveryTime: now, Status: status, CreatedAt: now.Add(-age)}
+		testutil.Ok(t, m.Insert(ctx, tx, boil.Infer()))
+		return m
+	}
+	day := 24 * time.Hour
+	expired := message(92140, MessageDeliveryStatusSuccess, 31*day)
+	message(92140, MessageDeliveryStatusSuccess, 29*day)
+	message(92140, MessageDeliveryStatusFailed, 31*day)
+	message(92141, MessageDeliveryStatusSuccess, 8*day)
+	message(92141, MessageDeliveryStatusSuccess, 8*day)
+	message(92141, MessageDeliveryStatusPending, 8*day)
+
+	_, err := Purge(ctx, tx, now, PurgeOptions{})
+	testutil.CompareError(t, "invalid default retention of 0 days", err)
+
+	report, err := Purge(ctx, tx, now, PurgeOptions{RetentionDays: 30, DryRun: true})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, report.ByMerchant["merchant3"])
+	testutil.Equals(t, 2, report.ByMerchant["merchant4"])
+
+	archive := &recordingArchive{}
+	report, err = Purge(ctx, tx, now, PurgeOptions{RetentionDays: 30, BatchSize: 1, Archive: archive})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, report.ByMerchant["merchant3"])
+	testutil.Equals(t, 2, report.ByMerchant["merchant4"])
+	testutil.Equals(t, report.Messages, len(archive.messages))
+	testutil.Equals(t, expired.ID, archive.messages[0].ID)
+	testutil.Equals(t, payloadJSON.String(), string(archive.messages[0].Payload))
+
+	for _, m := range merchants {
+		count, err := bmodels.Messages(bmodels.MessageWhere.MerchantID.EQ(m.ID)).Count(ctx, tx)
+		testutil.Ok(t, err)
+		testutil.Equals(t, int64(2), count)
+	}
+
+	store := ModelStore{DB: tx}
+	testutil.Ok(t, store.SetRetention(ctx, "merchant3", 14))
+	testutil.Ok(t, merchants[0].Reload(ctx, tx))
+	testutil.Equals(t, 14, merchants[0].RetentionDays)
+	testutil.Equals(t, ErrUnknownMerchant, store.SetRetention(ctx, "merchant5", 14))
+	testutil.CompareError(t, "request validation failed", store.SetRetention(ctx, "merchant3", -1))
+}
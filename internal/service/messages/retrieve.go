@@ -2,20 +2,73 @@ package messages
 
 import (
 	"context"
+	"sort"
 	"time"
 
 	"github.com/kagelui/notification/internal/models/bmodels"
-	"github.com/volatiletech/sqlboiler/v4/queries/qm"
+	"github.com/volatiletech/sqlboiler/v4/queries"
 )
 
+// maxRetry bounds the retry count of the retried messages, the partial index messages_due_retry_index has the same bound
 const maxRetry = 6
 
-// RetrieveAllRetryMessages returns all messages that should be retried
-func RetrieveAllRetryMessages(ctx context.Context, db Inquirer) ([]*bmodels.Message, error) {
-	return bmodels.Messages(
-		bmodels.MessageWhere.Status.EQ(MessageDeliveryStatusFailed),
-		bmodels.MessageWhere.RetryCount.LT(maxRetry),
-		bmodels.MessageWhere.NextDeliveryTime.LT(time.Now()),
-		qm.Load(bmodels.MessageRels.Merchant),
-	).All(ctx, db)
+// zeroUUID precedes every message ID
+const zeroUUID = "00000000-0000-0000-0000-000000000000"
+
+const (
+	// the due messages are retried whatever their age, the partial index messages_due_retry_index keeps the scans short
+	dueCondition = `status = $1 AND retry_count < $2 AND next_delivery_time < $3`
+	// the due messages are claimed in delivery order, skipping the ones claimed by a concurrent run
+	claimRetryBatchQuery = `UPDATE messages m SET status = $4, updated_at = $3
+FROM (SELECT id, created_at FROM messages
+      WHERE ` + dueCondition + ` AND (next_delivery_time, id) > ($5, $6::uuid)
+      ORDER BY next_delivery_time, id LIMIT $7
+      FOR UPDATE SKIP LOCKED) due
+WHERE m.id = due.id AND m.created_at = due.created_at
+RETURNING m.*`
+	countRetryQuery = `SELECT count(*) FROM messages WHERE ` + dueCondition
+)
+
+// RetryCursor is the position of the retry scan in delivery order, the zero cursor precedes every message
+type RetryCursor struct {
+	NextDeliveryTime time.Time
+	ID               string
+}
+
+// CountRetryMessages returns the number of messages due for retry
+func CountRetryMessages(ctx context.Context, db Inquirer) (int, error) {
+	now := time.Now()
+	var count int
+	err := db.QueryRowContext(ctx, countRetryQuery, MessageDeliveryStatusFailed, maxRetry, now).Scan(&count)
+	return count, err
+}
+
+// ClaimRetryBatch marks up to limit messages due for retry after the cursor pending, in a single statement, and
+// returns them with their merchant info in delivery order, along with the cursor of the next batch
+func ClaimRetryBatch(ctx context.Context, db Inquirer, cursor RetryCursor, limit int) ([]*bmodels.Message, RetryCursor, error) {
+	if cursor.ID == "" {
+		cursor.ID = zeroUUID
+	}
+	now := time.Now()
+	var batch []*bmodels.Message
+	err := queries.Raw(claimRetryBatchQuery, MessageDeliveryStatusFailed, maxRetry, now,
+		MessageDeliveryStatusPending, cursor.NextDeliveryTime, cursor.ID, limit).Bind(ctx, db, &batch)
+	if err != nil || len(batch) == 0 {
+		return nil, cursor, err
+	}
+
+	// the updated rows are returned in no particular order
+	sort.Slice(batch, func(i, j int) bool {
+		if !batch[i].NextDeliveryTime.Equal(batch[j].NextDeliveryTime) {
+			return batch[i].NextDeliveryTime.Before(batch[j].NextDeliveryTime)
+		}
+		return batch[i].ID < batch[j].ID
+	})
+	last := batch[len(batch)-1]
+	cursor = RetryCursor{NextDeliveryTime: last.NextDeliveryTime, ID: last.ID}
+
+	if err := (bmodels.Message{}).L.LoadMerchant(ctx, db, false, &batch, nil); err != nil {
+		return nil, cursor, err
+	}
+	return batch, cursor, nil
 }
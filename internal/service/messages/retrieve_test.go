@@ -0,0 +1,131 @@
+package messages
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kagelui/notification/internal/models/bmodels"
+	"github.com/kagelui/notification/internal/testutil"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/types"
+)
+
+func TestClaimRetryBatch(t *testing.T) {
+	ctx := context.TODO()
+	tx := db.MustBegin()
+	defer tx.Rollback()
+
+	merchant := bmodels.Merchant{ID: 92142, BusinessID: "merchant5", Token: "some token"}
+	testutil.Ok(t, merchant.Insert(ctx, tx, boil.Infer()))
+	payloadJSON := types.JSON{}
+	testutil.Ok(t, payloadJSON.Marshal("{}"))
+
+	now := time.Now()
+	message := func(status string, retryCount int, next time.Time, age time.Duration) bmodels.Message {
+		m := bmodels.Message{ID: uuid.New().String(), ProductID: "va", ProductType: "something", Payload: payloadJSON,
+			MerchantID: merchant.ID, RetryCount: retryCount, NextDeliveryTime: next, Status: status, CreatedAt: now.Add(-age)}
+		testutil.Ok(t, m.Insert(ctx, tx, boil.Infer()))
+		return m
+	}
+	due := []bmodels.Message{
+		// the messages are retried whatever their age
+		message(MessageDeliveryStatusFailed, 1, now.Add(-4*time.Minute), 60*24*time.Hour),
+		message(MessageDeliveryStatusFailed, 1, now.Add(-3*time.Minute), time.Hour),
+		message(MessageDeliveryStatusFailed, 2, now.Add(-2*time.Minute), time.Hour),
+		message(MessageDeliveryStatusFailed, 1, now.Add(-time.Minute), time.Hour),
+	}
+	message(MessageDeliveryStatusFailed, 1, now.Add(time.Hour), time.Hour)
+	message(MessageDeliveryStatusFailed, maxRetry, now.Add(-time.Minute), time.Hour)
+	message(MessageDeliveryStatusSuccess, 1, now.Add(-time.Minute), time.Hour)
+
+	count, err := CountRetryMessages(ctx, tx)
+	testutil.Ok(t, err)
+	testutil.Asserts(t, count >= len(due), "due messages should be counted: %d", count)
+
+	// other due messages may precede the ones of the merchant
+	var claimed []string
+	cursor := RetryCursor{}
+	for {
+		batch, next, err := ClaimRetryBatch(ctx, tx, cursor, 2)
+		testutil.Ok(t, err)
+		testutil.Asserts(t, len(batch) <= 2, "batch should be bounded: %d", len(batch))
+		for _, m := range batch {
+			testutil.Equals(t, MessageDeliveryStatusPending, m.Status)
+			if m.MerchantID == merchant.ID {
+				claimed = append(claimed, m.ID)
+				testutil.Equals(t, merchant.BusinessID, m.R.Merchant.BusinessID)
+			}
+		}
+		if len(batch) < 2 {
+			break
+		}
+		cursor = next
+	}
+	testutil.Equals(t, []string{due[0].ID, due[1].ID, due[2].ID, due[3].ID}, claimed)
+
+	for _, m := range due {
+		testutil.Ok(t, m.Reload(ctx, tx))
+		testutil.Equals(t, MessageDeliveryStatusPending, m.Status)
+	}
+	batch, _, err := ClaimRetryBatch(ctx, tx, RetryCursor{}, 2)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(batch))
+
+	invalid := bmodels.Message{ID: uuid.New().String(), ProductID: "va", ProductType: "something", Payload: payloadJSON,
+		MerchantID: merchant.ID, NextDeliveryTime: now, Status: "DELIVERED"}
+	_, err = tx.Exec("SAVEPOINT invalid_status")
+	testutil.Ok(t, err)
+	testutil.CompareError(t, "messages_status_check", invalid.Insert(ctx, tx, boil.Infer()))
+	_, err = tx.Exec("ROLLBACK TO SAVEPOINT invalid_status")
+	testutil.Ok(t, err)
+}
+
+// BenchmarkClaimRetryBatch claims a batch of 500 among BENCH_MESSAGES messages of the last 90 days, a million by
+// default, 0.1% of them failed and due for retry:
+// go test -run '^$' -bench ClaimRetryBatch ./internal/service/messages
+func BenchmarkClaimRetryBatch(b *testing.B) {
+	count := 1000000
+	if v, ok := os.LookupEnv("BENCH_MESSAGES"); ok {
+		var err error
+		if count, err = strconv.Atoi(v); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	ctx := context.TODO()
+	tx := db.MustBegin()
+	defer tx.Rollback()
+
+	merchant := bmodels.Merchant{ID: 92143, BusinessID: "merchant6", Token: "some token"}
+	if err := merchant.Insert(ctx, tx, boil.Infer()); err != nil {
+		b.Fatal(err)
+	}
+	// spread over the last 90 days, 1 in 1000 failed and due, 1 in 1000 failed with exhausted retries
+	if _, err := tx.ExecContext(ctx, `INSERT INTO messages (id, product_id, product_type, payload, merchant_id, retry_count,
+next_delivery_time, status, created_at, updated_at)
+SELECT gen_random_uuid(), 'va', 'something', '"{}"', $1,
+       CASE WHEN i % 1000 = 1 THEN $3 ELSE 1 END,
+       now() - INTERVAL '1 minute',
+       CASE WHEN i % 1000 IN (0, 1) THEN 'FAILED' ELSE 'SUCCESS' END,
+       now() - (i % 90) * INTERVAL '1 day' - INTERVAL '1 minute', now()
+FROM generate_series(1, $2) AS i`, merchant.ID, count, maxRetry); err != nil {
+		b.Fatal(err)
+	}
+	if _, err := tx.ExecContext(ctx, "ANALYZE messages"); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// every iteration claims the same batch
+		tx.MustExec("SAVEPOINT claim")
+		if _, _, err := ClaimRetryBatch(ctx, tx, RetryCursor{}, 500); err != nil {
+			b.Fatal(err)
+		}
+		tx.MustExec("ROLLBACK TO SAVEPOINT claim")
+	}
+}
@@ -2,56 +2,126 @@ package messages
 
 import (
 	"context"
+	"database/sql"
 	"github.com/google/uuid"
 	"net/http"
 	"time"
 
 	"github.com/kagelui/notification/internal/models/bmodels"
+	"github.com/kagelui/notification/internal/pkg/metrics"
+	"github.com/kagelui/notification/internal/pkg/secret"
+	"github.com/kagelui/notification/internal/pkg/trace"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
 	"github.com/volatiletech/sqlboiler/v4/boil"
 	"github.com/volatiletech/sqlboiler/v4/types"
 )
 
+// uniqueViolation is the postgres error code for unique constraint violations
+const uniqueViolation = "23505"
+
 // ModelStore contains a reference to the DB connection and provides the service to handlers
 type ModelStore struct {
 	DB Inquirer
+	// Events receives the delivery outcome of the stored callbacks
+	Events EventSink
+	// Auth authenticates the callbacks to the callback URLs with auth settings
+	Auth *Authenticators
+	// Keys seals the merchant tokens and the payloads, which are stored in plaintext when nil
+	Keys *secret.Keyring
 }
 
-func (m ModelStore) InsertCallbackThenDo(ctx context.Context, productID, productType, payload, businessID string, timeout time.Duration) error {
-	// insert the callback
-	merchant, err := bmodels.Merchants(bmodels.MerchantWhere.BusinessID.EQ(businessID)).One(ctx, m.DB)
-	if err != nil {
+// InsertCallbackThenDo stores the callback and performs it asynchronously.
+// A callback with an idempotency key already stored for the merchant is neither stored nor performed again
+func (m ModelStore) InsertCallbackThenDo(ctx context.Context, productID, productType, payload, businessID, idempotencyKey string, timeout time.Duration) error {
+	message, duplicate, err := insertCallback(ctx, m.DB, m.Keys, productID, productType, payload, businessID, idempotencyKey)
+	if err != nil || duplicate {
 		return err
 	}
+	messagesIngested.Inc(metrics.BusinessIDLabel(businessID), productID)
+
+	// perform callback
+	go func() {
+		httpClient := http.DefaultClient
+		httpClient.Timeout = timeout
+		client := CallbackClient{Client: httpClient, Events: m.Events, Auth: m.Auth, Keys: m.Keys}
+
+		client.DoCallback(context.Background(), m.DB, message)
+	}()
+
+	return nil
+}
+
+// insertCallback stores the callback with the merchant info loaded, duplicate tells if the idempotency key is already used
+func insertCallback(ctx context.Context, db Inquirer, keys *secret.Keyring, productID, productType, payload, businessID, idempotencyKey string) (message *bmodels.Message, duplicate bool, err error) {
+	// the delivery joins the trace of the request storing the callback
+	var traceparent string
+	if sc, ok := trace.FromContext(ctx); ok {
+		traceparent = sc.String()
+	}
+
+	spanCtx, span := trace.StartSpan(ctx, "merchant.lookup")
+	span.SetAttribute("business_id", businessID)
+	merchant, err := bmodels.Merchants(bmodels.MerchantWhere.BusinessID.EQ(businessID)).One(spanCtx, db)
+	span.RecordError(err)
+	span.End()
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, ErrUnknownMerchant
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	if idempotencyKey != "" {
+		exists, err := bmodels.Messages(
+			bmodels.MessageWhere.MerchantID.EQ(merchant.ID),
+			bmodels.MessageWhere.IdempotencyKey.EQ(idempotencyKey),
+		).Exists(ctx, db)
+		if err != nil || exists {
+			return nil, exists, err
+		}
+	}
 
 	payloadJSON := types.JSON{}
 	if err = payloadJSON.Marshal(payload); err != nil {
-		return err
+		return nil, false, err
+	}
+	payloadJSON, payloadKeyID, err := sealPayload(keys, payloadJSON)
+	if err != nil {
+		return nil, false, err
 	}
 
-	message := bmodels.Message{
-		ID:          uuid.New().String(),
-		ProductID:   productID,
-		ProductType: productType,
-		Payload:     payloadJSON,
-		MerchantID:  merchant.ID,
-		RetryCount:  0,
-		Status:      MessageDeliveryStatusPending,
+	message = &bmodels.Message{
+		ID:             uuid.New().String(),
+		ProductID:      productID,
+		ProductType:    productType,
+		Payload:        payloadJSON,
+		MerchantID:     merchant.ID,
+		RetryCount:     0,
+		Status:         MessageDeliveryStatusPending,
+		IdempotencyKey: idempotencyKey,
+		RequestID:      trace.RequestID(ctx),
+		Traceparent:    traceparent,
+		PayloadKeyID:   payloadKeyID,
 	}
-	if err = message.Insert(ctx, m.DB, boil.Infer()); err != nil {
-		return err
+
+	spanCtx, span = trace.StartSpan(ctx, "message.insert")
+	span.SetAttribute("message_id", message.ID)
+	span.SetAttribute("product_id", productID)
+	err = message.Insert(spanCtx, db, boil.Infer())
+	span.RecordError(err)
+	span.End()
+	if err != nil {
+		// a concurrent insert with the same idempotency key won the race
+		var pqErr *pq.Error
+		if idempotencyKey != "" && errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return nil, true, nil
+		}
+		return nil, false, err
 	}
 
 	message.R = message.R.NewStruct()
 	message.R.Merchant = merchant
 
-	// perform callback
-	go func() {
-		httpClient := http.DefaultClient
-		httpClient.Timeout = timeout
-		client := CallbackClient{Client: httpClient}
-
-		client.DoCallback(context.Background(), m.DB, &message)
-	}()
-
-	return nil
+	return message, false, nil
 }
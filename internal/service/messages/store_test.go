@@ -0,0 +1,49 @@
+package messages
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kagelui/notification/internal/models/bmodels"
+	"github.com/kagelui/notification/internal/pkg/trace"
+	"github.com/kagelui/notification/internal/testutil"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+)
+
+func Test_insertCallback(t *testing.T) {
+	sc := trace.NewSpanContext()
+	ctx := trace.NewContext(trace.WithRequestID(context.TODO(), "request0"), sc)
+	tx := db.MustBegin()
+	defer tx.Rollback()
+
+	merchant := bmodels.Merchant{ID: 92138, BusinessID: "merchant1", Token: "some token"}
+	testutil.Ok(t, merchant.Insert(ctx, tx, boil.Infer()))
+
+	_, _, err := insertCallback(ctx, tx, nil, "va", "something", "{}", "unknown merchant", "")
+	testutil.Equals(t, ErrUnknownMerchant, err)
+
+	first, duplicate, err := insertCallback(ctx, tx, nil, "va", "something", "{}", "merchant1", "key0")
+	testutil.Ok(t, err)
+	testutil.Asserts(t, !duplicate, "first insert should not be a duplicate")
+	testutil.Equals(t, MessageDeliveryStatusPending, first.Status)
+	testutil.Equals(t, "key0", first.IdempotencyKey)
+	testutil.Equals(t, "request0", first.RequestID)
+	testutil.Equals(t, sc.String(), first.Traceparent)
+	testutil.Equals(t, merchant.BusinessID, first.R.Merchant.BusinessID)
+
+	second, duplicate, err := insertCallback(ctx, tx, nil, "va", "something", "{}", "merchant1", "key0")
+	testutil.Ok(t, err)
+	testutil.Asserts(t, duplicate, "second insert should be a duplicate")
+	testutil.Asserts(t, second == nil, "duplicate should not be stored")
+
+	// callbacks without idempotency key are always stored
+	for i := 0; i < 2; i++ {
+		_, duplicate, err = insertCallback(ctx, tx, nil, "va", "something", "{}", "merchant1", "")
+		testutil.Ok(t, err)
+		testutil.Asserts(t, !duplicate, "callback without key should not be a duplicate")
+	}
+
+	count, err := bmodels.Messages(bmodels.MessageWhere.MerchantID.EQ(merchant.ID)).Count(ctx, tx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, int64(3), count)
+}
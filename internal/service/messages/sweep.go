@@ -0,0 +1,50 @@
+package messages
+
+import (
+	"context"
+	"time"
+
+	"github.com/kagelui/notification/internal/models/bmodels"
+)
+
+// the retried messages claimed by a run which stopped before delivering them are left pending, first attempts are
+// left to the queue which redelivers them
+const sweepStuckPendingQuery = `UPDATE messages SET status = $3, updated_at = $4
+WHERE status = $1 AND retry_count > 0 AND updated_at < $2`
+
+// the claim of the message is told apart from a later claim of another run by its update time
+const startRetryQuery = `UPDATE messages SET updated_at = $5
+WHERE id = $1 AND created_at = $2 AND status = $3 AND updated_at = $4`
+
+// SweepStuckPending marks failed the retried messages pending since before olderThan, so that they are claimed again,
+// and returns their number. The update time of a message is refreshed by StartRetry as its delivery starts, so
+// olderThan must be beyond the longest delivery, i.e. twice the longest client timeout of the callback URLs with
+// OAuth2, not to retry the messages in flight
+func SweepStuckPending(ctx context.Context, db Inquirer, olderThan time.Duration) (int, error) {
+	now := time.Now()
+	result, err := db.ExecContext(ctx, sweepStuckPendingQuery, MessageDeliveryStatusPending,
+		now.Add(-olderThan), MessageDeliveryStatusFailed, now)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// StartRetry refreshes the update time of the message claimed by ClaimRetryBatch as its delivery starts, the claimed
+// messages waiting for a runner may be swept meanwhile. It returns false when the message was swept, and maybe claimed
+// by another run since, in which case it must not be delivered
+func StartRetry(ctx context.Context, db Inquirer, message *bmodels.Message) (bool, error) {
+	now := time.Now()
+	result, err := db.ExecContext(ctx, startRetryQuery, message.ID, message.CreatedAt, MessageDeliveryStatusPending,
+		message.UpdatedAt, now)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	message.UpdatedAt = now
+	return true, nil
+}
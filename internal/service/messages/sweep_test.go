@@ -0,0 +1,111 @@
+package messages
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kagelui/notification/internal/models/bmodels"
+	"github.com/kagelui/notification/internal/testutil"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/types"
+)
+
+func TestSweepStuckPending(t *testing.T) {
+	ctx := context.TODO()
+	tx := db.MustBegin()
+	defer tx.Rollback()
+
+	merchant := bmodels.Merchant{ID: 92143, BusinessID: "merchant6", Token: "some token"}
+	testutil.Ok(t, merchant.Insert(ctx, tx, boil.Infer()))
+	payloadJSON := types.JSON{}
+	testutil.Ok(t, payloadJSON.Marshal("{}"))
+
+	now := time.Now()
+	message := func(status string, retryCount int, updated time.Time) bmodels.Message {
+		m := bmodels.Message{ID: uuid.New().String(), ProductID: "va", ProductType: "something", Payload: payloadJSON,
+			MerchantID: merchant.ID, RetryCount: retryCount, NextDeliveryTime: now.Add(-time.Hour), Status: status,
+			CreatedAt: now.Add(-2 * time.Hour), UpdatedAt: updated}
+		testutil.Ok(t, m.Insert(ctx, tx, boil.Infer()))
+		return m
+	}
+	stuck := message(MessageDeliveryStatusPending, 1, now.Add(-time.Hour))
+	tests := []struct {
+		name    string
+		message bmodels.Message
+		want    string
+	}{
+		{name: "stuck retry", message: stuck, want: MessageDeliveryStatusFailed},
+		{name: "retry in flight", message: message(MessageDeliveryStatusPending, 1, now.Add(-time.Second)), want: MessageDeliveryStatusPending},
+		{name: "first attempt", message: message(MessageDeliveryStatusPending, 0, now.Add(-time.Hour)), want: MessageDeliveryStatusPending},
+		{name: "delivered", message: message(MessageDeliveryStatusSuccess, 1, now.Add(-time.Hour)), want: MessageDeliveryStatusSuccess},
+	}
+
+	n, err := SweepStuckPending(ctx, tx, 15*time.Minute)
+	testutil.Ok(t, err)
+	testutil.Asserts(t, n >= 1, "stuck messages should be swept: %d", n)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.Ok(t, tt.message.Reload(ctx, tx))
+			testutil.Equals(t, tt.want, tt.message.Status)
+		})
+	}
+
+	// the swept messages are due again
+	batch, _, err := ClaimRetryBatch(ctx, tx, RetryCursor{}, 1000)
+	testutil.Ok(t, err)
+	var claimed bool
+	for _, m := range batch {
+		claimed = claimed || m.ID == stuck.ID
+	}
+	testutil.Asserts(t, claimed, "swept message %s should be claimed", stuck.ID)
+}
+
+func TestStartRetry(t *testing.T) {
+	ctx := context.TODO()
+	tx := db.MustBegin()
+	defer tx.Rollback()
+
+	merchant := bmodels.Merchant{ID: 92144, BusinessID: "merchant7", Token: "some token"}
+	testutil.Ok(t, merchant.Insert(ctx, tx, boil.Infer()))
+	payloadJSON := types.JSON{}
+	testutil.Ok(t, payloadJSON.Marshal("{}"))
+
+	now := time.Now()
+	m := bmodels.Message{ID: uuid.New().String(), ProductID: "va", ProductType: "something", Payload: payloadJSON,
+		MerchantID: merchant.ID, RetryCount: 1, NextDeliveryTime: now.Add(-time.Hour), Status: MessageDeliveryStatusFailed,
+		CreatedAt: now.Add(-2 * time.Hour), UpdatedAt: now.Add(-time.Hour)}
+	testutil.Ok(t, m.Insert(ctx, tx, boil.Infer()))
+
+	batch, _, err := ClaimRetryBatch(ctx, tx, RetryCursor{}, 1000)
+	testutil.Ok(t, err)
+	var claimed, reclaimed *bmodels.Message
+	for _, c := range batch {
+		if c.ID == m.ID {
+			claimed = c
+		}
+	}
+	testutil.Asserts(t, claimed != nil, "message %s should be claimed", m.ID)
+
+	// the message waits for a runner until it is swept and claimed again
+	_, err = tx.Exec("UPDATE messages SET updated_at = $2 WHERE id = $1", m.ID, now.Add(-time.Hour))
+	testutil.Ok(t, err)
+	_, err = SweepStuckPending(ctx, tx, 15*time.Minute)
+	testutil.Ok(t, err)
+	batch, _, err = ClaimRetryBatch(ctx, tx, RetryCursor{}, 1000)
+	testutil.Ok(t, err)
+	for _, c := range batch {
+		if c.ID == m.ID {
+			reclaimed = c
+		}
+	}
+	testutil.Asserts(t, reclaimed != nil, "swept message %s should be claimed again", m.ID)
+
+	started, err := StartRetry(ctx, tx, claimed)
+	testutil.Ok(t, err)
+	testutil.Asserts(t, !started, "the first claim should no longer be held")
+	started, err = StartRetry(ctx, tx, reclaimed)
+	testutil.Ok(t, err)
+	testutil.Asserts(t, started, "the second claim should be held")
+}
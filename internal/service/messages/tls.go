@@ -0,0 +1,279 @@
+package messages
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kagelui/notification/internal/models/bmodels"
+	"github.com/volatiletech/sqlboiler/v4/queries/qm"
+)
+
+// Kinds of the certificates reported by CertificateExpiries
+const (
+	CertificateKindClient = "client"
+	CertificateKindCA     = "ca"
+)
+
+// defaultTransports is shared by the callback clients without their own TransportCache
+var defaultTransports = NewTransportCache()
+
+// tlsFiles are the client certificate, key and CA bundle paths of a callback URL
+type tlsFiles struct {
+	cert, key, ca string
+}
+
+func endpointTLSFiles(url *bmodels.CallbackURL) tlsFiles {
+	return tlsFiles{cert: url.TLSClientCert, key: url.TLSClientKey, ca: url.TLSCABundle}
+}
+
+func (f tlsFiles) empty() bool {
+	return f.cert == "" && f.key == "" && f.ca == ""
+}
+
+// modTime returns the latest modification time of the files, so that replaced files get a new transport
+func (f tlsFiles) modTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{f.cert, f.key, f.ca} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// the TLS files are checked for replacement at most once per tlsRecheckInterval, the least recently used
+// transports are evicted past maxTransports
+const (
+	tlsRecheckInterval = time.Minute
+	maxTransports      = 256
+)
+
+// transportKey identifies the transport of the TLS files built from the base transport
+type transportKey struct {
+	files tlsFiles
+	base  *http.Transport
+}
+
+type cachedTransport struct {
+	transport *http.Transport
+	modTime   time.Time
+	checkedAt time.Time
+	usedAt    time.Time
+}
+
+// TransportCache builds the transports of the callback URLs presenting a client certificate or trusting a
+// private CA bundle, and keeps them so that connections are reused across callbacks
+type TransportCache struct {
+	mu         sync.Mutex
+	transports map[transportKey]*cachedTransport
+	now        func() time.Time
+}
+
+// NewTransportCache returns an empty TransportCache
+func NewTransportCache() *TransportCache {
+	return &TransportCache{transports: make(map[transportKey]*cachedTransport), now: time.Now}
+}
+
+// Client returns the client calling the callback URL, which is base unless the URL has TLS settings.
+// The transport of base is cloned, http.DefaultTransport is when base has none or a custom round tripper
+func (c *TransportCache) Client(base *http.Client, url *bmodels.CallbackURL) (*http.Client, error) {
+	files := endpointTLSFiles(url)
+	if files.empty() {
+		return base, nil
+	}
+	baseTransport, ok := base.Transport.(*http.Transport)
+	if !ok {
+		baseTransport = http.DefaultTransport.(*http.Transport)
+	}
+	transport, err := c.transport(transportKey{files: files, base: baseTransport})
+	if err != nil {
+		return nil, fmt.Errorf("TLS settings of callback URL %d: %v", url.ID, err)
+	}
+	client := *base
+	client.Transport = transport
+	return &client, nil
+}
+
+func (c *TransportCache) transport(key transportKey) (*http.Transport, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	cached, ok := c.transports[key]
+	if ok && now.Sub(cached.checkedAt) < tlsRecheckInterval {
+		cached.usedAt = now
+		return cached.transport, nil
+	}
+
+	modTime, err := key.files.modTime()
+	if err != nil {
+		return nil, err
+	}
+	if ok && cached.modTime.Equal(modTime) {
+		cached.checkedAt, cached.usedAt = now, now
+		return cached.transport, nil
+	}
+
+	config, err := key.files.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := key.base.Clone()
+	transport.TLSClientConfig = config
+	if ok {
+		cached.transport.CloseIdleConnections()
+	} else if len(c.transports) >= maxTransports {
+		c.evict()
+	}
+	c.transports[key] = &cachedTransport{transport: transport, modTime: modTime, checkedAt: now, usedAt: now}
+	return transport, nil
+}
+
+// evict removes the least recently used transport
+func (c *TransportCache) evict() {
+	var oldest transportKey
+	var oldestAt time.Time
+	for key, cached := range c.transports {
+		if oldestAt.IsZero() || cached.usedAt.Before(oldestAt) {
+			oldest, oldestAt = key, cached.usedAt
+		}
+	}
+	if cached, ok := c.transports[oldest]; ok {
+		cached.transport.CloseIdleConnections()
+		delete(c.transports, oldest)
+	}
+}
+
+// tlsConfig loads the client certificate and the CA bundle replacing the system roots
+func (f tlsFiles) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if f.cert != "" || f.key != "" {
+		if f.cert == "" || f.key == "" {
+			return nil, fmt.Errorf("both client certificate and key must be set")
+		}
+		cert, err := tls.LoadX509KeyPair(f.cert, f.key)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if f.ca != "" {
+		certs, err := readCertificates(f.ca)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		for _, cert := range certs {
+			pool.AddCert(cert)
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+// readCertificates parses the PEM certificates of the file
+func readCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate found in %s", path)
+	}
+	return certs, nil
+}
+
+// CertificateExpiry is the expiry of a certificate used to call a callback URL, Error is set when it cannot be read
+type CertificateExpiry struct {
+	CallbackURLID int       `json:"callback_url_id"`
+	BusinessID    string    `json:"business_id"`
+	ProductID     string    `json:"product_id"`
+	Kind          string    `json:"kind"`
+	Path          string    `json:"path"`
+	Subject       string    `json:"subject,omitempty"`
+	NotAfter      time.Time `json:"not_after"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// ExpiresWithin tells if the certificate is unreadable or expires before now+d
+func (e CertificateExpiry) ExpiresWithin(now time.Time, d time.Duration) bool {
+	return e.Error != "" || e.NotAfter.Before(now.Add(d))
+}
+
+// CertificateExpiries returns the expiry of the client certificates and CA bundles of the callback URLs,
+// the earliest first. The certificate of a CA bundle expiring first is reported
+func CertificateExpiries(ctx context.Context, db Inquirer) ([]CertificateExpiry, error) {
+	urls, err := bmodels.CallbackUrls(
+		bmodels.CallbackURLWhere.TLSClientCert.NEQ(""),
+		qm.Or2(bmodels.CallbackURLWhere.TLSCABundle.NEQ("")),
+	).All(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var expiries []CertificateExpiry
+	for _, url := range urls {
+		for _, f := range []struct{ kind, path string }{{CertificateKindClient, url.TLSClientCert}, {CertificateKindCA, url.TLSCABundle}} {
+			kind, path := f.kind, f.path
+			if path == "" {
+				continue
+			}
+			expiry := CertificateExpiry{CallbackURLID: url.ID, BusinessID: url.BusinessID, ProductID: url.ProductID, Kind: kind, Path: path}
+			certs, err := readCertificates(path)
+			if err != nil {
+				expiry.Error = err.Error()
+			} else {
+				// the leaf comes first in a client certificate chain
+				if kind == CertificateKindCA {
+					sort.Slice(certs, func(i, j int) bool { return certs[i].NotAfter.Before(certs[j].NotAfter) })
+				}
+				expiry.Subject = certs[0].Subject.String()
+				expiry.NotAfter = certs[0].NotAfter
+			}
+			expiries = append(expiries, expiry)
+		}
+	}
+	sort.SliceStable(expiries, func(i, j int) bool {
+		if (expiries[i].Error != "") != (expiries[j].Error != "") {
+			return expiries[i].Error != ""
+		}
+		return expiries[i].NotAfter.Before(expiries[j].NotAfter)
+	})
+	return expiries, nil
+}
+
+// CertificateExpiries returns the expiry of the certificates of the callback URLs
+func (m ModelStore) CertificateExpiries(ctx context.Context) ([]CertificateExpiry, error) {
+	return CertificateExpiries(ctx, m.DB)
+}
@@ -0,0 +1,265 @@
+package messages
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kagelui/notification/internal/models/bmodels"
+	"github.com/kagelui/notification/internal/testutil"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	tlsCert tls.Certificate
+}
+
+// newTestCert issues a certificate for 127.0.0.1, self-signed when parent is nil
+func newTestCert(t *testing.T, name string, notAfter time.Time, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	testutil.Ok(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+	issuer, issuerKey := template, key
+	if parent != nil {
+		issuer, issuerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, issuerKey)
+	testutil.Ok(t, err)
+	cert, err := x509.ParseCertificate(der)
+	testutil.Ok(t, err)
+	return &testCert{cert: cert, key: key, tlsCert: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}}
+}
+
+// write writes the certificate and its key to dir as <name>.crt and <name>.key
+func (c *testCert) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	testutil.Ok(t, err)
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	testutil.Ok(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0600))
+	testutil.Ok(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func TestTransportCache_Client(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "bank CA", time.Now().Add(time.Hour), nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	serverCert := newTestCert(t, "bank", time.Now().Add(time.Hour), ca)
+	clientCertFile, clientKeyFile := newTestCert(t, "notification", time.Now().Add(time.Hour), ca).write(t, dir, "client")
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert.tlsCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		url      bmodels.CallbackURL
+		wantErr  string
+		wantBody string
+		callErr  bool
+	}{
+		{
+			name:    "system roots",
+			url:     bmodels.CallbackURL{ID: 1},
+			callErr: true,
+		},
+		{
+			name:    "no client certificate",
+			url:     bmodels.CallbackURL{ID: 2, TLSCABundle: caFile},
+			callErr: true,
+		},
+		{
+			name:    "key without certificate",
+			url:     bmodels.CallbackURL{ID: 3, TLSClientKey: clientKeyFile},
+			wantErr: "TLS settings of callback URL 3: both client certificate and key must be set",
+		},
+		{
+			name:    "missing CA bundle",
+			url:     bmodels.CallbackURL{ID: 4, TLSCABundle: filepath.Join(dir, "nope.crt")},
+			wantErr: "TLS settings of callback URL 4: stat " + filepath.Join(dir, "nope.crt") + ": no such file or directory",
+		},
+		{
+			name:    "CA bundle without certificate",
+			url:     bmodels.CallbackURL{ID: 5, TLSCABundle: clientKeyFile},
+			wantErr: "TLS settings of callback URL 5: no certificate found in " + clientKeyFile,
+		},
+		{
+			name:     "mutual TLS",
+			url:      bmodels.CallbackURL{ID: 6, TLSClientCert: clientCertFile, TLSClientKey: clientKeyFile, TLSCABundle: caFile},
+			wantBody: "notification",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := &http.Client{Timeout: 5 * time.Second}
+			client, err := NewTransportCache().Client(base, &tt.url)
+			testutil.CompareError(t, tt.wantErr, err)
+			if err != nil {
+				return
+			}
+			testutil.Equals(t, base.Timeout, client.Timeout)
+
+			resp, err := client.Get(srv.URL)
+			testutil.Equals(t, tt.callErr, err != nil)
+			if err != nil {
+				return
+			}
+			defer resp.Body.Close()
+			body, err := ioutil.ReadAll(resp.Body)
+			testutil.Ok(t, err)
+			testutil.Equals(t, tt.wantBody, string(body))
+		})
+	}
+}
+
+func TestTransportCache_reuse(t *testing.T) {
+	dir := t.TempDir()
+	caFile, _ := newTestCert(t, "bank CA", time.Now().Add(time.Hour), nil).write(t, dir, "ca")
+	url := &bmodels.CallbackURL{TLSCABundle: caFile}
+	now := time.Now()
+	cache := NewTransportCache()
+	cache.now = func() time.Time { return now }
+
+	first, err := cache.Client(http.DefaultClient, url)
+	testutil.Ok(t, err)
+	second, err := cache.Client(http.DefaultClient, url)
+	testutil.Ok(t, err)
+	testutil.Asserts(t, first.Transport == second.Transport, "transport should be cached")
+
+	// the replaced bundle gets a new transport once it is checked again
+	newTestCert(t, "new bank CA", time.Now().Add(time.Hour), nil).write(t, dir, "ca")
+	later := time.Now().Add(time.Minute)
+	testutil.Ok(t, os.Chtimes(caFile, later, later))
+	third, err := cache.Client(http.DefaultClient, url)
+	testutil.Ok(t, err)
+	testutil.Asserts(t, first.Transport == third.Transport, "files should not be checked before the interval")
+
+	now = now.Add(tlsRecheckInterval)
+	fourth, err := cache.Client(http.DefaultClient, url)
+	testutil.Ok(t, err)
+	testutil.Asserts(t, first.Transport != fourth.Transport, "transport should be rebuilt")
+}
+
+func TestTransportCache_base(t *testing.T) {
+	caFile, _ := newTestCert(t, "bank CA", time.Now().Add(time.Hour), nil).write(t, t.TempDir(), "ca")
+	url := &bmodels.CallbackURL{TLSCABundle: caFile}
+	cache := NewTransportCache()
+
+	base := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: 42}}
+	client, err := cache.Client(base, url)
+	testutil.Ok(t, err)
+	transport := client.Transport.(*http.Transport)
+	testutil.Equals(t, 42, transport.MaxIdleConnsPerHost)
+	testutil.Asserts(t, transport.TLSClientConfig.RootCAs != nil, "CA bundle should be trusted")
+
+	// another client gets its own transport
+	other, err := cache.Client(http.DefaultClient, url)
+	testutil.Ok(t, err)
+	testutil.Asserts(t, other.Transport != client.Transport, "transport should be cloned from the client")
+}
+
+func TestTransportCache_evict(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	cache := NewTransportCache()
+	cache.now = func() time.Time { return now }
+
+	var urls []*bmodels.CallbackURL
+	for i := 0; i <= maxTransports; i++ {
+		caFile, _ := newTestCert(t, "bank CA", time.Now().Add(time.Hour), nil).write(t, dir, fmt.Sprintf("ca%d", i))
+		urls = append(urls, &bmodels.CallbackURL{TLSCABundle: caFile})
+	}
+	first, err := cache.Client(http.DefaultClient, urls[0])
+	testutil.Ok(t, err)
+	for _, url := range urls[1:maxTransports] {
+		now = now.Add(time.Second)
+		_, err := cache.Client(http.DefaultClient, url)
+		testutil.Ok(t, err)
+	}
+	// the first transport is used again so the second one is the least recently used
+	now = now.Add(time.Second)
+	_, err = cache.Client(http.DefaultClient, urls[0])
+	testutil.Ok(t, err)
+	_, err = cache.Client(http.DefaultClient, urls[maxTransports])
+	testutil.Ok(t, err)
+
+	testutil.Equals(t, maxTransports, len(cache.transports))
+	again, err := cache.Client(http.DefaultClient, urls[0])
+	testutil.Ok(t, err)
+	testutil.Asserts(t, first.Transport == again.Transport, "recently used transport should be kept")
+	_, ok := cache.transports[transportKey{files: endpointTLSFiles(urls[1]), base: http.DefaultTransport.(*http.Transport)}]
+	testutil.Asserts(t, !ok, "least recently used transport should be evicted")
+}
+
+func TestCertificateExpiries(t *testing.T) {
+	ctx := context.TODO()
+	dir := t.TempDir()
+	now := time.Now()
+	ca := newTestCert(t, "bank CA", now.Add(90*24*time.Hour), nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	clientFile, keyFile := newTestCert(t, "notification", now.Add(7*24*time.Hour), ca).write(t, dir, "client")
+
+	tx := db.MustBegin()
+	defer tx.Rollback()
+	for _, url := range []bmodels.CallbackURL{
+		{ID: 41001, BusinessID: "bank0", ProductID: "va", CallbackURL: "https://bank0", TLSClientCert: clientFile, TLSClientKey: keyFile, TLSCABundle: caFile},
+		{ID: 41002, BusinessID: "bank1", ProductID: "va", CallbackURL: "https://bank1", TLSCABundle: filepath.Join(dir, "nope.crt")},
+		{ID: 41003, BusinessID: "shop0", ProductID: "va", CallbackURL: "https://shop0"},
+	} {
+		testutil.Ok(t, url.Insert(ctx, tx, boil.Infer()))
+	}
+
+	got, err := CertificateExpiries(ctx, tx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 3, len(got))
+
+	testutil.Equals(t, 41002, got[0].CallbackURLID)
+	testutil.Equals(t, "open "+filepath.Join(dir, "nope.crt")+": no such file or directory", got[0].Error)
+	testutil.Asserts(t, got[0].ExpiresWithin(now, 0), "unreadable certificate should be flagged")
+
+	testutil.Equals(t, CertificateKindClient, got[1].Kind)
+	testutil.Equals(t, "CN=notification", got[1].Subject)
+	testutil.Asserts(t, got[1].ExpiresWithin(now, 30*24*time.Hour), "client certificate should expire within 30 days")
+	testutil.Asserts(t, !got[1].ExpiresWithin(now, 24*time.Hour), "client certificate should not expire within a day")
+
+	testutil.Equals(t, CertificateKindCA, got[2].Kind)
+	testutil.Equals(t, "CN=bank CA", got[2].Subject)
+}
@@ -0,0 +1,290 @@
+package messages
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kagelui/notification/internal/models/bmodels"
+	"github.com/kagelui/notification/internal/pkg/loglib"
+	"github.com/kagelui/notification/internal/pkg/secret"
+	"github.com/pkg/errors"
+)
+
+// signatureHeaderKey carries the HMAC-SHA256 signatures of the payload, one per active token of the merchant,
+// e.g. t=1620000000,v1=5257a8...,v1=9c1f0b... Merchants verify any of them during a rotation
+const signatureHeaderKey = "x-callback-signature"
+
+// tokenBytes is the entropy of the generated tokens
+const tokenBytes = 32
+
+const (
+	activeTokensQuery = `SELECT token, key_id FROM merchant_tokens
+WHERE merchant_id = $1 AND valid_from <= $2 AND (valid_until IS NULL OR valid_until > $2)
+ORDER BY valid_from DESC, id DESC`
+	merchantTokensQuery = `SELECT id, token, key_id, valid_from, valid_until FROM merchant_tokens
+WHERE merchant_id = $1 AND (valid_until IS NULL OR valid_until > $2)
+ORDER BY valid_from DESC, id DESC`
+	insertTokenQuery = `INSERT INTO merchant_tokens (merchant_id, token, key_id, valid_from) VALUES ($1, $2, $3, $4)
+RETURNING id`
+	expireTokensQuery = `UPDATE merchant_tokens SET valid_until = $3
+WHERE merchant_id = $1 AND id <> $2 AND valid_from < $3 AND (valid_until IS NULL OR valid_until > $3)`
+	updateMerchantTokenQuery = `UPDATE merchants SET token = $2, token_key_id = $3, updated_at = $4 WHERE id = $1`
+)
+
+// MerchantToken is a token of a merchant, it is valid from ValidFrom until ValidUntil if set
+type MerchantToken struct {
+	ID         int        `json:"id"`
+	Token      string     `json:"-"`
+	ValidFrom  time.Time  `json:"valid_from"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+}
+
+// Active tells if the token is valid at the time
+func (t MerchantToken) Active(now time.Time) bool {
+	return !t.ValidFrom.After(now) && (t.ValidUntil == nil || t.ValidUntil.After(now))
+}
+
+// Hint returns the last characters of the token, enough to tell tokens apart
+func (t MerchantToken) Hint() string {
+	if len(t.Token) <= 4 {
+		return strings.Repeat("*", len(t.Token))
+	}
+	return "..." + t.Token[len(t.Token)-4:]
+}
+
+// TokenRotation starts the rotation of a merchant token
+type TokenRotation struct {
+	// Token is the new token, a random one is generated when empty
+	Token string
+	// ValidFrom is when the new token is carried by the deliveries, now when zero
+	ValidFrom time.Time
+	// Overlap is how long the previous tokens remain valid after ValidFrom, until FinishTokenRotation when zero
+	Overlap time.Duration
+}
+
+// activeTokens returns the tokens of the merchant valid at the time, the newest first.
+// The token of the merchant is returned for merchants without token history, otherwise it is reconciled with the
+// newest token, as a rotation dated in the future becomes active without any call to the store
+func activeTokens(ctx context.Context, db Inquirer, keys *secret.Keyring, merchant *bmodels.Merchant, now time.Time) ([]string, error) {
+	rows, err := db.QueryContext(ctx, activeTokensQuery, merchant.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []string
+	for rows.Next() {
+		var token, keyID string
+		if err := rows.Scan(&token, &keyID); err != nil {
+			return nil, err
+		}
+		if token, err = openValue(keys, token, keyID); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		token, err := openValue(keys, merchant.Token, merchant.TokenKeyID)
+		if err != nil {
+			return nil, err
+		}
+		return []string{token}, nil
+	}
+	// the deliveries go on with a stale token of the merchant, which is reconciled again next time
+	if err := reconcileMerchantToken(ctx, db, keys, merchant, tokens[0], now); err != nil {
+		loglib.GetLogger(ctx).WarnF("error reconciling the token of merchant %v: %v", merchant.BusinessID, err.Error())
+	}
+	return tokens, nil
+}
+
+// reconcileMerchantToken stores the newest active token as the token of the merchant if it is not already
+func reconcileMerchantToken(ctx context.Context, db Inquirer, keys *secret.Keyring, merchant *bmodels.Merchant, newest string, now time.Time) error {
+	current, err := openValue(keys, merchant.Token, merchant.TokenKeyID)
+	if err == nil && current == newest {
+		return nil
+	}
+	return setMerchantToken(ctx, db, keys, merchant.ID, newest, now)
+}
+
+// signature returns the signature header of the payload signed with every token at the time
+func signature(tokens []string, at time.Time, payload string) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	parts := make([]string, 0, len(tokens)+1)
+	parts = append(parts, "t="+timestamp)
+	for _, token := range tokens {
+		mac := hmac.New(sha256.New, []byte(token))
+		mac.Write([]byte(timestamp + "." + payload))
+		parts = append(parts, "v1="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	return strings.Join(parts, ",")
+}
+
+// GenerateToken returns a random URL safe token
+func GenerateToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// RotateToken adds a new token to the merchant, the previous ones stay valid for the overlap of the rotation
+// or until FinishTokenRotation
+func (m ModelStore) RotateToken(ctx context.Context, businessID string, rotation TokenRotation) (MerchantToken, error) {
+	now := time.Now()
+	token := MerchantToken{Token: rotation.Token, ValidFrom: rotation.ValidFrom}
+	if token.ValidFrom.IsZero() {
+		token.ValidFrom = now
+	}
+	if token.Token == "" {
+		var err error
+		if token.Token, err = GenerateToken(); err != nil {
+			return token, err
+		}
+	}
+
+	err := withTx(ctx, m.DB, func(tx Inquirer) error {
+		merchant, err := findMerchant(ctx, tx, businessID)
+		if err != nil {
+			return err
+		}
+		sealed, keyID, err := sealValue(m.Keys, token.Token)
+		if err != nil {
+			return err
+		}
+		if err = tx.QueryRowContext(ctx, insertTokenQuery, merchant.ID, sealed, keyID, token.ValidFrom).Scan(&token.ID); err != nil {
+			return err
+		}
+		if rotation.Overlap > 0 {
+			if _, err = tx.ExecContext(ctx, expireTokensQuery, merchant.ID, token.ID, token.ValidFrom.Add(rotation.Overlap)); err != nil {
+				return err
+			}
+		}
+		// the token of the merchant follows the token carried by the deliveries
+		if !token.ValidFrom.After(now) {
+			err = setMerchantToken(ctx, tx, m.Keys, merchant.ID, token.Token, now)
+		}
+		return err
+	})
+	return token, err
+}
+
+// FinishTokenRotation expires every token of the merchant but the newest active one, which is returned
+func (m ModelStore) FinishTokenRotation(ctx context.Context, businessID string) (MerchantToken, error) {
+	now := time.Now()
+	var newest MerchantToken
+	err := withTx(ctx, m.DB, func(tx Inquirer) error {
+		merchant, err := findMerchant(ctx, tx, businessID)
+		if err != nil {
+			return err
+		}
+		tokens, err := merchantTokens(ctx, tx, m.Keys, merchant.ID, now)
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, t := range tokens {
+			if t.Active(now) {
+				newest, found = t, true
+				break
+			}
+		}
+		if !found {
+			return ErrNoActiveToken
+		}
+		if _, err = tx.ExecContext(ctx, expireTokensQuery, merchant.ID, newest.ID, now); err != nil {
+			return err
+		}
+		return setMerchantToken(ctx, tx, m.Keys, merchant.ID, newest.Token, now)
+	})
+	return newest, err
+}
+
+// MerchantTokens returns the tokens of the merchant which are active or not yet valid, the newest first
+func (m ModelStore) MerchantTokens(ctx context.Context, businessID string) ([]MerchantToken, error) {
+	merchant, err := findMerchant(ctx, m.DB, businessID)
+	if err != nil {
+		return nil, err
+	}
+	return merchantTokens(ctx, m.DB, m.Keys, merchant.ID, time.Now())
+}
+
+func merchantTokens(ctx context.Context, db Inquirer, keys *secret.Keyring, merchantID int, now time.Time) ([]MerchantToken, error) {
+	rows, err := db.QueryContext(ctx, merchantTokensQuery, merchantID, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []MerchantToken
+	for rows.Next() {
+		var t MerchantToken
+		var keyID string
+		var validUntil sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Token, &keyID, &t.ValidFrom, &validUntil); err != nil {
+			return nil, err
+		}
+		if t.Token, err = openValue(keys, t.Token, keyID); err != nil {
+			return nil, err
+		}
+		if validUntil.Valid {
+			t.ValidUntil = &validUntil.Time
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// setMerchantToken stores the token of the merchant, sealed when a keyring is configured
+func setMerchantToken(ctx context.Context, db Inquirer, keys *secret.Keyring, merchantID int, token string, now time.Time) error {
+	sealed, keyID, err := sealValue(keys, token)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, updateMerchantTokenQuery, merchantID, sealed, keyID, now)
+	return err
+}
+
+func findMerchant(ctx context.Context, db Inquirer, businessID string) (*bmodels.Merchant, error) {
+	merchant, err := bmodels.Merchants(bmodels.MerchantWhere.BusinessID.EQ(businessID)).One(ctx, db)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUnknownMerchant
+	}
+	return merchant, err
+}
+
+// txBeginner is implemented by *sql.DB and *sqlx.DB, but not by transactions
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// withTx runs f in a transaction, or in the transaction db already is
+func withTx(ctx context.Context, db Inquirer, f func(tx Inquirer) error) error {
+	beginner, ok := db.(txBeginner)
+	if !ok {
+		return f(db)
+	}
+	tx, err := beginner.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("%v, rollback: %v", err, rbErr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
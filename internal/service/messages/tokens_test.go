@@ -0,0 +1,148 @@
+package messages
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/kagelui/notification/internal/models/bmodels"
+	"github.com/kagelui/notification/internal/testutil"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+)
+
+func TestSignature(t *testing.T) {
+	at := time.Unix(1620000000, 0)
+	sign := func(token string) string {
+		mac := hmac.New(sha256.New, []byte(token))
+		mac.Write([]byte("1620000000.{}"))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	tests := []struct {
+		name     string
+		tokens   []string
+		expected string
+	}{
+		{
+			name:     "one token",
+			tokens:   []string{"new token"},
+			expected: "t=1620000000,v1=" + sign("new token"),
+		},
+		{
+			name:     "rotation",
+			tokens:   []string{"new token", "old token"},
+			expected: "t=1620000000,v1=" + sign("new token") + ",v1=" + sign("old token"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.Equals(t, tt.expected, signature(tt.tokens, at, "{}"))
+		})
+	}
+}
+
+func TestMerchantToken(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	tests := []struct {
+		name         string
+		token        MerchantToken
+		expectedHint string
+		expectActive bool
+	}{
+		{
+			name:         "active",
+			token:        MerchantToken{Token: "some token", ValidFrom: past},
+			expectedHint: "...oken",
+			expectActive: true,
+		},
+		{
+			name:         "expiring",
+			token:        MerchantToken{Token: "some token", ValidFrom: past, ValidUntil: &future},
+			expectedHint: "...oken",
+			expectActive: true,
+		},
+		{
+			name:         "expired",
+			token:        MerchantToken{Token: "some token", ValidFrom: past, ValidUntil: &past},
+			expectedHint: "...oken",
+		},
+		{
+			name:         "upcoming short token",
+			token:        MerchantToken{Token: "abc", ValidFrom: future},
+			expectedHint: "***",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.Equals(t, tt.expectedHint, tt.token.Hint())
+			testutil.Equals(t, tt.expectActive, tt.token.Active(now))
+		})
+	}
+}
+
+func TestModelStore_RotateToken(t *testing.T) {
+	ctx := context.TODO()
+	tx := db.MustBegin()
+	defer tx.Rollback()
+
+	merchant := bmodels.Merchant{ID: 92137, BusinessID: "merchant0", Token: "old token"}
+	testutil.Ok(t, merchant.Insert(ctx, tx, boil.Infer()))
+	store := ModelStore{DB: tx}
+
+	// merchants without token history use their token
+	tokens, err := activeTokens(ctx, tx, nil, &merchant, time.Now())
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"old token"}, tokens)
+
+	_, err = store.RotateToken(ctx, "merchant1", TokenRotation{})
+	testutil.Equals(t, ErrUnknownMerchant, err)
+
+	_, err = store.RotateToken(ctx, "merchant0", TokenRotation{Token: "old token", ValidFrom: time.Now().Add(-time.Hour)})
+	testutil.Ok(t, err)
+	rotated, err := store.RotateToken(ctx, "merchant0", TokenRotation{})
+	testutil.Ok(t, err)
+	testutil.Asserts(t, len(rotated.Token) > 32, "generated token too short: %v", rotated.Token)
+
+	// both tokens sign the deliveries until the rotation is finished
+	tokens, err = activeTokens(ctx, tx, nil, &merchant, time.Now())
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{rotated.Token, "old token"}, tokens)
+	testutil.Ok(t, merchant.Reload(ctx, tx))
+	testutil.Equals(t, rotated.Token, merchant.Token)
+
+	finished, err := store.FinishTokenRotation(ctx, "merchant0")
+	testutil.Ok(t, err)
+	testutil.Equals(t, rotated.ID, finished.ID)
+	tokens, err = activeTokens(ctx, tx, nil, &merchant, time.Now())
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{rotated.Token}, tokens)
+
+	// the previous tokens expire on their own after the overlap
+	overlapped, err := store.RotateToken(ctx, "merchant0", TokenRotation{Token: "next token", Overlap: time.Minute})
+	testutil.Ok(t, err)
+	tokens, err = activeTokens(ctx, tx, nil, &merchant, time.Now().Add(2*time.Minute))
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"next token"}, tokens)
+
+	listed, err := store.MerchantTokens(ctx, "merchant0")
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(listed))
+	testutil.Equals(t, overlapped.ID, listed[0].ID)
+	testutil.Equals(t, rotated.ID, listed[1].ID)
+	testutil.Asserts(t, listed[1].ValidUntil != nil, "previous token not expiring")
+
+	// a rotation dated in the future becomes the token of the merchant once it is active
+	testutil.Ok(t, merchant.Reload(ctx, tx))
+	_, err = store.RotateToken(ctx, "merchant0", TokenRotation{Token: "future token", ValidFrom: time.Now().Add(time.Hour)})
+	testutil.Ok(t, err)
+	testutil.Ok(t, merchant.Reload(ctx, tx))
+	testutil.Equals(t, "next token", merchant.Token)
+	tokens, err = activeTokens(ctx, tx, nil, &merchant, time.Now().Add(2*time.Hour))
+	testutil.Ok(t, err)
+	testutil.Equals(t, "future token", tokens[0])
+	testutil.Ok(t, merchant.Reload(ctx, tx))
+	testutil.Equals(t, "future token", merchant.Token)
+}
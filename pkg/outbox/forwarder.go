@@ -0,0 +1,128 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// Forwarder hands an outbox message over to the notification service
+type Forwarder interface {
+	Forward(ctx context.Context, m Message) error
+}
+
+// HTTPForwarder forwards messages to the callback endpoint of serverd, e.g. http://notification:8080/callback
+type HTTPForwarder struct {
+	URL    string
+	Client *http.Client
+}
+
+type callbackRequest struct {
+	ProductID      string `json:"product_id"`
+	ProductType    string `json:"product_type"`
+	Payload        string `json:"payload"`
+	BusinessID     string `json:"business_id"`
+	IdempotencyKey string `json:"idempotency_key"`
+}
+
+// Forward implements Forwarder
+func (f HTTPForwarder) Forward(ctx context.Context, m Message) error {
+	body, err := json.Marshal(callbackRequest{
+		ProductID:      m.ProductID,
+		ProductType:    m.ProductType,
+		Payload:        m.Payload,
+		BusinessID:     m.BusinessID,
+		IdempotencyKey: m.IdempotencyKey,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.URL, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(idempotencyKeyHeader, m.IdempotencyKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("forward error: %v, response: %v", resp.StatusCode, string(data))
+	}
+	return nil
+}
+
+// ErrUnknownMerchant is returned by SQLForwarder when the business ID has no merchant in the notification database
+var ErrUnknownMerchant = errors.New("unknown merchant")
+
+// the message is stored due for retry so that hermes delivers it, woken by the database, as it does not retry the
+// pending messages. A key already stored is skipped, a concurrent insert of the key fails on its unique index
+const insertMessageQuery = `WITH merchant AS (SELECT id FROM merchants WHERE business_id = $1),
+inserted AS (
+    INSERT INTO messages (id, product_id, product_type, payload, payload_key_id, merchant_id, retry_count,
+                          next_delivery_time, status, idempotency_key, created_at, updated_at)
+    SELECT $2, $3, $4, $5::jsonb, $6, merchant.id, 0, now(), 'FAILED', $7, now(), now()
+    FROM merchant
+    WHERE NOT EXISTS (SELECT 1 FROM message_idempotency_keys k WHERE k.merchant_id = merchant.id AND k.idempotency_key = $7)
+    RETURNING id)
+SELECT (SELECT count(*) FROM merchant), (SELECT count(*) FROM inserted)`
+
+// SQLForwarder inserts the messages directly into the notification database, for the producers sharing it. The
+// messages are delivered by hermes rather than right away, their first attempt being stored as a due retry
+type SQLForwarder struct {
+	// DB is the notification database
+	DB *sql.DB
+	// Keys seals the payloads with the keyring of the notification service, they are stored in plaintext when nil
+	// as by a notification service without KEYRING_FILE
+	Keys Sealer
+}
+
+// Forward implements Forwarder
+func (f SQLForwarder) Forward(ctx context.Context, m Message) error {
+	payload, keyID, err := messagePayload(f.Keys, m.Payload)
+	if err != nil {
+		return err
+	}
+	var merchants, inserted int
+	if err := f.DB.QueryRowContext(ctx, insertMessageQuery, m.BusinessID, uuid.New().String(), m.ProductID, m.ProductType,
+		payload, keyID, m.IdempotencyKey).Scan(&merchants, &inserted); err != nil {
+		return err
+	}
+	if merchants == 0 {
+		return fmt.Errorf("%w %q", ErrUnknownMerchant, m.BusinessID)
+	}
+	return nil
+}
+
+// messagePayload returns the payload column of the messages table, which stores the payload as a JSON string, sealed
+// or not, and the ID of the sealing key
+func messagePayload(keys Sealer, payload string) (string, string, error) {
+	value, err := json.Marshal(payload)
+	if err != nil || keys == nil {
+		return string(value), "", err
+	}
+	keyID, sealed, err := keys.Seal(string(value))
+	if err != nil {
+		return "", "", err
+	}
+	value, err = json.Marshal(sealed)
+	return string(value), keyID, err
+}
@@ -0,0 +1,78 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/kagelui/notification/internal/pkg/secret"
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+func TestHTTPForwarder_Forward(t *testing.T) {
+	given := Message{
+		IdempotencyKey: "key0",
+		BusinessID:     "user00",
+		ProductID:      "va",
+		ProductType:    "created",
+		Payload:        "{}",
+	}
+	tests := []struct {
+		name       string
+		statusCode int
+		wantErr    string
+	}{
+		{name: "success", statusCode: http.StatusOK, wantErr: ""},
+		{name: "fail", statusCode: http.StatusInternalServerError, wantErr: "forward error: 500, response: mock error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := HTTPForwarder{
+				URL: "http://notification/callback",
+				Client: testutil.NewTestClient(func(req *http.Request) *http.Response {
+					testutil.Equals(t, "http://notification/callback", req.URL.String())
+					testutil.Equals(t, "key0", req.Header.Get(idempotencyKeyHeader))
+
+					var body callbackRequest
+					testutil.Ok(t, json.NewDecoder(req.Body).Decode(&body))
+					testutil.Equals(t, callbackRequest{
+						ProductID:      "va",
+						ProductType:    "created",
+						Payload:        "{}",
+						BusinessID:     "user00",
+						IdempotencyKey: "key0",
+					}, body)
+
+					return &http.Response{
+						StatusCode: tt.statusCode,
+						Body:       ioutil.NopCloser(bytes.NewBufferString("mock error")),
+					}
+				}),
+			}
+			testutil.CompareError(t, tt.wantErr, f.Forward(context.TODO(), given))
+		})
+	}
+}
+
+func TestMessagePayload(t *testing.T) {
+	keys, err := secret.NewKeyring(secret.Key{ID: "k1", Key: bytes.Repeat([]byte{1}, secret.KeySize)})
+	testutil.Ok(t, err)
+
+	payload, keyID, err := messagePayload(nil, `{"a":1}`)
+	testutil.Ok(t, err)
+	testutil.Equals(t, `"{\"a\":1}"`, payload)
+	testutil.Equals(t, "", keyID)
+
+	// sealed payloads are stored as JSON strings, as by the notification service
+	payload, keyID, err = messagePayload(keys, `{"a":1}`)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "k1", keyID)
+	var sealed string
+	testutil.Ok(t, json.Unmarshal([]byte(payload), &sealed))
+	opened, err := keys.Open(keyID, sealed)
+	testutil.Ok(t, err)
+	testutil.Equals(t, `"{\"a\":1}"`, opened)
+}
@@ -0,0 +1,107 @@
+// Package outbox lets producers request notifications consistently with their business state.
+//
+// Callback requests are written into an outbox table inside the producer's own transaction with Enqueue,
+// and a Relay forwards them to the notification service afterwards with at-least-once semantics, over HTTP with
+// HTTPForwarder or straight into its database with SQLForwarder for the producers sharing it.
+// Every message carries an idempotency key so that redelivered requests are only stored once. Payloads are sealed
+// when a keyring is given, like the payloads stored by the notification service.
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/kagelui/notification/internal/pkg/secret"
+)
+
+// Schema creates the outbox table, it has to be applied to the producer's database
+const Schema = `
+CREATE TABLE IF NOT EXISTS notification_outbox
+(
+    id              BIGSERIAL PRIMARY KEY,
+    idempotency_key TEXT UNIQUE              NOT NULL CHECK (idempotency_key::TEXT <> ''::TEXT),
+    business_id     TEXT                     NOT NULL CHECK (business_id::TEXT <> ''::TEXT),
+    product_id      TEXT                     NOT NULL CHECK (product_id::TEXT <> ''::TEXT),
+    product_type    TEXT                     NOT NULL CHECK (product_type::TEXT <> ''::TEXT),
+    payload         TEXT                     NOT NULL,
+    payload_key_id  TEXT                     NOT NULL DEFAULT '',
+    attempts        INTEGER                  NOT NULL DEFAULT 0,
+    last_error      TEXT                     NOT NULL DEFAULT '',
+    created_at      TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    dispatched_at   TIMESTAMP WITH TIME ZONE
+);
+-- claimed_until leases the claimed messages to a relay, parked_at marks the messages which exhausted their attempts
+ALTER TABLE notification_outbox ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMP WITH TIME ZONE;
+ALTER TABLE notification_outbox ADD COLUMN IF NOT EXISTS parked_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE notification_outbox ADD COLUMN IF NOT EXISTS payload_key_id TEXT NOT NULL DEFAULT '';
+DROP INDEX IF EXISTS notification_outbox_undispatched_index;
+CREATE INDEX IF NOT EXISTS notification_outbox_pending_index ON notification_outbox (id)
+    WHERE dispatched_at IS NULL AND parked_at IS NULL;
+`
+
+const insertQuery = `INSERT INTO notification_outbox (idempotency_key, business_id, product_id, product_type, payload, payload_key_id)
+VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (idempotency_key) DO NOTHING`
+
+// Message is a callback request waiting in the outbox
+type Message struct {
+	IdempotencyKey string
+	BusinessID     string
+	ProductID      string
+	ProductType    string
+	Payload        string
+}
+
+// Executor unifies *sql.Tx and *sqlx.Tx
+type Executor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Sealer seals the payloads stored in the outbox and opens them before they are forwarded, the ID of the sealing key
+// is stored next to the payload
+type Sealer interface {
+	Seal(plaintext string) (keyID, sealed string, err error)
+	Open(keyID, sealed string) (string, error)
+}
+
+// LoadKeyring reads a keyring file in the format of KEYRING_FILE of the notification service. A nil Sealer is
+// returned for an empty path
+func LoadKeyring(path string) (Sealer, error) {
+	keys, err := secret.LoadKeyring(path)
+	if err != nil || keys == nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Enqueue writes the message into the outbox using the producer's transaction and returns its idempotency key.
+// A key is generated when the message has none, enqueuing a key twice stores the message once. The payload is sealed
+// with keys, it is stored in plaintext when keys is nil
+func Enqueue(ctx context.Context, tx Executor, keys Sealer, m Message) (string, error) {
+	if m.IdempotencyKey == "" {
+		m.IdempotencyKey = uuid.New().String()
+	}
+	payload, keyID := m.Payload, ""
+	if keys != nil {
+		var err error
+		if keyID, payload, err = keys.Seal(m.Payload); err != nil {
+			return "", err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, insertQuery, m.IdempotencyKey, m.BusinessID, m.ProductID, m.ProductType, payload, keyID); err != nil {
+		return "", err
+	}
+	return m.IdempotencyKey, nil
+}
+
+// openPayload returns the payload of the message stored by Enqueue
+func openPayload(keys Sealer, payload, keyID string) (string, error) {
+	if keyID == "" {
+		return payload, nil
+	}
+	if keys == nil {
+		return "", fmt.Errorf("payload sealed by key %q but the relay has no keyring", keyID)
+	}
+	return keys.Open(keyID, payload)
+}
@@ -0,0 +1,60 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/kagelui/notification/internal/pkg/secret"
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+type mockExecutor struct {
+	args []interface{}
+}
+
+func (e *mockExecutor) ExecContext(_ context.Context, _ string, args ...interface{}) (sql.Result, error) {
+	e.args = args
+	return nil, nil
+}
+
+func TestEnqueue(t *testing.T) {
+	keys, err := secret.NewKeyring(secret.Key{ID: "k1", Key: bytes.Repeat([]byte{1}, secret.KeySize)})
+	testutil.Ok(t, err)
+	given := Message{IdempotencyKey: "key0", BusinessID: "user00", ProductID: "va", ProductType: "created", Payload: `{"a":1}`}
+
+	tests := []struct {
+		name      string
+		keys      Sealer
+		wantKeyID string
+	}{
+		{name: "plaintext", keys: nil, wantKeyID: ""},
+		{name: "sealed", keys: keys, wantKeyID: "k1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := &mockExecutor{}
+			key, err := Enqueue(context.TODO(), tx, tt.keys, given)
+			testutil.Ok(t, err)
+			testutil.Equals(t, "key0", key)
+
+			payload, keyID := tx.args[4].(string), tx.args[5].(string)
+			testutil.Equals(t, tt.wantKeyID, keyID)
+			testutil.Asserts(t, (keyID == "") == (payload == given.Payload), "payload %q with key %q", payload, keyID)
+
+			opened, err := openPayload(tt.keys, payload, keyID)
+			testutil.Ok(t, err)
+			testutil.Equals(t, given.Payload, opened)
+		})
+	}
+
+	_, err = openPayload(nil, "env:v1:sealed", "k1")
+	testutil.CompareError(t, "the relay has no keyring", err)
+}
+
+func TestLoadKeyring(t *testing.T) {
+	keys, err := LoadKeyring("")
+	testutil.Ok(t, err)
+	testutil.Asserts(t, keys == nil, "an empty path should give a nil Sealer")
+}
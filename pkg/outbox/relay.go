@@ -0,0 +1,194 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+)
+
+// default settings of Relay
+const (
+	defaultBatchSize   = 100
+	defaultInterval    = 5 * time.Second
+	defaultMaxAttempts = 10
+	defaultLease       = 5 * time.Minute
+	// maxRetryDelay bounds the delay between the attempts of a message
+	maxRetryDelay = time.Hour
+)
+
+const (
+	// pending messages are leased by the claim so that several relays can run concurrently, and a relay which stops
+	// before marking its messages only delays them until the lease expires
+	claimQuery = `UPDATE notification_outbox o SET claimed_until = now() + make_interval(secs => $2), attempts = o.attempts + 1
+FROM (SELECT id FROM notification_outbox
+      WHERE dispatched_at IS NULL AND parked_at IS NULL AND (claimed_until IS NULL OR claimed_until < now())
+      ORDER BY id LIMIT $1
+      FOR UPDATE SKIP LOCKED) pending
+WHERE o.id = pending.id
+RETURNING o.id, o.idempotency_key, o.business_id, o.product_id, o.product_type, o.payload, o.payload_key_id, o.attempts`
+	dispatchedQuery = `UPDATE notification_outbox SET dispatched_at = now(), claimed_until = NULL, last_error = '' WHERE id = $1`
+	// failed messages are leased until their next attempt
+	failedQuery = `UPDATE notification_outbox SET claimed_until = now() + make_interval(secs => $3), last_error = $2 WHERE id = $1`
+	parkedQuery = `UPDATE notification_outbox SET parked_at = now(), claimed_until = NULL, last_error = $2 WHERE id = $1`
+)
+
+// Logger logs the errors of Relay, *log.Logger implements it
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Relay forwards the pending outbox messages, oldest first
+type Relay struct {
+	DB        *sql.DB
+	Forwarder Forwarder
+	// Keys opens the payloads sealed by Enqueue
+	Keys Sealer
+	// BatchSize is the number of messages claimed at once, defaults to 100
+	BatchSize int
+	// Interval is the polling interval of Run, defaults to 5 seconds
+	Interval time.Duration
+	// MaxAttempts is the number of attempts after which a failing message is parked, defaults to 10.
+	// Parked messages are kept with their last error and are not forwarded again
+	MaxAttempts int
+	// Lease bounds the time a relay takes to forward the messages it claims before other relays claim them again,
+	// defaults to 5 minutes
+	Lease time.Duration
+	// Logger logs the errors of the relay and of the forwarded messages, they are not logged when nil
+	Logger Logger
+}
+
+type record struct {
+	id           int64
+	attempts     int
+	payloadKeyID string
+	message      Message
+}
+
+// Run relays the outbox until the context is done
+func (r Relay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval())
+	defer ticker.Stop()
+
+	for {
+		for {
+			n, err := r.RelayBatch(ctx)
+			if err != nil {
+				r.logf("error relaying outbox: %v", err.Error())
+				break
+			}
+			if n < r.batchSize() {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayBatch claims one batch of messages, forwards them outside of any transaction and returns the number claimed.
+// Messages failing to be forwarded are retried later with an increasing delay, or parked after MaxAttempts, without
+// holding up the other messages
+func (r Relay) RelayBatch(ctx context.Context) (int, error) {
+	records, err := r.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, rec := range records {
+		// forwarded messages are sent again if they cannot be marked, the idempotency key prevents duplicates
+		var forwardErr error
+		if rec.message.Payload, forwardErr = openPayload(r.Keys, rec.message.Payload, rec.payloadKeyID); forwardErr == nil {
+			forwardErr = r.Forwarder.Forward(ctx, rec.message)
+		}
+		switch {
+		case forwardErr == nil:
+			_, err = r.DB.ExecContext(ctx, dispatchedQuery, rec.id)
+		case rec.attempts >= r.maxAttempts():
+			r.logf("parking outbox message %v after %d attempts: %v", rec.message.IdempotencyKey, rec.attempts, forwardErr.Error())
+			_, err = r.DB.ExecContext(ctx, parkedQuery, rec.id, forwardErr.Error())
+		default:
+			r.logf("error forwarding outbox message %v: %v", rec.message.IdempotencyKey, forwardErr.Error())
+			_, err = r.DB.ExecContext(ctx, failedQuery, rec.id, forwardErr.Error(), retryDelay(r.interval(), rec.attempts).Seconds())
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(records), nil
+}
+
+// claim leases the next batch of pending messages, in a transaction of its own
+func (r Relay) claim(ctx context.Context) ([]record, error) {
+	rows, err := r.DB.QueryContext(ctx, claimQuery, r.batchSize(), r.lease().Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []record
+	for rows.Next() {
+		var rec record
+		if err = rows.Scan(&rec.id, &rec.message.IdempotencyKey, &rec.message.BusinessID,
+			&rec.message.ProductID, &rec.message.ProductType, &rec.message.Payload, &rec.payloadKeyID, &rec.attempts); err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// the updated rows are returned in no particular order
+	sort.Slice(records, func(i, j int) bool { return records[i].id < records[j].id })
+	return records, nil
+}
+
+// retryDelay doubles the polling interval with every attempt, up to an hour
+func retryDelay(interval time.Duration, attempts int) time.Duration {
+	delay := interval
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
+
+func (r Relay) logf(format string, v ...interface{}) {
+	if r.Logger != nil {
+		r.Logger.Printf(format, v...)
+	}
+}
+
+func (r Relay) batchSize() int {
+	if r.BatchSize <= 0 {
+		return defaultBatchSize
+	}
+	return r.BatchSize
+}
+
+func (r Relay) interval() time.Duration {
+	if r.Interval <= 0 {
+		return defaultInterval
+	}
+	return r.Interval
+}
+
+func (r Relay) maxAttempts() int {
+	if r.MaxAttempts <= 0 {
+		return defaultMaxAttempts
+	}
+	return r.MaxAttempts
+}
+
+func (r Relay) lease() time.Duration {
+	if r.Lease <= 0 {
+		return defaultLease
+	}
+	return r.Lease
+}
@@ -0,0 +1,38 @@
+package outbox
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/kagelui/notification/internal/testutil"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		attempts int
+		want     time.Duration
+	}{
+		{name: "first attempt", interval: 5 * time.Second, attempts: 1, want: 5 * time.Second},
+		{name: "second attempt", interval: 5 * time.Second, attempts: 2, want: 10 * time.Second},
+		{name: "fifth attempt", interval: 5 * time.Second, attempts: 5, want: 80 * time.Second},
+		{name: "capped", interval: 5 * time.Second, attempts: 100, want: time.Hour},
+		{name: "long interval", interval: 2 * time.Hour, attempts: 1, want: time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.Equals(t, tt.want, retryDelay(tt.interval, tt.attempts))
+		})
+	}
+}
+
+func TestRelay_logf(t *testing.T) {
+	Relay{}.logf("dropped %d", 1)
+
+	var buf bytes.Buffer
+	Relay{Logger: log.New(&buf, "", 0)}.logf("error relaying outbox: %v", "db down")
+	testutil.Equals(t, "error relaying outbox: db down\n", buf.String())
+}
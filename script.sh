@@ -1,3 +0,0 @@
-#!/bin/sh
-
-./hermes